@@ -0,0 +1,117 @@
+package excelrecreator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ChecksumSheetName is the very hidden sheet that holds the content checksum
+const ChecksumSheetName = "_Checksum"
+
+// ChecksumPropertyName is the custom document property that also holds the
+// content checksum
+const ChecksumPropertyName = "ContentChecksum"
+
+// ContentChecksum returns a SHA-256 hex digest of the raw cell values of every
+// sheet except the checksum sheet, in sheet order
+func ContentChecksum(f *excelize.File) (string, error) {
+	hash := sha256.New()
+	for _, sheetName := range f.GetSheetList() {
+		if sheetName == ChecksumSheetName {
+			continue
+		}
+		rows, err := f.GetRows(sheetName, excelize.Options{RawCellValue: true})
+		if err != nil {
+			return "", err
+		}
+		hash.Write([]byte(sheetName))
+		hash.Write([]byte{0})
+		for i, row := range rows {
+			if len(row) == 0 {
+				continue
+			}
+			// Include the row number, so rows cannot be moved unnoticed
+			hash.Write([]byte(strconv.Itoa(i+1) + ":"))
+			hash.Write([]byte(strings.Join(row, "\x1f")))
+			hash.Write([]byte{'\n'})
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// VerifyChecksum reports whether the checksum stored in the checksum sheet
+// matches the current content
+func VerifyChecksum(f *excelize.File) (bool, error) {
+	stored, err := f.GetCellValue(ChecksumSheetName, "B1")
+	if err != nil {
+		return false, err
+	}
+	actual, err := ContentChecksum(f)
+	if err != nil {
+		return false, err
+	}
+	return stored != "" && stored == actual, nil
+}
+
+func (r *Recreator) appendChecksumSheet() error {
+	checksum, err := ContentChecksum(r.File)
+	if err != nil {
+		return err
+	}
+	if _, err := r.File.NewSheet(ChecksumSheetName); err != nil {
+		return err
+	}
+	if err := r.File.SetSheetRow(ChecksumSheetName, "A1", &[]interface{}{"SHA-256", checksum}); err != nil {
+		return err
+	}
+	return r.File.SetSheetVisible(ChecksumSheetName, false, true)
+}
+
+// checksumEdits adds the checksum written by appendChecksumSheet as a custom
+// document property. excelize v2.9.1 has no API for custom properties, so
+// docProps/custom.xml is added along with its content type and relationship.
+func (r *Recreator) checksumEdits(edits map[string]partEdit, parts map[string][]byte) error {
+	if !r.Options.AppendChecksumSheet {
+		return nil
+	}
+	checksum, err := r.File.GetCellValue(ChecksumSheetName, "B1")
+	if err != nil {
+		return err
+	}
+
+	var xml strings.Builder
+	xml.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	xml.WriteString(`<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/custom-properties" xmlns:vt="http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes">`)
+	xml.WriteString(`<property fmtid="{D5CDD505-2E9C-101B-9397-08002B2CF9AE}" pid="2" name="` + ChecksumPropertyName + `">`)
+	xml.WriteString(`<vt:lpwstr>` + checksum + `</vt:lpwstr></property></Properties>`)
+	parts["docProps/custom.xml"] = []byte(xml.String())
+
+	edits["[Content_Types].xml"] = func(data []byte) ([]byte, error) {
+		return insertBefore(data, "</Types>",
+			`<Override PartName="/docProps/custom.xml" ContentType="application/vnd.openxmlformats-officedocument.custom-properties+xml"/>`)
+	}
+	edits["_rels/.rels"] = func(data []byte) ([]byte, error) {
+		id := 1
+		for strings.Contains(string(data), `Id="rId`+strconv.Itoa(id)+`"`) {
+			id++
+		}
+		return insertBefore(data, "</Relationships>",
+			`<Relationship Id="rId`+strconv.Itoa(id)+`" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/custom-properties" Target="docProps/custom.xml"/>`)
+	}
+	return nil
+}
+
+// insertBefore inserts element before the closing tag of an XML part
+func insertBefore(data []byte, closingTag, element string) ([]byte, error) {
+	xml := string(data)
+	i := strings.LastIndex(xml, closingTag)
+	if i < 0 {
+		return nil, fmt.Errorf("no %s found", closingTag)
+	}
+	return []byte(xml[:i] + element + xml[i:]), nil
+}
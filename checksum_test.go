@@ -0,0 +1,93 @@
+package excelrecreator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prongbang/excelmetadata"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestAppendChecksumSheet(t *testing.T) {
+	tests := []struct {
+		name         string
+		workbookView *WorkbookView
+		edit         bool
+		wantVerified bool
+	}{
+		{name: "unchanged", wantVerified: true},
+		{name: "with other part edits", workbookView: &WorkbookView{WindowWidth: 20000}, wantVerified: true},
+		{name: "edited", edit: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.AppendChecksumSheet = true
+			options.WorkbookView = tt.workbookView
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{
+				newSheet(0, "Data", newCell("A1", "header"), newCell("B2", 42.0)),
+			}}, options)
+
+			visible, err := r.File.GetSheetVisible(ChecksumSheetName)
+			if err != nil || visible {
+				t.Errorf("checksum sheet visible = %v, %v, want hidden", visible, err)
+			}
+			stored, err := r.File.GetCellValue(ChecksumSheetName, "B1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			recomputed, err := ContentChecksum(r.File)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored != recomputed {
+				t.Errorf("stored checksum = %q, recomputed %q", stored, recomputed)
+			}
+
+			// The custom document property holds the same checksum
+			if custom := partXML(t, r.File, "docProps/custom.xml"); !strings.Contains(custom, `name="`+ChecksumPropertyName+`"><vt:lpwstr>`+stored+`</vt:lpwstr>`) {
+				t.Errorf("custom properties = %s, want checksum %s", custom, stored)
+			}
+			if contentTypes := partXML(t, r.File, "[Content_Types].xml"); !strings.Contains(contentTypes, `PartName="/docProps/custom.xml"`) {
+				t.Error("content types have no custom properties part")
+			}
+			if rels := partXML(t, r.File, "_rels/.rels"); !strings.Contains(rels, `Target="docProps/custom.xml"`) {
+				t.Error("package relationships have no custom properties part")
+			}
+
+			if tt.edit {
+				if err := r.File.SetCellValue("Data", "B2", 43.0); err != nil {
+					t.Fatal(err)
+				}
+			}
+			verified, err := VerifyChecksum(r.File)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if verified != tt.wantVerified {
+				t.Errorf("VerifyChecksum() = %v, want %v", verified, tt.wantVerified)
+			}
+		})
+	}
+}
+
+func TestAppendChecksumSheetDisabled(t *testing.T) {
+	r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("A1", "header"))}}, DefaultOptions())
+
+	if index, _ := r.File.GetSheetIndex(ChecksumSheetName); index != -1 {
+		t.Errorf("checksum sheet index = %d, want none", index)
+	}
+	buf, err := r.File.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, exists := f.Pkg.Load("docProps/custom.xml"); exists {
+		t.Error("custom properties written without AppendChecksumSheet")
+	}
+}
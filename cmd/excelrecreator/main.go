@@ -0,0 +1,111 @@
+// Command excelrecreator recreates an Excel file from excelmetadata JSON.
+//
+// Usage:
+//
+//	excelrecreator -in metadata.json -out output.xlsx [-options options.json] [-validate]
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/prongbang/excelmetadata"
+	"github.com/prongbang/excelrecreator"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("excelrecreator", flag.ContinueOnError)
+	in := flags.String("in", "", "input metadata JSON file")
+	out := flags.String("out", "", "output Excel file")
+	optionsArg := flags.String("options", "", "options as a JSON file or inline JSON object")
+	validate := flags.Bool("validate", false, "validate the metadata and print issues")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *in == "" {
+		return fmt.Errorf("-in is required")
+	}
+	if *out == "" && !*validate {
+		return fmt.Errorf("-out is required unless -validate is set")
+	}
+
+	options, err := loadOptions(*optionsArg)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata: %w", err)
+	}
+	var metadata excelmetadata.Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return fmt.Errorf("failed to unmarshal metadata: %w", err)
+	}
+
+	if *validate {
+		issues := excelrecreator.ValidateMetadata(&metadata)
+		fmt.Fprintf(stdout, "Validation issues: %d\n", len(issues))
+		for _, issue := range issues {
+			fmt.Fprintf(stdout, "- %s\n", issue)
+		}
+		if *out == "" {
+			return nil
+		}
+	}
+
+	recreator := excelrecreator.New(&metadata, options)
+	if err := recreator.Recreate(); err != nil {
+		return err
+	}
+	if err := recreator.Save(*out); err != nil {
+		return err
+	}
+
+	cells := 0
+	for _, sheet := range metadata.Sheets {
+		cells += len(sheet.Cells)
+	}
+	fmt.Fprintf(stdout, "Created %s\n", *out)
+	fmt.Fprintf(stdout, "Sheets: %d\n", len(metadata.Sheets))
+	fmt.Fprintf(stdout, "Cells: %d\n", cells)
+	fmt.Fprintf(stdout, "Styles: %d\n", len(recreator.StyleMap))
+
+	return nil
+}
+
+// loadOptions reads options from a JSON file or an inline JSON object,
+// starting from the default options with environment overrides
+func loadOptions(arg string) (*excelrecreator.Options, error) {
+	options, err := excelrecreator.LoadOptionsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if arg == "" {
+		return options, nil
+	}
+
+	data := []byte(arg)
+	if !strings.HasPrefix(strings.TrimSpace(arg), "{") {
+		if data, err = os.ReadFile(arg); err != nil {
+			return nil, fmt.Errorf("failed to read options: %w", err)
+		}
+	}
+
+	if err := options.FromJSON(data); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// fixture has an unnamed sheet, which validation reports and recreation names
+// Sheet1
+const fixture = `{"sheets":[{"index":0,"name":"","visible":true,"cells":[{"address":"A1","value":"hello"}]}]}`
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       func(in, out string) []string
+		wantOutput []string
+		wantFile   bool
+		wantErr    bool
+	}{
+		{
+			name:       "recreate",
+			args:       func(in, out string) []string { return []string{"-in", in, "-out", out} },
+			wantOutput: []string{"Created ", "Sheets: 1", "Cells: 1"},
+			wantFile:   true,
+		},
+		{
+			name:       "validate only",
+			args:       func(in, out string) []string { return []string{"-in", in, "-validate"} },
+			wantOutput: []string{"Validation issues: 1", "- sheet 0 has no name"},
+		},
+		{
+			name: "validate and recreate with inline options",
+			args: func(in, out string) []string {
+				return []string{"-in", in, "-out", out, "-validate", "-options", `{"PreserveStyles": false}`}
+			},
+			wantOutput: []string{"Validation issues: 1", "Created "},
+			wantFile:   true,
+		},
+		{
+			name:    "missing input",
+			args:    func(in, out string) []string { return []string{"-out", out} },
+			wantErr: true,
+		},
+		{
+			name:    "missing output",
+			args:    func(in, out string) []string { return []string{"-in", in} },
+			wantErr: true,
+		},
+		{
+			name:    "invalid options",
+			args:    func(in, out string) []string { return []string{"-in", in, "-out", out, "-options", "{"} },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			in, out := filepath.Join(dir, "metadata.json"), filepath.Join(dir, "out.xlsx")
+			if err := os.WriteFile(in, []byte(fixture), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			var stdout strings.Builder
+			err := run(tt.args(in, out), &stdout)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, want := range tt.wantOutput {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("output = %q, want it to contain %q", stdout.String(), want)
+				}
+			}
+
+			f, err := excelize.OpenFile(out)
+			if (err == nil) != tt.wantFile {
+				t.Fatalf("output file opened = %v, want %v", err == nil, tt.wantFile)
+			}
+			if err != nil {
+				return
+			}
+			defer f.Close()
+			if value, _ := f.GetCellValue("Sheet1", "A1"); value != "hello" {
+				t.Errorf("Sheet1!A1 = %q, want %q", value, "hello")
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package excelrecreator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prongbang/excelmetadata"
+)
+
+// DiffKind describes how an item differs between two metadata objects
+type DiffKind string
+
+const (
+	DiffAdded   DiffKind = "added"
+	DiffRemoved DiffKind = "removed"
+	DiffChanged DiffKind = "changed"
+)
+
+// MetadataDiff describes one difference between two metadata objects
+type MetadataDiff struct {
+	Kind    DiffKind
+	Sheet   string // Sheet name, empty for style differences
+	Address string // Cell address, empty for sheet and style differences
+	StyleID int    // Style ID, set for style differences
+	Message string
+}
+
+// String returns a readable description of the difference
+func (d MetadataDiff) String() string {
+	switch {
+	case d.Address != "":
+		return fmt.Sprintf("%s cell %s!%s: %s", d.Kind, d.Sheet, d.Address, d.Message)
+	case d.Sheet != "":
+		return fmt.Sprintf("%s sheet %s: %s", d.Kind, d.Sheet, d.Message)
+	default:
+		return fmt.Sprintf("%s style %d: %s", d.Kind, d.StyleID, d.Message)
+	}
+}
+
+// DiffMetadata reports the sheets, cells and styles that were added, removed
+// or changed from a to b. Sheets are matched by name and cells by address.
+func DiffMetadata(a, b *excelmetadata.Metadata) []MetadataDiff {
+	if a == nil {
+		a = &excelmetadata.Metadata{}
+	}
+	if b == nil {
+		b = &excelmetadata.Metadata{}
+	}
+
+	var diffs []MetadataDiff
+
+	sheetsB := make(map[string]excelmetadata.SheetMetadata)
+	for _, sheet := range b.Sheets {
+		sheetsB[sheet.Name] = sheet
+	}
+	sheetsA := make(map[string]bool)
+	for _, sheetA := range a.Sheets {
+		sheetsA[sheetA.Name] = true
+		sheetB, exists := sheetsB[sheetA.Name]
+		if !exists {
+			diffs = append(diffs, MetadataDiff{Kind: DiffRemoved, Sheet: sheetA.Name, Message: "sheet removed"})
+			continue
+		}
+		diffs = append(diffs, diffSheets(sheetA, sheetB)...)
+	}
+	for _, sheetB := range b.Sheets {
+		if !sheetsA[sheetB.Name] {
+			diffs = append(diffs, MetadataDiff{Kind: DiffAdded, Sheet: sheetB.Name, Message: "sheet added"})
+		}
+	}
+
+	diffs = append(diffs, diffStyles(a.Styles, b.Styles)...)
+
+	return diffs
+}
+
+// diffSheets compares the settings and cells of two sheets with the same name
+func diffSheets(a, b excelmetadata.SheetMetadata) []MetadataDiff {
+	var diffs []MetadataDiff
+
+	// Compare sheet settings without cells
+	settingsA, settingsB := a, b
+	settingsA.Cells, settingsB.Cells = nil, nil
+	if !jsonEqual(settingsA, settingsB) {
+		diffs = append(diffs, MetadataDiff{Kind: DiffChanged, Sheet: a.Name, Message: "sheet settings changed"})
+	}
+
+	cellsB := make(map[string]excelmetadata.CellMetadata)
+	for _, cell := range b.Cells {
+		cellsB[strings.ToUpper(cell.Address)] = cell
+	}
+	cellsA := make(map[string]bool)
+	for _, cellA := range a.Cells {
+		address := strings.ToUpper(cellA.Address)
+		cellsA[address] = true
+		cellB, exists := cellsB[address]
+		if !exists {
+			diffs = append(diffs, MetadataDiff{Kind: DiffRemoved, Sheet: a.Name, Address: cellA.Address, Message: "cell removed"})
+			continue
+		}
+		if changes := diffCells(cellA, cellB); len(changes) > 0 {
+			diffs = append(diffs, MetadataDiff{Kind: DiffChanged, Sheet: a.Name, Address: cellA.Address, Message: strings.Join(changes, ", ")})
+		}
+	}
+	for _, cellB := range b.Cells {
+		if !cellsA[strings.ToUpper(cellB.Address)] {
+			diffs = append(diffs, MetadataDiff{Kind: DiffAdded, Sheet: a.Name, Address: cellB.Address, Message: "cell added"})
+		}
+	}
+
+	return diffs
+}
+
+// diffCells describes the changed fields of two cells with the same address
+func diffCells(a, b excelmetadata.CellMetadata) []string {
+	var changes []string
+
+	if fmt.Sprint(a.Value) != fmt.Sprint(b.Value) {
+		changes = append(changes, fmt.Sprintf("value %v -> %v", a.Value, b.Value))
+	}
+	if a.Formula != b.Formula {
+		changes = append(changes, fmt.Sprintf("formula %q -> %q", a.Formula, b.Formula))
+	}
+	if a.StyleID != b.StyleID {
+		changes = append(changes, fmt.Sprintf("style %d -> %d", a.StyleID, b.StyleID))
+	}
+	if !jsonEqual(a.Hyperlink, b.Hyperlink) {
+		changes = append(changes, "hyperlink changed")
+	}
+
+	return changes
+}
+
+// diffStyles compares styles by ID
+func diffStyles(a, b map[int]excelmetadata.StyleDetails) []MetadataDiff {
+	var diffs []MetadataDiff
+
+	ids := make(map[int]bool)
+	for id := range a {
+		ids[id] = true
+	}
+	for id := range b {
+		ids[id] = true
+	}
+	sorted := make([]int, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Ints(sorted)
+
+	for _, id := range sorted {
+		styleA, inA := a[id]
+		styleB, inB := b[id]
+		switch {
+		case !inB:
+			diffs = append(diffs, MetadataDiff{Kind: DiffRemoved, StyleID: id, Message: "style removed"})
+		case !inA:
+			diffs = append(diffs, MetadataDiff{Kind: DiffAdded, StyleID: id, Message: "style added"})
+		case !jsonEqual(styleA, styleB):
+			diffs = append(diffs, MetadataDiff{Kind: DiffChanged, StyleID: id, Message: "style changed"})
+		}
+	}
+
+	return diffs
+}
+
+// jsonEqual reports whether two values have the same JSON encoding
+func jsonEqual(a, b interface{}) bool {
+	dataA, errA := json.Marshal(a)
+	dataB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(dataA) == string(dataB)
+}
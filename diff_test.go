@@ -0,0 +1,71 @@
+package excelrecreator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prongbang/excelmetadata"
+)
+
+func TestDiffMetadata(t *testing.T) {
+	base := func() *excelmetadata.Metadata {
+		return &excelmetadata.Metadata{
+			Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("A1", "a"), newCell("B1", 1.0))},
+			Styles: map[int]excelmetadata.StyleDetails{1: {NumberFormat: 4}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(m *excelmetadata.Metadata)
+		want   []string
+	}{
+		{name: "identical", change: func(m *excelmetadata.Metadata) {}},
+		{
+			name:   "one cell value",
+			change: func(m *excelmetadata.Metadata) { m.Sheets[0].Cells[1].Value = 2.0 },
+			want:   []string{"changed cell Data!B1: value 1 -> 2"},
+		},
+		{
+			name: "cell added and removed",
+			change: func(m *excelmetadata.Metadata) {
+				m.Sheets[0].Cells = []excelmetadata.CellMetadata{newCell("a1", "a"), newCell("C1", "c")}
+			},
+			want: []string{"removed cell Data!B1: cell removed", "added cell Data!C1: cell added"},
+		},
+		{
+			name: "sheet renamed",
+			change: func(m *excelmetadata.Metadata) {
+				m.Sheets[0].Name = "Other"
+			},
+			want: []string{"removed sheet Data: sheet removed", "added sheet Other: sheet added"},
+		},
+		{
+			name:   "sheet settings",
+			change: func(m *excelmetadata.Metadata) { m.Sheets[0].Visible = false },
+			want:   []string{"changed sheet Data: sheet settings changed"},
+		},
+		{
+			name: "styles",
+			change: func(m *excelmetadata.Metadata) {
+				m.Styles[1] = excelmetadata.StyleDetails{NumberFormat: 9}
+				m.Styles[2] = excelmetadata.StyleDetails{}
+			},
+			want: []string{"changed style 1: style changed", "added style 2: style added"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := base()
+			tt.change(b)
+			var got []string
+			for _, diff := range DiffMetadata(base(), b) {
+				got = append(got, diff.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffMetadata() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package excelrecreator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/prongbang/excelmetadata"
+	"github.com/xuri/excelize/v2"
+)
+
+// MetadataSheetName is the very hidden sheet that holds the embedded source
+// metadata
+const MetadataSheetName = "_Metadata"
+
+// metadataEncoding identifies how the embedded metadata is encoded
+const metadataEncoding = "gzip+base64"
+
+// metadataChunkSize keeps each chunk below the cell text limit of 32767
+const metadataChunkSize = 32000
+
+// ExtractEmbeddedMetadata returns the source metadata stored by
+// Options.EmbedSourceMetadata
+func ExtractEmbeddedMetadata(f *excelize.File) (*excelmetadata.Metadata, error) {
+	rows, err := f.GetRows(MetadataSheetName)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 || len(rows[0]) == 0 || rows[0][0] != metadataEncoding {
+		return nil, fmt.Errorf("sheet %s has no embedded metadata", MetadataSheetName)
+	}
+
+	var encoded strings.Builder
+	for _, row := range rows[1:] {
+		if len(row) > 0 {
+			encoded.WriteString(row[0])
+		}
+	}
+	compressed, err := base64.StdEncoding.DecodeString(encoded.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode embedded metadata: %w", err)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress embedded metadata: %w", err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress embedded metadata: %w", err)
+	}
+
+	var metadata excelmetadata.Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal embedded metadata: %w", err)
+	}
+	return &metadata, nil
+}
+
+func (r *Recreator) embedSourceMetadata() error {
+	data, err := json.Marshal(r.Metadata)
+	if err != nil {
+		return err
+	}
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(data); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(compressed.Bytes())
+
+	if _, err := r.File.NewSheet(MetadataSheetName); err != nil {
+		return err
+	}
+	if err := r.File.SetCellStr(MetadataSheetName, "A1", metadataEncoding); err != nil {
+		return err
+	}
+	for row := 2; len(encoded) > 0; row++ {
+		chunk := encoded[:min(metadataChunkSize, len(encoded))]
+		encoded = encoded[len(chunk):]
+		if err := r.File.SetCellStr(MetadataSheetName, fmt.Sprintf("A%d", row), chunk); err != nil {
+			return err
+		}
+	}
+	return r.File.SetSheetVisible(MetadataSheetName, false, true)
+}
@@ -0,0 +1,105 @@
+package excelrecreator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/prongbang/excelmetadata"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestEmbedSourceMetadata(t *testing.T) {
+	// Hashes do not compress, so many of them span several chunks
+	large := newSheet(1, "Large")
+	for i := 0; i < 2000; i++ {
+		sum := sha256.Sum256([]byte(fmt.Sprint(i)))
+		large.Cells = append(large.Cells, newCell(fmt.Sprintf("A%d", i+1), hex.EncodeToString(sum[:])))
+	}
+
+	tests := []struct {
+		name       string
+		metadata   *excelmetadata.Metadata
+		wantChunks int
+	}{
+		{
+			name: "small",
+			metadata: &excelmetadata.Metadata{
+				Properties: excelmetadata.DocumentProperties{Title: "Report"},
+				Styles:     map[int]excelmetadata.StyleDetails{1: {Font: &excelmetadata.FontStyle{Bold: true}}},
+				Sheets:     []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("A1", "header"), newCell("B2", 42.0))},
+			},
+			wantChunks: 1,
+		},
+		{
+			name:       "chunked",
+			metadata:   &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("A1", "header")), large}},
+			wantChunks: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.EmbedSourceMetadata = true
+			r := recreate(t, tt.metadata, options)
+
+			buf, err := r.File.WriteToBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := excelize.OpenReader(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			if visible, err := f.GetSheetVisible(MetadataSheetName); err != nil || visible {
+				t.Errorf("metadata sheet visible = %v, %v, want hidden", visible, err)
+			}
+			rows, err := f.GetRows(MetadataSheetName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chunks := len(rows) - 1; chunks < tt.wantChunks {
+				t.Errorf("chunks = %d, want at least %d", chunks, tt.wantChunks)
+			}
+
+			extracted, err := ExtractEmbeddedMetadata(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := json.Marshal(extracted)
+			want, _ := json.Marshal(tt.metadata)
+			if string(got) != string(want) {
+				t.Errorf("extracted metadata differs from the input:\n got %.200s\nwant %.200s", got, want)
+			}
+		})
+	}
+}
+
+func TestExtractEmbeddedMetadataMissing(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(f *excelize.File)
+	}{
+		{name: "no sheet", setup: func(f *excelize.File) {}},
+		{name: "unknown encoding", setup: func(f *excelize.File) {
+			f.NewSheet(MetadataSheetName)
+			f.SetCellStr(MetadataSheetName, "A1", "zip")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := excelize.NewFile()
+			defer f.Close()
+			tt.setup(f)
+			if _, err := ExtractEmbeddedMetadata(f); err == nil {
+				t.Error("ExtractEmbeddedMetadata() succeeded, want an error")
+			}
+		})
+	}
+}
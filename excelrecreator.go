@@ -1,32 +1,397 @@
 package excelrecreator
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/prongbang/excelmetadata"
 	"github.com/xuri/excelize/v2"
 )
 
+// defaultSheetName is the sheet excelize.NewFile creates in every new workbook
+const defaultSheetName = "Sheet1"
+
+// unnamedSheetPrefix names unnamed sheets "Sheet1", "Sheet2" and so on when
+// Options.DefaultSheetName is empty
+const unnamedSheetPrefix = "Sheet"
+
+// percentNumFmt is the built-in "0%" number format
+const percentNumFmt = 9
+
+// defaultImageQuality is the JPEG quality used by RecompressImages
+const defaultImageQuality = 75
+
+// defaultCellProgressInterval is the number of cells between progress reports
+// when Options.CellProgressInterval is not set
+const defaultCellProgressInterval = 1000
+
 // Recreator handles the recreation of Excel files from metadata
 type Recreator struct {
-	File     *excelize.File
+	File     *excelize.File // Replaced when Recreate reopens the workbook, so read it after Recreate
 	Metadata *excelmetadata.Metadata
 	Options  *Options
 	StyleMap map[int]int // Maps old style IDs to new style IDs
+
+	createdSheets  map[string]bool // Names of sheets created from metadata
+	derivedStyles  *styleCache     // Caches styles derived from per-cell settings
+	warnings       []Warning       // Non-fatal issues found during Recreate
+	sheetNames     map[int]string  // Created sheet names by position in Metadata.Sheets
+	buffer         *sheetBuffer    // Rows of the sheet being recreated with FlushPerSheet
+	activeSheetSet bool            // FlushPerSheet set the active sheet before flushing it
+	phonetics      []phonetic      // Phonetic guides added by PreservePhonetic
+	dateStyles     map[int]bool    // Whether created styles have a date format, cached by CoerceDates
+}
+
+// Warning describes a non-fatal issue found during Recreate
+type Warning struct {
+	SheetName string
+	Address   string // Cell address, empty for sheet and workbook warnings
+	Code      string
+	Message   string
 }
 
+// Warning codes
+const (
+	WarningSheetRenamed     = "sheetRenamed"     // A duplicate sheet name was made unique
+	WarningSheetSkipped     = "sheetSkipped"     // A sheet failed and was skipped by ContinueOnError
+	WarningTruncated        = "truncated"        // A string over the cell limit was truncated
+	WarningCommentTimestamp = "commentTimestamp" // A comment's created time could not be kept
+	WarningThreadedComment  = "threadedComment"  // A threaded comment was written as a legacy note
+	WarningCoveredCleared   = "coveredCleared"   // A value under a merge was cleared by ClearCoveredCells
+	WarningPhoneticDropped  = "phoneticDropped"  // A phonetic guide had no shared string to attach to
+	WarningSheetSanitized   = "sheetSanitized"   // An invalid sheet name was made valid
+	WarningCapped           = "capped"           // Items beyond MaxRows or MaxCols were skipped or cut
+	WarningHyperlinkFixed   = "hyperlinkFixed"   // A hyperlink was changed by NormalizeHyperlinks
+	WarningStyleMissing     = "styleMissing"     // A cell references a style ID missing from the style map
+	WarningValidationFailed = "validationFailed" // A data validation could not be added
+	WarningImageFailed      = "imageFailed"      // An image could not be added
+	WarningFontScheme       = "fontScheme"       // Fonts without a family lost their theme font scheme, warned once
+	WarningSparseSheet      = "sparseSheet"      // A sheet has few cells far down, which excelize holds every row for
+)
+
 // Options configures the recreation behavior
 type Options struct {
-	PreserveFormulas       bool
-	PreserveStyles         bool
-	PreserveDataValidation bool
-	PreserveImages         bool
-	SkipEmptyCells         bool
-	DefaultSheetName       string
+	PreserveFormulas        bool
+	PreserveStyles          bool
+	PreserveDataValidation  bool
+	PreserveImages          bool
+	PreserveRTL             bool // Apply SheetOptions.RightToLeft to sheet views, off by default
+	SkipEmptyCells          bool
+	DefaultSheetName        string
+	DeduplicateStyles       bool // Reuse one style for structurally identical style definitions
+	TreatEmptyStringAsEmpty bool // Treat "" values as empty cells instead of text
+	TrimCellWhitespace      bool // Trim string values, treating whitespace-only values as empty
+	StripDocumentProperties bool // Write no document properties, clearing excelize defaults such as the creator
+	RequireAllStyles        bool // Fail when a cell references a style ID missing from the style map
+	BooleanAsNumber         bool // Write booleans as 1 and 0 instead of TRUE and FALSE
+	AppendChecksumSheet     bool // Write a content checksum to a very hidden sheet and a custom property for tamper evidence
+	RenumberSheets          bool // Order sheets by Index and renumber them from 0 before creation
+	GenerateInfoSheet       bool // Prepend a sheet listing document properties and a sheet inventory
+	EmbedSourceMetadata     bool // Store the source metadata in a very hidden sheet, see ExtractEmbeddedMetadata
+	ContinueOnError         bool // Skip sheets that fail with a warning instead of aborting
+	VerifyAfterSave         bool // Reopen and read the file after Save, failing if it is corrupt
+	StructureOnly           bool // Write only the header rows of each sheet, for an empty template
+	HeaderRows              int  // Number of header rows kept by StructureOnly, 0 means 1
+	MaxRows                 int  // Skip cells and row settings beyond this row and cut ranges to it, with a warning. 0 means no cap.
+	MaxCols                 int  // Skip cells and column settings beyond this column and cut ranges to it, with a warning. 0 means no cap.
+	Date1904                bool // Use the 1904 date system of legacy Mac workbooks
+	CoerceDates             bool // Write date strings and times in cells with a date format as date serials
+	NormalizeHyperlinks     bool // Trim and encode cell hyperlinks, adding a missing scheme, with a warning per change
+	FlushPerSheet           bool // Stream each sheet to a temporary file once written, so only one sheet is held in memory
+	ClearCoveredCells       bool // Clear values hidden under merged cells with a warning; only FlushPerSheet keeps them otherwise
+	PreservePhonetic        bool // Apply CellOptions.PhoneticText to text cells
+
+	// PreserveExistingActiveSheet keeps the active sheet of File instead of
+	// activating the first visible recreated sheet, for example when sheets
+	// are appended to an opened workbook assigned to File
+	PreserveExistingActiveSheet bool
+
+	// SheetNameTemplate names unnamed sheets in place of DefaultSheetName, as
+	// a fmt format of the 1-based sheet number such as "Data_%02d"
+	SheetNameTemplate string
+
+	// AppProps sets the application properties (docProps/app.xml), which
+	// excelmetadata does not extract
+	AppProps *excelize.AppProperties
+
+	// DefaultFont sets the workbook default font inherited by cells without
+	// an explicit font
+	DefaultFont *DefaultFont
+
+	// AutoMergeRepeats merges vertically adjacent cells with the same value,
+	// as in grouped reports, limited to AutoMergeColumns (e.g. "A") if set
+	AutoMergeRepeats bool
+	AutoMergeColumns []string
+
+	// PercentColumns lists columns (e.g. "C") whose numeric cells without a
+	// number format are shown as percentages, so 0.25 displays as 25%
+	PercentColumns []string
+
+	// FontScale multiplies every font size, including the default font, for
+	// example 1.5 for a large-print version. 0 keeps the sizes.
+	FontScale float64
+
+	// BaseStyles maps metadata style IDs to the style they inherit from. A
+	// style only needs the sections (font, fill, border, alignment, number
+	// format, protection) that override its base.
+	BaseStyles map[int]int
+
+	// RecompressImages re-encodes JPEG images at ImageQuality (1-100, default
+	// 75) and PNG images at the best compression, keeping the original when
+	// it is smaller
+	RecompressImages bool
+	ImageQuality     int
+
+	// CellProgressFunc, when set, is called every CellProgressInterval cells
+	// (default 1000) and after the last cell of each sheet
+	CellProgressFunc     func(sheetName string, done, total int)
+	CellProgressInterval int
+
+	// SelectedSheets lists sheets to select together as a group
+	SelectedSheets []string
+
+	// SheetFilter, when set, skips sheets for which it returns false. The
+	// remaining sheets are renumbered from 0.
+	SheetFilter func(sheet excelmetadata.SheetMetadata) bool
+
+	// TabColorByCategory returns the tab color ("#RRGGBB") of a sheet, such
+	// as one color per name prefix. An empty color falls back to
+	// DefaultTabColor.
+	TabColorByCategory func(sheet excelmetadata.SheetMetadata) string
+
+	// DefaultTabColor is the tab color of sheets without a category color
+	DefaultTabColor string
+
+	// MergeConflictPolicy resolves overlapping merged cells. An empty policy
+	// passes every merge to excelize unchanged.
+	MergeConflictPolicy MergeConflictPolicy
+
+	// LongStringPolicy handles strings over the cell limit. An empty policy
+	// truncates with a warning.
+	LongStringPolicy LongStringPolicy
+
+	// NilValuePolicy handles cells without a value or formula. An empty
+	// policy skips them if SkipEmptyCells is set and writes blank cells
+	// otherwise.
+	NilValuePolicy NilValuePolicy
+
+	// CellWriteOrder sorts the cells of each sheet before they are written.
+	// An empty order writes them as they appear in the metadata.
+	CellWriteOrder CellWriteOrder
+
+	// Sheets holds per-sheet settings keyed by sheet name
+	Sheets map[string]*SheetOptions
+
+	// WorkbookProtection protects the workbook structure and windows
+	WorkbookProtection *excelize.WorkbookProtectionOptions
+
+	// WorkbookView sets the active tab, first visible tab and window size
+	// and position of the workbook window
+	WorkbookView *WorkbookView
+}
+
+// Comment is a cell comment. Runs, when set, replace Text with formatted
+// text, such as a bold author line followed by a normal body.
+type Comment struct {
+	Author string
+	Text   string
+	Runs   []RichTextRun
+
+	// Created is when the comment was written. Only threaded comments store
+	// it, which excelize cannot write, so a set time is reported as a warning.
+	Created time.Time
+
+	// Threaded marks a modern threaded comment. excelize writes legacy
+	// comments (notes) only, so it is written as a note with a warning.
+	Threaded bool
+}
+
+// DefaultFont is the workbook default font
+type DefaultFont struct {
+	Family string  // Font family such as "Arial"
+	Size   float64 // Font size in points, 0 keeps the current size
+}
+
+// WorkbookView is the workbook window, which excelmetadata does not extract.
+// Zero fields keep the excelize defaults.
+type WorkbookView struct {
+	ActiveTab    *int // Position of the active sheet, nil activates the first visible sheet
+	FirstSheet   int  // Position of the first sheet shown in the tab bar
+	XWindow      int  // Left edge of the window in twips
+	YWindow      int  // Top edge of the window in twips
+	WindowWidth  int  // Window width in twips
+	WindowHeight int  // Window height in twips
+}
+
+// RichTextRun is a run of text with its own font in a rich text cell
+type RichTextRun struct {
+	Text      string
+	Bold      bool
+	Italic    bool
+	Underline string  // "single" or "double"
+	Color     string  // "#RRGGBB", "RRGGBB" or "#RGB"
+	Size      float64 // Font size in points
+	Family    string  // Font family such as "Arial"
+}
+
+// MergeConflictPolicy decides which of two overlapping merged cells is kept
+type MergeConflictPolicy string
+
+const (
+	MergeConflictSkip        MergeConflictPolicy = "skip"        // Drop every overlapping merge
+	MergeConflictKeepFirst   MergeConflictPolicy = "keepFirst"   // Keep the merge that comes first
+	MergeConflictKeepLargest MergeConflictPolicy = "keepLargest" // Keep the merge covering the most cells
+)
+
+// LongStringPolicy decides how strings longer than Excel's cell limit of
+// 32,767 characters are written
+type LongStringPolicy string
+
+const (
+	LongStringTruncate LongStringPolicy = "truncate" // Truncate to the limit with a warning
+	LongStringError    LongStringPolicy = "error"    // Fail the cell
+)
+
+// NilValuePolicy decides how cells without a value or formula are written
+type NilValuePolicy string
+
+const (
+	NilValueDefault     NilValuePolicy = ""            // Follow SkipEmptyCells
+	NilValueBlank       NilValuePolicy = "blank"       // Write a blank cell, keeping its style
+	NilValueEmptyString NilValuePolicy = "emptyString" // Write an empty text value
+	NilValueSkip        NilValuePolicy = "skip"        // Write nothing, not even the style
+)
+
+// CellWriteOrder decides the order in which the cells of a sheet are written
+type CellWriteOrder string
+
+const (
+	CellWriteAsIs     CellWriteOrder = ""         // Keep the metadata order
+	CellWriteRowMajor CellWriteOrder = "rowMajor" // Row by row, left to right
+	CellWriteColMajor CellWriteOrder = "colMajor" // Column by column, top to bottom
+)
+
+// SheetOptions configures settings for a single sheet that excelmetadata does
+// not extract
+type SheetOptions struct {
+	RowStyles   map[int]int             // Maps row numbers to metadata style IDs
+	Cells       map[string]*CellOptions // Per-cell settings keyed by cell address
+	RightToLeft bool                    // Display the sheet right-to-left
+
+	// DefaultNumFmt is the built-in number format (e.g. 4 for "#,##0.00") of
+	// numeric cells whose style has no number format. The currency formats
+	// 5-8 are written as their en-US format codes
+	DefaultNumFmt int
+
+	// Panes sets frozen panes (Freeze) or resizable split panes (Split, with
+	// XSplit and YSplit in twentieths of a point)
+	Panes *excelize.Panes
+
+	// ActiveCell is the selected cell (e.g. "C5"), replacing any selection
+	// in Panes
+	ActiveCell string
+
+	// ConditionalFormats are the conditional formatting rules of the sheet
+	ConditionalFormats []ConditionalFormat
+
+	// Tables are the tables of the sheet. Set StyleName (e.g.
+	// "TableStyleMedium9") and the stripe and first/last column flags to
+	// style them; the header names are read from the header row cells.
+	Tables []excelize.Table
+
+	PrintGridLines bool // Print cell gridlines
+	PrintHeadings  bool // Print row numbers and column letters
+
+	// ProtectionAlgorithm hashes the sheet protection password, such as
+	// "SHA-512". Empty uses the legacy XOR hash.
+	ProtectionAlgorithm string
+
+	// RowOutlineLevels and ColOutlineLevels group rows (by number) and
+	// columns (e.g. "B") at an outline level from 1 to 7
+	RowOutlineLevels map[int]uint8
+	ColOutlineLevels map[string]uint8
+
+	// OutlineSummaryBelow and OutlineSummaryRight place the summary row below
+	// and the summary column right of their groups, which decides the side of
+	// the collapse buttons. Nil keeps Excel's default of true.
+	OutlineSummaryBelow *bool
+	OutlineSummaryRight *bool
+}
+
+// ConditionalFormat is a conditional formatting rule for a range
+type ConditionalFormat struct {
+	Range string // Cell range such as "A1:A10"
+
+	// Priority orders the rules of a sheet; lower values are evaluated
+	// first, and rules with equal priority keep their order. With
+	// Rule.StopIfTrue, a matching rule stops the rules after it.
+	Priority int
+
+	// StyleID is the metadata style used as the rule's format. When 0,
+	// Rule.Format is used as is.
+	StyleID int
+
+	Rule excelize.ConditionalFormatOptions
+}
+
+// CellOptions configures settings for a single cell that excelmetadata does not
+// extract
+type CellOptions struct {
+	FillColor  string // Solid fill color (e.g. "#FFFF00") merged into the cell's style
+	SpillRange string // Range a dynamic array formula spills into (e.g. "A1:A5")
+
+	// Indent sets the indentation level merged into the cell's style, left
+	// aligning the cell unless its style aligns it otherwise
+	Indent int
+
+	// AsText writes the formula, with its leading "=", or the value as
+	// quote-prefixed literal text, such as documentation of a formula
+	AsText bool
+
+	// QuotePrefix marks the cell as text stored with a leading apostrophe, so
+	// a value such as "=abc" stays literal text when edited in Excel
+	QuotePrefix bool
+
+	// RichText writes the cell as formatted text runs instead of its value
+	RichText []RichTextRun
+
+	// PhoneticText is the phonetic guide (furigana) of a text cell, such as
+	// the katakana reading of Japanese kanji. It covers the whole text.
+	PhoneticText string
+
+	// Comment adds a comment (note) to the cell
+	Comment *Comment
+
+	// Validation adds a data validation, such as a dropdown list, to the
+	// cell alone. Its Range is ignored.
+	Validation *excelmetadata.DataValidation
+
+	// OriginalType is the Go type of the value before JSON encoding: "int",
+	// "float", "bool", "string" or "time" (RFC 3339). It restores types JSON
+	// erases, such as an int decoded as float64.
+	OriginalType string
+
+	// ImageWidth and ImageHeight set the target size in pixels of an image
+	// anchored at the cell. If only one is set, the aspect ratio is kept.
+	ImageWidth  int
+	ImageHeight int
 }
 
 // DefaultOptions returns recommended default options
@@ -37,7 +402,7 @@ func DefaultOptions() *Options {
 		PreserveDataValidation: true,
 		PreserveImages:         true,
 		SkipEmptyCells:         true,
-		DefaultSheetName:       "Sheet",
+		DefaultSheetName:       unnamedSheetPrefix,
 	}
 }
 
@@ -52,6 +417,10 @@ func New(metadata *excelmetadata.Metadata, options *Options) *Recreator {
 		Metadata: metadata,
 		Options:  options,
 		StyleMap: make(map[int]int),
+
+		createdSheets: make(map[string]bool),
+		derivedStyles: newStyleCache(),
+		sheetNames:    make(map[int]string),
 	}
 }
 
@@ -75,13 +444,88 @@ func NewFromJSONFile(jsonPath string, options *Options) (*Recreator, error) {
 	return NewFromJSON(data, options)
 }
 
+// NewFromJSONDir creates a new Recreator from a directory of JSON metadata
+// files, such as one file per sheet. The files are merged with MergeMetadata
+// in filename order.
+func NewFromJSONDir(dir string, options *Options) (*Recreator, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list JSON files: %w", err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no JSON files found in %s", dir)
+	}
+	sort.Strings(paths)
+
+	parts := make([]*excelmetadata.Metadata, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JSON file: %w", err)
+		}
+		var metadata excelmetadata.Metadata
+		if err := json.Unmarshal(data, &metadata); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal %s: %w", filepath.Base(path), err)
+		}
+		parts = append(parts, &metadata)
+	}
+
+	return New(MergeMetadata(parts...), options), nil
+}
+
 // Recreate performs the Excel file recreation
 func (r *Recreator) Recreate() error {
+	return r.RecreateContext(context.Background())
+}
+
+// RecreateWithTimeout performs the recreation, failing with an error wrapping
+// context.DeadlineExceeded if it takes longer than timeout
+func (r *Recreator) RecreateWithTimeout(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return r.RecreateContext(ctx)
+}
+
+// RecreateContext performs the recreation, stopping between cells when ctx is
+// canceled. The workbook is incomplete after a canceled recreation.
+func (r *Recreator) RecreateContext(ctx context.Context) error {
+	if r.Options.SheetNameTemplate != "" {
+		if err := validateSheetNameTemplate(r.Options.SheetNameTemplate); err != nil {
+			return err
+		}
+	}
+
+	// The checksum reads every sheet back, which FlushPerSheet has moved to
+	// temporary files
+	if r.Options.FlushPerSheet && r.Options.AppendChecksumSheet {
+		return fmt.Errorf("AppendChecksumSheet cannot be combined with FlushPerSheet")
+	}
+	if r.Options.FlushPerSheet {
+		if err := checkTempDir(); err != nil {
+			return err
+		}
+	}
+
 	// Set document properties
 	if err := r.recreateDocumentProperties(); err != nil {
 		return fmt.Errorf("failed to recreate document properties: %w", err)
 	}
 
+	// Set the date system before cells, whose date serials depend on it
+	if r.Options.Date1904 {
+		date1904 := true
+		if err := r.File.SetWorkbookProps(&excelize.WorkbookPropsOptions{Date1904: &date1904}); err != nil {
+			return fmt.Errorf("failed to set date system: %w", err)
+		}
+	}
+
+	// Set the default font before styles, which inherit it
+	if r.Options.DefaultFont != nil || r.Options.FontScale > 0 {
+		if err := r.recreateDefaultFont(); err != nil {
+			return fmt.Errorf("failed to set default font: %w", err)
+		}
+	}
+
 	// Recreate styles first (to get style mapping)
 	if r.Options.PreserveStyles && len(r.Metadata.Styles) > 0 {
 		if err := r.recreateStyles(); err != nil {
@@ -89,10 +533,42 @@ func (r *Recreator) Recreate() error {
 		}
 	}
 
+	sheets, positions := r.sheetsToRecreate()
+
 	// Recreate each sheet
-	for _, sheetMeta := range r.Metadata.Sheets {
-		if err := r.recreateSheet(sheetMeta); err != nil {
-			return fmt.Errorf("failed to recreate sheet %s: %w", sheetMeta.Name, err)
+	for i, sheetMeta := range sheets {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("recreation canceled: %w", err)
+		}
+		sheetName, err := r.recreateSheet(ctx, sheetMeta)
+		if err == nil {
+			r.sheetNames[positions[i]] = sheetName
+			continue
+		}
+		created := sheetName != ""
+		if !created {
+			sheetName = r.sheetName(sheetMeta)
+		}
+		if ctx.Err() != nil || !r.Options.ContinueOnError {
+			return fmt.Errorf("failed to recreate sheet %s: %w", sheetName, err)
+		}
+		// Drop the partly recreated sheet
+		if created {
+			if err := r.removeSheet(sheetName); err != nil {
+				return fmt.Errorf("failed to remove sheet %s: %w", sheetName, err)
+			}
+		}
+		r.warn(sheetName, "", WarningSheetSkipped, err.Error())
+	}
+
+	// Remove the default sheet created by excelize
+	r.deleteDefaultSheet()
+
+	// Prepend the info sheet before defined names, whose sheet scopes are
+	// stored as sheet positions
+	if r.Options.GenerateInfoSheet {
+		if err := r.prependInfoSheet(sheets, positions); err != nil {
+			return fmt.Errorf("failed to generate info sheet: %w", err)
 		}
 	}
 
@@ -103,20 +579,134 @@ func (r *Recreator) Recreate() error {
 		}
 	}
 
-	// Set active sheet to the first visible sheet
-	for _, sheet := range r.Metadata.Sheets {
-		if sheet.Visible {
-			r.File.SetActiveSheet(sheet.Index)
+	// Set active sheet to WorkbookView.ActiveTab, or else to the first
+	// visible sheet unless FlushPerSheet set it already and it is still active
+	if view := r.Options.WorkbookView; view != nil && view.ActiveTab != nil {
+		if err := r.applyActiveTab(); err != nil {
+			return fmt.Errorf("failed to set active tab: %w", err)
+		}
+	} else if !r.Options.PreserveExistingActiveSheet {
+		for i, sheet := range sheets {
+			sheetName, created := r.sheetNames[positions[i]]
+			if !sheet.Visible || !created {
+				continue
+			}
+			if index, err := r.File.GetSheetIndex(sheetName); err == nil && index != -1 &&
+				(!r.activeSheetSet || index != r.File.GetActiveSheetIndex()) {
+				r.File.SetActiveSheet(index)
+			}
 			break
 		}
 	}
 
+	// Group selected sheets
+	if len(r.Options.SelectedSheets) > 1 {
+		if err := r.recreateSheetGroup(); err != nil {
+			return fmt.Errorf("failed to group sheets: %w", err)
+		}
+	}
+
+	// Embed the source metadata before the checksum, which covers it
+	if r.Options.EmbedSourceMetadata {
+		if err := r.embedSourceMetadata(); err != nil {
+			return fmt.Errorf("failed to embed source metadata: %w", err)
+		}
+	}
+
+	// Append the checksum sheet after all content is written
+	if r.Options.AppendChecksumSheet {
+		if err := r.appendChecksumSheet(); err != nil {
+			return fmt.Errorf("failed to append checksum sheet: %w", err)
+		}
+	}
+
+	// Recreate workbook protection
+	if r.Options.WorkbookProtection != nil {
+		if err := r.File.ProtectWorkbook(r.Options.WorkbookProtection); err != nil {
+			return fmt.Errorf("failed to protect workbook: %w", err)
+		}
+	}
+
+	// Print options, the workbook view, phonetic guides and the checksum
+	// property are applied last, as they reopen the workbook
+	if err := r.applyPartEdits(); err != nil {
+		return fmt.Errorf("failed to apply workbook settings: %w", err)
+	}
+
 	return nil
 }
 
+// sheetsToRecreate returns copies of the sheets accepted by
+// Options.SheetFilter and their positions in Metadata.Sheets. With
+// RenumberSheets or a filter, which can leave gaps such as 0, 2, 5, the copies
+// are ordered by Index and renumbered from 0.
+func (r *Recreator) sheetsToRecreate() ([]excelmetadata.SheetMetadata, []int) {
+	positions := make([]int, 0, len(r.Metadata.Sheets))
+	for i, sheet := range r.Metadata.Sheets {
+		if r.Options.SheetFilter == nil || r.Options.SheetFilter(sheet) {
+			positions = append(positions, i)
+		}
+	}
+
+	renumber := r.Options.RenumberSheets || r.Options.SheetFilter != nil
+	if renumber {
+		sort.SliceStable(positions, func(i, j int) bool {
+			return r.Metadata.Sheets[positions[i]].Index < r.Metadata.Sheets[positions[j]].Index
+		})
+	}
+	sheets := make([]excelmetadata.SheetMetadata, len(positions))
+	for i, position := range positions {
+		sheets[i] = r.Metadata.Sheets[position]
+		if renumber {
+			sheets[i].Index = i
+		}
+	}
+	return sheets, positions
+}
+
 // Save saves the recreated Excel file
 func (r *Recreator) Save(filename string) error {
-	return r.File.SaveAs(filename)
+	if err := r.File.SaveAs(filename); err != nil {
+		return err
+	}
+	if r.Options.VerifyAfterSave {
+		if err := verifyFile(filename); err != nil {
+			return fmt.Errorf("failed to verify %s: %w", filename, err)
+		}
+	}
+	return nil
+}
+
+// EstimateSize returns the size in bytes the recreated file would have when
+// saved, writing it to memory only. Call it after Recreate.
+func (r *Recreator) EstimateSize() (int64, error) {
+	buf, err := r.File.WriteToBuffer()
+	if err != nil {
+		return 0, err
+	}
+	return int64(buf.Len()), nil
+}
+
+// verifyFile reopens a saved file and reads every sheet, which excelize
+// parses lazily
+func verifyFile(filename string) error {
+	f, err := excelize.OpenFile(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, sheetName := range f.GetSheetList() {
+		if _, err := f.GetRows(sheetName); err != nil {
+			return fmt.Errorf("sheet %s: %w", sheetName, err)
+		}
+	}
+	return nil
+}
+
+// Warnings returns the non-fatal issues found during Recreate
+func (r *Recreator) Warnings() []Warning {
+	return r.warnings
 }
 
 // GetFile returns the underlying excelize.File for advanced operations
@@ -124,9 +714,171 @@ func (r *Recreator) GetFile() *excelize.File {
 	return r.File
 }
 
+// DumpStyles returns every style created during Recreate keyed by its new
+// style ID, including styles derived from per-cell settings. Use StyleMap to
+// find the new ID of a metadata style.
+func (r *Recreator) DumpStyles() map[int]excelize.Style {
+	styles := make(map[int]excelize.Style)
+	add := func(styleID int) {
+		if _, exists := styles[styleID]; exists {
+			return
+		}
+		if style, err := r.File.GetStyle(styleID); err == nil && style != nil {
+			styles[styleID] = *style
+		}
+	}
+	for _, styleID := range r.StyleMap {
+		add(styleID)
+	}
+	for _, styleID := range r.derivedStyles.styleIDs() {
+		add(styleID)
+	}
+	return styles
+}
+
+// SetRange writes a rectangular block of values starting at topLeft, using the
+// same value handling as cells from metadata. nil values are skipped.
+func (r *Recreator) SetRange(sheetName, topLeft string, data [][]interface{}) error {
+	col, row, err := excelize.CellNameToCoordinates(topLeft)
+	if err != nil {
+		return err
+	}
+
+	for i, values := range data {
+		for j, value := range values {
+			value = r.cellValue(value)
+			if value == nil {
+				continue
+			}
+			address, err := excelize.CoordinatesToCellName(col+j, row+i)
+			if err != nil {
+				return err
+			}
+			if err := r.setCellValue(sheetName, address, value); err != nil {
+				return fmt.Errorf("sheet %s cell %s: %w", sheetName, address, err)
+			}
+		}
+	}
+	return nil
+}
+
+// AddTitleRow inserts a row above the sheet content holding text merged across
+// the used columns and centered. styleID is a metadata style ID, 0 for none;
+// an ID missing from the style map is an error. Call it after Recreate.
+func (r *Recreator) AddTitleRow(sheetName, text string, styleID int) error {
+	baseStyleID, exists := r.StyleMap[styleID]
+	if styleID != 0 && !exists {
+		return fmt.Errorf("sheet %s title: style %d not found", sheetName, styleID)
+	}
+
+	rows, err := r.File.GetRows(sheetName)
+	if err != nil {
+		return err
+	}
+	cols := 1
+	for _, row := range rows {
+		cols = max(cols, len(row))
+	}
+	mergeCells, err := r.File.GetMergeCells(sheetName)
+	if err != nil {
+		return err
+	}
+	for _, merge := range mergeCells {
+		if col, _, err := excelize.CellNameToCoordinates(merge.GetEndAxis()); err == nil {
+			cols = max(cols, col)
+		}
+	}
+
+	if err := r.File.InsertRows(sheetName, 1, 1); err != nil {
+		return err
+	}
+	if err := r.File.SetCellStr(sheetName, "A1", text); err != nil {
+		return err
+	}
+	endCell, err := excelize.CoordinatesToCellName(cols, 1)
+	if err != nil {
+		return err
+	}
+	if cols > 1 {
+		if err := r.File.MergeCell(sheetName, "A1", endCell); err != nil {
+			return err
+		}
+	}
+
+	titleStyleID, err := r.titleStyle(baseStyleID)
+	if err != nil {
+		return err
+	}
+	return r.File.SetCellStyle(sheetName, "A1", endCell, titleStyleID)
+}
+
+// titleStyle returns a style that copies baseStyleID and centers the text
+func (r *Recreator) titleStyle(baseStyleID int) (int, error) {
+	key := newDerivedStyleKey("title", baseStyleID, nil)
+	return r.derivedStyles.get(key, func() (int, error) {
+		style, err := r.File.GetStyle(baseStyleID)
+		if err != nil {
+			return 0, err
+		}
+		if style.Alignment == nil {
+			style.Alignment = &excelize.Alignment{}
+		}
+		style.Alignment.Horizontal = "center"
+		style.Alignment.Vertical = "center"
+
+		return r.File.NewStyle(style)
+	})
+}
+
+// highlightOperators are the comparisons accepted by AddHighlightRule
+var highlightOperators = map[string]bool{
+	">": true, ">=": true, "<": true, "<=": true, "=": true, "==": true, "!=": true, "<>": true,
+	"greater than": true, "greater than or equal to": true, "less than": true,
+	"less than or equal to": true, "equal to": true, "not equal to": true,
+}
+
+// AddHighlightRule adds a conditional format filling the cells of rangeRef
+// (e.g. "B2:B100") with fillColor ("#RRGGBB") when their value compares to
+// value by operator, such as ">" or "less than". A string value is compared
+// as text. Call it after Recreate.
+func (r *Recreator) AddHighlightRule(sheetName, rangeRef, operator string, value interface{}, fillColor string) error {
+	if !highlightOperators[operator] {
+		return fmt.Errorf("unsupported highlight operator %q", operator)
+	}
+	formatID, err := r.File.NewConditionalStyle(&excelize.Style{
+		Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"#" + normalizeColor(fillColor)}},
+	})
+	if err != nil {
+		return err
+	}
+
+	var criteria string
+	switch v := value.(type) {
+	case string:
+		criteria = `"` + strings.ReplaceAll(v, `"`, `""`) + `"`
+	case bool:
+		criteria = strings.ToUpper(strconv.FormatBool(v))
+	default:
+		criteria = fmt.Sprint(v)
+	}
+	rule := excelize.ConditionalFormatOptions{Type: "cell", Criteria: operator, Value: criteria, Format: &formatID}
+	if err := r.File.SetConditionalFormat(sheetName, rangeRef, []excelize.ConditionalFormatOptions{rule}); err != nil {
+		return fmt.Errorf("highlight rule %s: %w", rangeRef, err)
+	}
+	return nil
+}
+
 // Private recreation methods
 
 func (r *Recreator) recreateDocumentProperties() error {
+	if r.Options.StripDocumentProperties {
+		// Empty properties replace the defaults excelize writes
+		if err := r.File.SetDocProps(&excelize.DocProperties{}); err != nil {
+			return err
+		}
+		return r.recreateAppProperties()
+	}
+
 	props := &excelize.DocProperties{
 		Title:          r.Metadata.Properties.Title,
 		Subject:        r.Metadata.Properties.Subject,
@@ -140,207 +892,1984 @@ func (r *Recreator) recreateDocumentProperties() error {
 		Modified:       r.Metadata.Properties.Modified,
 	}
 
-	return r.File.SetDocProps(props)
+	if err := r.File.SetDocProps(props); err != nil {
+		return err
+	}
+
+	return r.recreateAppProperties()
+}
+
+func (r *Recreator) recreateAppProperties() error {
+	if r.Options.AppProps != nil {
+		if err := r.File.SetAppProps(r.Options.AppProps); err != nil {
+			return fmt.Errorf("failed to set app properties: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *Recreator) recreateDefaultFont() error {
+	defaultFont := DefaultFont{}
+	if r.Options.DefaultFont != nil {
+		defaultFont = *r.Options.DefaultFont
+	}
+
+	if defaultFont.Family != "" {
+		if err := r.File.SetDefaultFont(defaultFont.Family); err != nil {
+			return err
+		}
+	}
+
+	if defaultFont.Size <= 0 && r.Options.FontScale <= 0 {
+		return nil
+	}
+
+	// excelize has no setter for the default font size, so update the first
+	// font of the loaded stylesheet directly
+	if _, err := r.File.GetDefaultFont(); err != nil {
+		return err
+	}
+	if r.File.Styles == nil || r.File.Styles.Fonts == nil || len(r.File.Styles.Fonts.Font) == 0 ||
+		r.File.Styles.Fonts.Font[0].Sz == nil || r.File.Styles.Fonts.Font[0].Sz.Val == nil {
+		return fmt.Errorf("default font not found")
+	}
+	size := defaultFont.Size
+	if size <= 0 {
+		size = *r.File.Styles.Fonts.Font[0].Sz.Val
+	}
+	size = r.scaleFontSize(size)
+	r.File.Styles.Fonts.Font[0].Sz.Val = &size
+
+	return nil
+}
+
+// scaleFontSize applies Options.FontScale to a font size
+func (r *Recreator) scaleFontSize(size float64) float64 {
+	if r.Options.FontScale > 0 {
+		return size * r.Options.FontScale
+	}
+	return size
+}
+
+func (r *Recreator) recreateStyles() error {
+	created := make(map[string]int) // Maps style keys to new style IDs when deduplicating
+	familyless := 0                 // Counts fonts without a family, warned about once
+	for oldID, styleMeta := range r.Metadata.Styles {
+		styleMeta, err := r.resolveStyle(oldID, styleMeta, nil)
+		if err != nil {
+			return err
+		}
+
+		var key string
+		if r.Options.DeduplicateStyles {
+			key = styleKey(styleMeta)
+			if newID, exists := created[key]; exists {
+				r.StyleMap[oldID] = newID
+				continue
+			}
+		}
+
+		style := &excelize.Style{}
+
+		// Recreate font. Neither FontStyle nor excelize.Font carries a font
+		// scheme, so an empty Family is passed through and excelize resolves
+		// it to the workbook default font instead of a hardcoded family.
+		if styleMeta.Font != nil {
+			if styleMeta.Font.Family == "" {
+				familyless++
+			}
+			style.Font = &excelize.Font{
+				Bold:      styleMeta.Font.Bold,
+				Italic:    styleMeta.Font.Italic,
+				Underline: styleMeta.Font.Underline,
+				Strike:    styleMeta.Font.Strike,
+				Family:    styleMeta.Font.Family,
+				Size:      r.scaleFontSize(styleMeta.Font.Size),
+				Color:     normalizeColor(styleMeta.Font.Color),
+			}
+		}
+
+		// Recreate fill. Pattern fills may have no colors (e.g. gray125), and
+		// excelize writes only the first color as the pattern foreground; a
+		// second color is added as the background once the style exists.
+		if styleMeta.Fill != nil && (len(styleMeta.Fill.Color) > 0 || styleMeta.Fill.Type == "pattern") {
+			style.Fill = excelize.Fill{
+				Type:    styleMeta.Fill.Type,
+				Pattern: styleMeta.Fill.Pattern,
+			}
+			for _, color := range styleMeta.Fill.Color {
+				style.Fill.Color = append(style.Fill.Color, normalizeColor(color))
+			}
+		}
+
+		// Recreate borders
+		if len(styleMeta.Border) > 0 {
+			style.Border = []excelize.Border{}
+			for _, borderMeta := range styleMeta.Border {
+				style.Border = append(style.Border, excelize.Border{
+					Type:  borderMeta.Type,
+					Color: normalizeColor(borderMeta.Color),
+					Style: borderMeta.Style,
+				})
+			}
+		}
+
+		// Recreate alignment
+		if styleMeta.Alignment != nil {
+			style.Alignment = &excelize.Alignment{
+				Horizontal:   styleMeta.Alignment.Horizontal,
+				Vertical:     styleMeta.Alignment.Vertical,
+				WrapText:     styleMeta.Alignment.WrapText,
+				TextRotation: styleMeta.Alignment.TextRotation,
+				Indent:       styleMeta.Alignment.Indent,
+				ShrinkToFit:  styleMeta.Alignment.ShrinkToFit,
+			}
+		}
+
+		// Recreate number format
+		if styleMeta.NumberFormat != 0 {
+			style.NumFmt = styleMeta.NumberFormat
+		}
+
+		// Recreate protection
+		if styleMeta.Protection != nil {
+			style.Protection = &excelize.Protection{
+				Hidden: styleMeta.Protection.Hidden,
+				Locked: styleMeta.Protection.Locked,
+			}
+		}
+
+		// Create the style and map old ID to new ID
+		newID, err := r.File.NewStyle(style)
+		if err == nil && style.Fill.Type == "pattern" && len(style.Fill.Color) > 1 && style.Fill.Color[1] != "" {
+			if newID, err = r.appendCellXf(newID, cellXfOptions{BgColor: style.Fill.Color[1]}); err != nil {
+				return fmt.Errorf("style %d background color: %w", oldID, err)
+			}
+		}
+		if err == nil {
+			r.StyleMap[oldID] = newID
+			if r.Options.DeduplicateStyles {
+				created[key] = newID
+			}
+		}
+	}
+	if familyless > 0 {
+		r.warn("", "", WarningFontScheme, fmt.Sprintf("%d styles have a font without a family and use the workbook default font", familyless))
+	}
+
+	return nil
+}
+
+// resolveStyle merges a style over the chain of base styles in
+// Options.BaseStyles. seen holds the style IDs already on the chain.
+func (r *Recreator) resolveStyle(id int, style excelmetadata.StyleDetails, seen map[int]bool) (excelmetadata.StyleDetails, error) {
+	baseID, exists := r.Options.BaseStyles[id]
+	if !exists {
+		return style, nil
+	}
+	if seen == nil {
+		seen = make(map[int]bool)
+	}
+	seen[id] = true
+	if seen[baseID] {
+		return style, fmt.Errorf("style %d: circular base style %d", id, baseID)
+	}
+	baseMeta, exists := r.Metadata.Styles[baseID]
+	if !exists {
+		return style, fmt.Errorf("style %d: base style %d not found", id, baseID)
+	}
+	base, err := r.resolveStyle(baseID, baseMeta, seen)
+	if err != nil {
+		return style, err
+	}
+
+	if style.Font == nil {
+		style.Font = base.Font
+	}
+	if style.Fill == nil {
+		style.Fill = base.Fill
+	}
+	if len(style.Border) == 0 {
+		style.Border = base.Border
+	}
+	if style.Alignment == nil {
+		style.Alignment = base.Alignment
+	}
+	if style.NumberFormat == 0 {
+		style.NumberFormat = base.NumberFormat
+	}
+	if style.Protection == nil {
+		style.Protection = base.Protection
+	}
+	return style, nil
+}
+
+// styleKey returns a key identifying structurally identical styles
+func styleKey(styleMeta excelmetadata.StyleDetails) string {
+	data, err := json.Marshal(styleMeta)
+	if err != nil {
+		return fmt.Sprintf("%#v", styleMeta)
+	}
+	return string(data)
+}
+
+// recreateSheet creates a sheet and its content. It returns the name the sheet
+// was created under, which differs from the metadata name when the name was
+// sanitized or made unique, or "" when the sheet was not created.
+func (r *Recreator) recreateSheet(ctx context.Context, sheetMeta excelmetadata.SheetMetadata) (string, error) {
+	sheetName := r.sheetName(sheetMeta)
+	if sheetMeta.Name != "" && sheetName != sheetMeta.Name {
+		r.warn(sheetName, "", WarningSheetSanitized, fmt.Sprintf("invalid sheet name %q renamed to %s", sheetMeta.Name, sheetName))
+	}
+
+	// excelize reuses an existing sheet with the same name, so a duplicate
+	// name would merge two sheets
+	if uniqueName := uniqueSheetName(sheetName, r.createdSheetName); uniqueName != sheetName {
+		r.warn(sheetName, "", WarningSheetRenamed, fmt.Sprintf("duplicate sheet name renamed to %s", uniqueName))
+		sheetName = uniqueName
+	}
+
+	// Create sheet
+	if _, err := r.File.NewSheet(sheetName); err != nil {
+		return "", err
+	}
+	r.createdSheets[sheetName] = true
+
+	return sheetName, r.recreateSheetContent(ctx, sheetName, sheetMeta)
+}
+
+// removeSheet deletes a sheet that failed part way. A workbook keeps at least
+// one sheet, so the default sheet is added back when it would be the last.
+func (r *Recreator) removeSheet(sheetName string) error {
+	delete(r.createdSheets, sheetName)
+	if r.File.SheetCount == 1 {
+		if _, err := r.File.NewSheet(defaultSheetName); err != nil {
+			return err
+		}
+	}
+	return r.File.DeleteSheet(sheetName)
+}
+
+func (r *Recreator) recreateSheetContent(ctx context.Context, sheetName string, sheetMeta excelmetadata.SheetMetadata) error {
+	// Set visibility
+	r.File.SetSheetVisible(sheetName, sheetMeta.Visible)
+
+	// Set the tab color for the sheet's category, or the default tab color
+	color := r.Options.DefaultTabColor
+	if r.Options.TabColorByCategory != nil {
+		if categoryColor := r.Options.TabColorByCategory(sheetMeta); categoryColor != "" {
+			color = categoryColor
+		}
+	}
+	if color != "" {
+		tabColor := "FF" + normalizeColor(color)
+		if err := r.File.SetSheetProps(sheetName, &excelize.SheetPropsOptions{TabColorRGB: &tabColor}); err != nil {
+			return err
+		}
+	}
+
+	// Set column widths, keyed by a column ("B") or a column range ("B:D")
+	var capped int
+	for cols, width := range sheetMeta.ColWidths {
+		startCol, endCol, _ := strings.Cut(cols, ":")
+		if endCol == "" {
+			endCol = startCol
+		}
+		var within bool
+		if endCol, within = r.Options.capCols(startCol, endCol); !within {
+			capped++
+			continue
+		}
+		r.File.SetColWidth(sheetName, startCol, endCol, width)
+	}
+	r.warnCapped(sheetName, capped, "column widths")
+
+	// Group columns and place the outline summaries. A StreamWriter writes
+	// column widths and styles only.
+	sheetOpts := r.sheetOptions(sheetName)
+	if r.Options.FlushPerSheet && len(sheetOpts.ColOutlineLevels) > 0 {
+		return fmt.Errorf("column outline levels cannot be written with FlushPerSheet")
+	}
+	capped = 0
+	for col, level := range sheetOpts.ColOutlineLevels {
+		if _, within := r.Options.capCols(col, col); !within {
+			capped++
+			continue
+		}
+		if err := r.File.SetColOutlineLevel(sheetName, col, level); err != nil {
+			return fmt.Errorf("column %s outline level: %w", col, err)
+		}
+	}
+	r.warnCapped(sheetName, capped, "column outline levels")
+	if sheetOpts.OutlineSummaryBelow != nil || sheetOpts.OutlineSummaryRight != nil {
+		if err := r.File.SetSheetProps(sheetName, &excelize.SheetPropsOptions{
+			OutlineSummaryBelow: sheetOpts.OutlineSummaryBelow,
+			OutlineSummaryRight: sheetOpts.OutlineSummaryRight,
+		}); err != nil {
+			return err
+		}
+	}
+
+	// Buffer the rows, cells and merges of a sheet flushed per sheet. The
+	// default sheet is deleted first, as deleting a sheet reads every other
+	// sheet back into memory.
+	if r.Options.FlushPerSheet {
+		r.deleteDefaultSheet()
+		r.buffer = newSheetBuffer(r.File)
+		defer func() { r.buffer = nil }()
+	}
+
+	// Set row heights
+	capped = 0
+	for row, height := range sheetMeta.RowHeights {
+		if !r.Options.withinCap(1, row) {
+			capped++
+			continue
+		}
+		r.writer().SetRowHeight(sheetName, row, height)
+	}
+	r.warnCapped(sheetName, capped, "row heights")
+
+	// Group rows
+	capped = 0
+	for row, level := range sheetOpts.RowOutlineLevels {
+		if !r.Options.withinCap(1, row) {
+			capped++
+			continue
+		}
+		if err := r.writer().SetRowOutlineLevel(sheetName, row, level); err != nil {
+			return fmt.Errorf("row %d outline level: %w", row, err)
+		}
+	}
+	r.warnCapped(sheetName, capped, "row outline levels")
+
+	// Set row styles before cells, so cell styles take precedence
+	if r.Options.PreserveStyles {
+		capped = 0
+		for row, styleID := range r.sheetOptions(sheetName).RowStyles {
+			if !r.Options.withinCap(1, row) {
+				capped++
+				continue
+			}
+			if newStyleID, exists := r.StyleMap[styleID]; exists {
+				r.writer().SetRowStyle(sheetName, row, row, newStyleID)
+			}
+		}
+		r.warnCapped(sheetName, capped, "row styles")
+	}
+
+	// Recreate cells, only the header rows for a structure-only template
+	cells := sheetMeta.Cells
+	if r.Options.StructureOnly {
+		cells = headerCells(cells, r.Options.HeaderRows)
+	}
+	if r.Options.capped() {
+		cells, capped = r.Options.capCells(cells)
+		r.warnCapped(sheetName, capped, "cells")
+	}
+	if r.Options.CellWriteOrder != CellWriteAsIs {
+		cells = sortCells(cells, r.Options.CellWriteOrder)
+	}
+	if lastRow := sparseLastRow(cells); r.buffer == nil && lastRow > 0 {
+		r.warn(sheetName, "", WarningSparseSheet, fmt.Sprintf("%d cells reach row %d, and every row up to it is held in memory; FlushPerSheet writes only the populated rows", len(cells), lastRow))
+	}
+	if err := r.recreateCells(ctx, sheetName, cells); err != nil {
+		return err
+	}
+
+	// Recreate comments
+	if err := r.recreateComments(sheetName); err != nil {
+		return err
+	}
+
+	// Recreate merged cells, followed by merges of repeated values, which
+	// lose to metadata merges under the conflict policy
+	merges := sheetMeta.MergedCells
+	if r.Options.AutoMergeRepeats {
+		merges = append(append([]excelmetadata.MergedCell{}, merges...), r.repeatMerges(cells)...)
+	}
+	if r.Options.capped() {
+		merges, capped = r.Options.capMerges(merges)
+		r.warnCapped(sheetName, capped, "merges")
+	}
+	var filled map[string]bool
+	if r.Options.ClearCoveredCells {
+		filled = filledCells(cells)
+	}
+	for _, merge := range resolveMergeConflicts(merges, r.Options.MergeConflictPolicy) {
+		// Covered cells are cleared first, as excelize redirects writes to
+		// cells under a merge to its top-left cell
+		if r.Options.ClearCoveredCells {
+			if err := r.clearCoveredCells(sheetName, merge, filled); err != nil {
+				return fmt.Errorf("failed to clear cells under merge %s:%s: %w", merge.StartCell, merge.EndCell, err)
+			}
+		}
+		r.writer().MergeCell(sheetName, merge.StartCell, merge.EndCell)
+		if err := r.extendMergeBorders(sheetName, merge); err != nil {
+			return fmt.Errorf("failed to set borders of merge %s:%s: %w", merge.StartCell, merge.EndCell, err)
+		}
+	}
+
+	// Declare the used range of the capped cells, so the dimension ends
+	// within the caps
+	if r.Options.capped() {
+		if ref := usedRange(cells, merges); ref != "" {
+			if err := r.File.SetSheetDimension(sheetName, ref); err != nil {
+				return fmt.Errorf("failed to set dimension %s: %w", ref, err)
+			}
+		}
+	}
+
+	// Recreate conditional formats
+	if err := r.recreateConditionalFormats(sheetName); err != nil {
+		return err
+	}
+
+	// Recreate tables, which read their column names from the written cells
+	for i := range r.sheetOptions(sheetName).Tables {
+		if r.buffer != nil {
+			return fmt.Errorf("tables cannot be written with FlushPerSheet")
+		}
+		table := r.sheetOptions(sheetName).Tables[i]
+		if err := r.File.AddTable(sheetName, &table); err != nil {
+			return fmt.Errorf("table %s: %w", table.Range, err)
+		}
+	}
+
+	// Recreate data validations
+	if r.Options.PreserveDataValidation {
+		capped = 0
+		for _, dv := range sheetMeta.DataValidations {
+			sqref, cut := r.Options.capSqref(dv.Range)
+			if cut {
+				capped++
+			}
+			if sqref == "" {
+				continue
+			}
+			dv.Range = sqref
+			if err := r.recreateDataValidation(sheetName, dv); err != nil {
+				r.warn(sheetName, "", WarningValidationFailed, fmt.Sprintf("data validation %s: %v", dv.Range, err))
+			}
+		}
+		r.warnCapped(sheetName, capped, "data validation ranges")
+		if err := r.recreateCellValidations(sheetName); err != nil {
+			return err
+		}
+	}
+
+	// Recreate images
+	if r.Options.PreserveImages {
+		for _, img := range sheetMeta.Images {
+			if err := r.recreateImage(sheetName, &img); err != nil {
+				r.warn(sheetName, img.Cell, WarningImageFailed, err.Error())
+			}
+		}
+	}
+
+	// Set frozen or split panes and the active cell
+	if panes := r.sheetOptions(sheetName).panes(); panes != nil {
+		if err := r.File.SetPanes(sheetName, panes); err != nil {
+			return err
+		}
+	}
+
+	// Set right-to-left display, which keeps any frozen panes
+	if r.Options.PreserveRTL && r.sheetOptions(sheetName).RightToLeft {
+		rightToLeft := true
+		if err := r.File.SetSheetView(sheetName, 0, &excelize.ViewOptions{RightToLeft: &rightToLeft}); err != nil {
+			return err
+		}
+	}
+
+	// Recreate sheet protection
+	if sheetMeta.Protection != nil && sheetMeta.Protection.Protected {
+		if err := r.recreateSheetProtection(sheetName, sheetMeta.Protection); err != nil {
+			return fmt.Errorf("failed to protect sheet: %w", err)
+		}
+	}
+
+	// Write the buffered rows last, as the StreamWriter keeps only the sheet
+	// settings made before it
+	if r.buffer != nil {
+		// SetActiveSheet reads every sheet back into memory, so the first
+		// visible sheet is made active before it and later sheets are flushed
+		if sheetMeta.Visible && !r.activeSheetSet && !r.Options.PreserveExistingActiveSheet {
+			if index, err := r.File.GetSheetIndex(sheetName); err == nil && index != -1 {
+				r.File.SetActiveSheet(index)
+			}
+			r.activeSheetSet = true
+		}
+		if err := r.buffer.flush(sheetName); err != nil {
+			return fmt.Errorf("failed to flush sheet: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// headerCells returns the cells in the first headerRows rows, or the first row
+// when headerRows is 0
+func headerCells(cells []excelmetadata.CellMetadata, headerRows int) []excelmetadata.CellMetadata {
+	if headerRows <= 0 {
+		headerRows = 1
+	}
+	var result []excelmetadata.CellMetadata
+	for _, cell := range cells {
+		if _, row, err := excelize.CellNameToCoordinates(cell.Address); err == nil && row <= headerRows {
+			result = append(result, cell)
+		}
+	}
+	return result
+}
+
+// capped reports whether MaxRows or MaxCols is set
+func (o *Options) capped() bool {
+	return o.MaxRows > 0 || o.MaxCols > 0
+}
+
+// withinCap reports whether a cell is within MaxRows and MaxCols
+func (o *Options) withinCap(col, row int) bool {
+	return (o.MaxRows <= 0 || row <= o.MaxRows) && (o.MaxCols <= 0 || col <= o.MaxCols)
+}
+
+// cellWithinCap reports whether a cell address is within MaxRows and
+// MaxCols. Invalid addresses are within, to fail where they are used.
+func (o *Options) cellWithinCap(address string) bool {
+	col, row, err := uncheckedCoordinates(address)
+	return err != nil || o.withinCap(col, row)
+}
+
+// warnCapped reports the number of items of a sheet skipped or cut by
+// MaxRows and MaxCols
+func (r *Recreator) warnCapped(sheetName string, count int, items string) {
+	if count > 0 {
+		r.warn(sheetName, "", WarningCapped, fmt.Sprintf("%d %s beyond the row or column cap skipped or cut", count, items))
+	}
+}
+
+// capCols returns the last column of the column range startCol:endCol within
+// MaxCols, and false if the range starts beyond it. Invalid names are kept.
+func (o *Options) capCols(startCol, endCol string) (string, bool) {
+	start, err1 := excelize.ColumnNameToNumber(startCol)
+	end, err2 := excelize.ColumnNameToNumber(endCol)
+	if o.MaxCols <= 0 || err1 != nil || err2 != nil || max(start, end) <= o.MaxCols {
+		return endCol, true
+	}
+	if min(start, end) > o.MaxCols {
+		return "", false
+	}
+	name, _ := excelize.ColumnNumberToName(o.MaxCols)
+	return name, true
+}
+
+// capSqref cuts the ranges of a range list to MaxRows and MaxCols, dropping
+// ranges that start beyond them, and reports whether any range was cut or
+// dropped. It returns "" when every range was dropped. Invalid ranges are
+// kept.
+func (o *Options) capSqref(sqref string) (string, bool) {
+	refs := strings.FieldsFunc(sqref, func(r rune) bool {
+		return r == ' ' || r == ',' || r == '\t' || r == '\n'
+	})
+	var result []string
+	var cut bool
+	for _, ref := range refs {
+		coords, err := uncheckedRangeCoordinates(ref)
+		if err != nil || o.withinCap(coords[2], coords[3]) {
+			result = append(result, ref)
+			continue
+		}
+		cut = true
+		if !o.withinCap(coords[0], coords[1]) {
+			continue
+		}
+		if o.MaxCols > 0 {
+			coords[2] = min(coords[2], o.MaxCols)
+		}
+		if o.MaxRows > 0 {
+			coords[3] = min(coords[3], o.MaxRows)
+		}
+		start, _ := excelize.CoordinatesToCellName(coords[0], coords[1])
+		end, _ := excelize.CoordinatesToCellName(coords[2], coords[3])
+		result = append(result, start+":"+end)
+	}
+	if !cut {
+		return sqref, false
+	}
+	return strings.Join(result, " "), true
+}
+
+// uncheckedRangeCoordinates returns the coordinates of a range like
+// rangeCoordinates, but accepts numbers beyond Excel's limits
+func uncheckedRangeCoordinates(rangeRef string) ([]int, error) {
+	start, end, isRange := strings.Cut(strings.ReplaceAll(rangeRef, "$", ""), ":")
+	if !isRange {
+		end = start
+	}
+	col1, row1, err := uncheckedCoordinates(start)
+	if err != nil {
+		return nil, err
+	}
+	col2, row2, err := uncheckedCoordinates(end)
+	if err != nil {
+		return nil, err
+	}
+	return []int{min(col1, col2), min(row1, row2), max(col1, col2), max(row1, row2)}, nil
+}
+
+// usedRange returns the range spanning the cells and merges, or "" when
+// none has a valid address
+func usedRange(cells []excelmetadata.CellMetadata, merges []excelmetadata.MergedCell) string {
+	minCol, minRow, maxCol, maxRow := excelize.MaxColumns, excelize.TotalRows, 0, 0
+	extend := func(address string) {
+		if col, row, err := excelize.CellNameToCoordinates(address); err == nil {
+			minCol, minRow, maxCol, maxRow = min(minCol, col), min(minRow, row), max(maxCol, col), max(maxRow, row)
+		}
+	}
+	for _, cell := range cells {
+		extend(cell.Address)
+	}
+	for _, merge := range merges {
+		extend(merge.StartCell)
+		extend(merge.EndCell)
+	}
+	if maxCol == 0 {
+		return ""
+	}
+	start, _ := excelize.CoordinatesToCellName(minCol, minRow)
+	end, _ := excelize.CoordinatesToCellName(maxCol, maxRow)
+	return start + ":" + end
+}
+
+// Sheets are sparse when their last row is at least sparseSheetMinRows and
+// they have fewer than one cell per sparseSheetRowsPerCell rows
+const (
+	sparseSheetMinRows     = 100000
+	sparseSheetRowsPerCell = 100
+)
+
+// sparseLastRow returns the last row of sparse cells, or 0 when the cells are
+// not sparse. excelize keeps a row in memory and in the file for every row up
+// to the last written one, whereas a StreamWriter writes the populated rows only.
+func sparseLastRow(cells []excelmetadata.CellMetadata) int {
+	lastRow := 0
+	for _, cell := range cells {
+		if _, row, err := excelize.CellNameToCoordinates(cell.Address); err == nil && row > lastRow {
+			lastRow = row
+		}
+	}
+	if lastRow < sparseSheetMinRows || len(cells) >= lastRow/sparseSheetRowsPerCell {
+		return 0
+	}
+	return lastRow
+}
+
+// capCells returns the cells within MaxRows and MaxCols and the number of
+// cells skipped. Cells with invalid addresses are kept.
+func (o *Options) capCells(cells []excelmetadata.CellMetadata) ([]excelmetadata.CellMetadata, int) {
+	result := make([]excelmetadata.CellMetadata, 0, len(cells))
+	for _, cell := range cells {
+		if o.cellWithinCap(cell.Address) {
+			result = append(result, cell)
+		}
+	}
+	return result, len(cells) - len(result)
+}
+
+// capMerges returns the merges within MaxRows and MaxCols and the number of
+// merges skipped. Merges with invalid addresses are kept.
+func (o *Options) capMerges(merges []excelmetadata.MergedCell) ([]excelmetadata.MergedCell, int) {
+	result := make([]excelmetadata.MergedCell, 0, len(merges))
+	for _, merge := range merges {
+		startCol, startRow, err1 := uncheckedCoordinates(merge.StartCell)
+		endCol, endRow, err2 := uncheckedCoordinates(merge.EndCell)
+		if err1 == nil && err2 == nil && !o.withinCap(max(startCol, endCol), max(startRow, endRow)) {
+			continue
+		}
+		result = append(result, merge)
+	}
+	return result, len(merges) - len(result)
+}
+
+// uncheckedCoordinates converts a cell address to column and row numbers
+// like excelize.CellNameToCoordinates, but accepts numbers beyond Excel's
+// limits
+func uncheckedCoordinates(address string) (int, int, error) {
+	colName, row, err := excelize.SplitCellName(address)
+	if err != nil {
+		return 0, 0, err
+	}
+	col := 0
+	for _, c := range strings.ToUpper(colName) {
+		col = min(col*26+int(c-'A')+1, math.MaxInt32)
+	}
+	return col, row, nil
+}
+
+// sortCells returns a copy of cells sorted in the given order. Cells with
+// invalid addresses keep their order after the others.
+func sortCells(cells []excelmetadata.CellMetadata, order CellWriteOrder) []excelmetadata.CellMetadata {
+	type position struct {
+		cell     excelmetadata.CellMetadata
+		col, row int
+		valid    bool
+	}
+	positions := make([]position, len(cells))
+	for i, cell := range cells {
+		col, row, err := excelize.CellNameToCoordinates(cell.Address)
+		positions[i] = position{cell: cell, col: col, row: row, valid: err == nil}
+	}
+
+	sort.SliceStable(positions, func(i, j int) bool {
+		a, b := positions[i], positions[j]
+		if !a.valid || !b.valid {
+			return a.valid && !b.valid
+		}
+		if order == CellWriteColMajor {
+			return a.col < b.col || (a.col == b.col && a.row < b.row)
+		}
+		return a.row < b.row || (a.row == b.row && a.col < b.col)
+	})
+
+	result := make([]excelmetadata.CellMetadata, len(positions))
+	for i, p := range positions {
+		result[i] = p.cell
+	}
+	return result
+}
+
+// sheetName returns the sheet name, or a default name for unnamed sheets
+func (r *Recreator) sheetName(sheetMeta excelmetadata.SheetMetadata) string {
+	if name := sanitizeSheetName(sheetMeta.Name); name != "" {
+		return name
+	}
+	return r.Options.unnamedSheetName(sheetMeta.Index)
+}
+
+// sanitizeSheetName makes a name valid for Excel, replacing the characters
+// :\/?*[] with "_", dropping leading and trailing apostrophes and cutting it
+// to MaxSheetNameLength characters
+func sanitizeSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`:\/?*[]`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, "'")
+	if runes := []rune(name); len(runes) > excelize.MaxSheetNameLength {
+		name = strings.TrimRight(string(runes[:excelize.MaxSheetNameLength]), "'")
+	}
+	return name
+}
+
+// unnamedSheetName returns the name of an unnamed sheet from its 0-based index
+func (o *Options) unnamedSheetName(index int) string {
+	if o.SheetNameTemplate != "" {
+		return fmt.Sprintf(o.SheetNameTemplate, index+1)
+	}
+	prefix := o.DefaultSheetName
+	if prefix == "" {
+		prefix = unnamedSheetPrefix
+	}
+	return fmt.Sprintf("%s%d", prefix, index+1)
+}
+
+// validateSheetNameTemplate checks that a template numbers sheets with valid
+// names
+func validateSheetNameTemplate(template string) error {
+	first, second := fmt.Sprintf(template, 1), fmt.Sprintf(template, 2)
+	switch {
+	case strings.Contains(first, "%!"):
+		return fmt.Errorf("sheet name template %q must format one integer", template)
+	case first == second:
+		return fmt.Errorf("sheet name template %q does not number sheets", template)
+	case strings.ContainsAny(first, `:\/?*[]`):
+		return fmt.Errorf("sheet name template %q: %w", template, excelize.ErrSheetNameInvalid)
+	case utf8.RuneCountInString(first) > excelize.MaxSheetNameLength:
+		return fmt.Errorf("sheet name template %q: %w", template, excelize.ErrSheetNameLength)
+	}
+	return nil
+}
+
+// uniqueSheetName returns name, or name with a " (n)" suffix when taken
+// reports that a sheet already has that name
+func uniqueSheetName(name string, taken func(name string) bool) string {
+	if !taken(name) {
+		return name
+	}
+	for n := 2; ; n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		// Sheet names are limited to 31 characters
+		base := []rune(name)
+		if len(base)+len(suffix) > 31 {
+			base = base[:31-len(suffix)]
+		}
+		if candidate := string(base) + suffix; !taken(candidate) {
+			return candidate
+		}
+	}
+}
+
+// createdSheetName reports whether a sheet with name was already created.
+// Names are compared case-insensitively.
+func (r *Recreator) createdSheetName(name string) bool {
+	for created := range r.createdSheets {
+		if strings.EqualFold(created, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Recreator) warn(sheetName, address, code, message string) {
+	r.warnings = append(r.warnings, Warning{SheetName: sheetName, Address: address, Code: code, Message: message})
+}
+
+// sheetOptions returns the per-sheet settings for a sheet, or empty settings
+func (r *Recreator) sheetOptions(sheetName string) *SheetOptions {
+	if opts, exists := r.Options.Sheets[sheetName]; exists && opts != nil {
+		return opts
+	}
+	return &SheetOptions{}
+}
+
+// panes returns the panes to set, with the active cell selected in the
+// active pane, or nil when neither is configured
+func (o *SheetOptions) panes() *excelize.Panes {
+	if o.ActiveCell == "" {
+		return o.Panes
+	}
+	panes := excelize.Panes{}
+	if o.Panes != nil {
+		panes = *o.Panes
+	}
+	panes.Selection = []excelize.Selection{{
+		SQRef:      o.ActiveCell,
+		ActiveCell: o.ActiveCell,
+		Pane:       panes.ActivePane,
+	}}
+	return &panes
+}
+
+// cellOptions returns the settings for a cell, or empty settings
+func (o *SheetOptions) cellOptions(address string) *CellOptions {
+	if opts, exists := o.Cells[address]; exists && opts != nil {
+		return opts
+	}
+	return &CellOptions{}
+}
+
+// spillRanges returns the coordinates of the spill ranges in the sheet
+func (o *SheetOptions) spillRanges() [][]int {
+	var spills [][]int
+	for _, opts := range o.Cells {
+		if opts == nil || opts.SpillRange == "" {
+			continue
+		}
+		if coordinates, err := rangeCoordinates(opts.SpillRange); err == nil {
+			spills = append(spills, coordinates)
+		}
+	}
+	return spills
+}
+
+// normalizeSqref converts a list of ranges separated by spaces or commas, such
+// as "A1:A5 C1:C5", to the single-space separated form of the sqref attribute
+func normalizeSqref(sqref string) (string, error) {
+	refs := strings.FieldsFunc(sqref, func(r rune) bool {
+		return r == ' ' || r == ',' || r == '\t' || r == '\n'
+	})
+	if len(refs) == 0 {
+		return "", fmt.Errorf("empty range")
+	}
+	for _, ref := range refs {
+		if _, err := rangeCoordinates(ref); err != nil {
+			return "", fmt.Errorf("invalid range %s: %w", ref, err)
+		}
+	}
+	return strings.Join(refs, " "), nil
+}
+
+// repeatMerges returns a merge for each run of vertically adjacent cells with
+// the same value in the AutoMergeColumns, or in every column when none are
+// listed. Empty and formula cells end a run.
+func (r *Recreator) repeatMerges(cells []excelmetadata.CellMetadata) []excelmetadata.MergedCell {
+	type entry struct {
+		row   int
+		value string
+	}
+	columns := make(map[int][]entry)
+	for _, cell := range cells {
+		value := r.cellValue(cell.Value)
+		if value == nil || cell.Formula != "" {
+			continue
+		}
+		col, row, err := excelize.CellNameToCoordinates(cell.Address)
+		if err != nil {
+			continue
+		}
+		if len(r.Options.AutoMergeColumns) > 0 {
+			name, _ := excelize.ColumnNumberToName(col)
+			allowed := false
+			for _, allowedCol := range r.Options.AutoMergeColumns {
+				if strings.EqualFold(allowedCol, name) {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				continue
+			}
+		}
+		columns[col] = append(columns[col], entry{row: row, value: fmt.Sprint(value)})
+	}
+
+	cols := make([]int, 0, len(columns))
+	for col := range columns {
+		cols = append(cols, col)
+	}
+	sort.Ints(cols)
+
+	var merges []excelmetadata.MergedCell
+	for _, col := range cols {
+		entries := columns[col]
+		sort.Slice(entries, func(i, j int) bool { return entries[i].row < entries[j].row })
+		for start := 0; start < len(entries); {
+			end := start
+			for end+1 < len(entries) && entries[end+1].row == entries[end].row+1 && entries[end+1].value == entries[start].value {
+				end++
+			}
+			if end > start {
+				startCell, _ := excelize.CoordinatesToCellName(col, entries[start].row)
+				endCell, _ := excelize.CoordinatesToCellName(col, entries[end].row)
+				merges = append(merges, excelmetadata.MergedCell{StartCell: startCell, EndCell: endCell, Value: entries[start].value})
+			}
+			start = end + 1
+		}
+	}
+	return merges
+}
+
+// resolveMergeConflicts removes overlapping merged cells according to policy,
+// keeping the remaining merges in their original order
+func resolveMergeConflicts(merges []excelmetadata.MergedCell, policy MergeConflictPolicy) []excelmetadata.MergedCell {
+	if policy == "" || len(merges) < 2 {
+		return merges
+	}
+
+	coordinates := make([][]int, len(merges))
+	for i, merge := range merges {
+		coordinates[i], _ = rangeCoordinates(merge.StartCell + ":" + merge.EndCell)
+	}
+
+	// Decide the order in which merges claim their cells
+	order := make([]int, len(merges))
+	for i := range order {
+		order[i] = i
+	}
+	if policy == MergeConflictKeepLargest {
+		sort.SliceStable(order, func(a, b int) bool {
+			return rangeArea(coordinates[order[a]]) > rangeArea(coordinates[order[b]])
+		})
+	}
+
+	keep := make([]bool, len(merges))
+	for _, i := range order {
+		keep[i] = true
+		for j := range merges {
+			if i == j || !rangesOverlap(coordinates[i], coordinates[j]) {
+				continue
+			}
+			if policy == MergeConflictSkip || keep[j] {
+				keep[i] = false
+				break
+			}
+		}
+	}
+
+	var resolved []excelmetadata.MergedCell
+	for i, merge := range merges {
+		if keep[i] {
+			resolved = append(resolved, merge)
+		}
+	}
+	return resolved
+}
+
+// rangesOverlap reports whether two range coordinates share a cell
+func rangesOverlap(a, b []int) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	return a[0] <= b[2] && b[0] <= a[2] && a[1] <= b[3] && b[1] <= a[3]
+}
+
+// rangeArea returns the number of cells in range coordinates
+func rangeArea(c []int) int {
+	if c == nil {
+		return 0
+	}
+	return (c[2] - c[0] + 1) * (c[3] - c[1] + 1)
+}
+
+// rangeCoordinates converts a range such as "A1:C3" to sorted
+// [col1, row1, col2, row2] coordinates. A single cell is a one-cell range.
+func rangeCoordinates(rangeRef string) ([]int, error) {
+	cells := strings.Split(strings.ReplaceAll(rangeRef, "$", ""), ":")
+	if len(cells) == 1 {
+		cells = append(cells, cells[0])
+	}
+	if len(cells) != 2 {
+		return nil, fmt.Errorf("invalid range %s", rangeRef)
+	}
+	col1, row1, err := excelize.CellNameToCoordinates(cells[0])
+	if err != nil {
+		return nil, err
+	}
+	col2, row2, err := excelize.CellNameToCoordinates(cells[1])
+	if err != nil {
+		return nil, err
+	}
+	return []int{min(col1, col2), min(row1, row2), max(col1, col2), max(row1, row2)}, nil
+}
+
+// inSpillRange reports whether a cell lies inside one of the spill ranges
+func inSpillRange(spills [][]int, address string) bool {
+	if len(spills) == 0 {
+		return false
+	}
+	col, row, err := excelize.CellNameToCoordinates(address)
+	if err != nil {
+		return false
+	}
+	for _, c := range spills {
+		if col >= c[0] && col <= c[2] && row >= c[1] && row <= c[3] {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteDefaultSheet removes the "Sheet1" created by excelize.NewFile, but only
+// when at least one sheet was recreated and none of them reuses that name.
+func (r *Recreator) deleteDefaultSheet() {
+	if len(r.createdSheets) == 0 {
+		return
+	}
+	for name := range r.createdSheets {
+		if strings.EqualFold(name, defaultSheetName) {
+			return
+		}
+	}
+	if index, err := r.File.GetSheetIndex(defaultSheetName); err != nil || index == -1 {
+		return
+	}
+	_ = r.File.DeleteSheet(defaultSheetName)
+}
+
+// recreateCells writes only the explicit cell entries. The sheet Dimensions
+// are never expanded, so a sparse sheet costs no more than its cells.
+func (r *Recreator) recreateCells(ctx context.Context, sheetName string, cells []excelmetadata.CellMetadata) error {
+	sheetOpts := r.sheetOptions(sheetName)
+	spills := sheetOpts.spillRanges()
+	interval := r.Options.CellProgressInterval
+	if interval <= 0 {
+		interval = defaultCellProgressInterval
+	}
+	for i, cell := range cells {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("recreation canceled: %w", err)
+		}
+		if err := r.recreateCell(sheetName, sheetOpts, spills, cell); err != nil {
+			return err
+		}
+		if done := i + 1; r.Options.CellProgressFunc != nil && (done%interval == 0 || done == len(cells)) {
+			r.Options.CellProgressFunc(sheetName, done, len(cells))
+		}
+	}
+
+	return nil
+}
+
+// recreateCell writes the value or formula, style and hyperlink of one cell
+func (r *Recreator) recreateCell(sheetName string, sheetOpts *SheetOptions, spills [][]int, cell excelmetadata.CellMetadata) error {
+	writer := r.writer()
+	cellOpts := sheetOpts.cellOptions(cell.Address)
+	cell.Value = r.cellValue(cell.Value)
+
+	// Handle cells without a value or formula
+	if cell.Value == nil && cell.Formula == "" {
+		switch r.Options.NilValuePolicy {
+		case NilValueSkip:
+			return nil
+		case NilValueEmptyString:
+			cell.Value = ""
+		case NilValueDefault:
+			if r.Options.SkipEmptyCells {
+				return nil
+			}
+		}
+	}
+
+	// Skip cells covered by a spill range, which Excel fills from the anchor
+	if cellOpts.SpillRange == "" && inSpillRange(spills, cell.Address) {
+		return nil
+	}
+
+	// Restore the type the value had before JSON encoding
+	if cellOpts.OriginalType != "" && cell.Value != nil {
+		value, err := originalTypeValue(cell.Value, cellOpts.OriginalType)
+		if err != nil {
+			return fmt.Errorf("sheet %s cell %s: %w", sheetName, cell.Address, err)
+		}
+		cell.Value = value
+	}
+
+	// Write dates shown by a date format as serials, so Excel treats a
+	// display string such as "2023-01-01" as a real date
+	if r.Options.CoerceDates && cell.StyleID != 0 && (cell.Formula == "" || !r.Options.PreserveFormulas) && r.isDateStyle(cell.StyleID) {
+		if serial, ok := r.dateSerial(cell.Value); ok {
+			cell.Value = serial
+		}
+	}
+
+	// Excel rejects cells over the character limit
+	if str, ok := cell.Value.(string); ok && utf8.RuneCountInString(str) > excelize.TotalCellChars {
+		if r.Options.LongStringPolicy == LongStringError {
+			return fmt.Errorf("sheet %s cell %s: string exceeds %d characters", sheetName, cell.Address, excelize.TotalCellChars)
+		}
+		cell.Value = string([]rune(str)[:excelize.TotalCellChars])
+		r.warn(sheetName, cell.Address, WarningTruncated, fmt.Sprintf("string truncated to %d characters", excelize.TotalCellChars))
+	}
+
+	// Set cell value or formula
+	if len(cellOpts.RichText) > 0 {
+		if err := writer.SetCellRichText(sheetName, cell.Address, r.richTextRuns(cellOpts.RichText)); err != nil {
+			return fmt.Errorf("sheet %s cell %s: %w", sheetName, cell.Address, err)
+		}
+	} else if cellOpts.AsText {
+		text := ""
+		if cell.Formula != "" {
+			text = "=" + normalizeFormula(cell.Formula)
+		} else if cell.Value != nil {
+			text = fmt.Sprint(cell.Value)
+		}
+		if err := writer.SetCellStr(sheetName, cell.Address, text); err != nil {
+			return fmt.Errorf("sheet %s cell %s: %w", sheetName, cell.Address, err)
+		}
+	} else if cell.Formula != "" && r.Options.PreserveFormulas {
+		var opts []excelize.FormulaOpts
+		if cellOpts.SpillRange != "" {
+			formulaType, ref := excelize.STCellFormulaTypeArray, cellOpts.SpillRange
+			opts = append(opts, excelize.FormulaOpts{Type: &formulaType, Ref: &ref})
+		}
+		if err := writer.SetCellFormula(sheetName, cell.Address, normalizeFormula(cell.Formula), opts...); err != nil {
+			return fmt.Errorf("sheet %s cell %s: %w", sheetName, cell.Address, err)
+		}
+	} else if str, ok := cell.Value.(string); ok && !isTextCellType(cell.Type) && isErrorValue(str) {
+		// excelize cannot write error cells, so the error is written as a
+		// formula constant, which Excel evaluates to the error
+		if err := writer.SetCellFormula(sheetName, cell.Address, str); err != nil {
+			return fmt.Errorf("sheet %s cell %s: %w", sheetName, cell.Address, err)
+		}
+	} else if str, ok := cell.Value.(string); ok && (isTextCellType(cell.Type) || cellOpts.OriginalType == "string") {
+		// Text results, such as =CONCAT("1","23") flattened to its value,
+		// stay text instead of being parsed as numbers
+		if err := writer.SetCellStr(sheetName, cell.Address, str); err != nil {
+			return fmt.Errorf("sheet %s cell %s: %w", sheetName, cell.Address, err)
+		}
+	} else if cell.Value != nil {
+		if err := r.setCellValue(sheetName, cell.Address, cell.Value); err != nil {
+			return fmt.Errorf("sheet %s cell %s: %w", sheetName, cell.Address, err)
+		}
+	}
+	if r.Options.PreservePhonetic && cellOpts.PhoneticText != "" {
+		r.addPhonetic(sheetName, cell.Address, cellOpts.PhoneticText)
+	}
+
+	// Apply style
+	styleID := 0
+	if r.Options.PreserveStyles && cell.StyleID != 0 {
+		if newStyleID, exists := r.StyleMap[cell.StyleID]; exists {
+			styleID = newStyleID
+		} else if r.Options.RequireAllStyles {
+			return fmt.Errorf("sheet %s cell %s: style %d not found", sheetName, cell.Address, cell.StyleID)
+		} else {
+			r.warn(sheetName, cell.Address, WarningStyleMissing, fmt.Sprintf("style %d not found", cell.StyleID))
+		}
+	}
+	if _, isTime := cell.Value.(time.Time); isTime && styleID != 0 {
+		// Keep the date format excelize applied to the time value, which
+		// the cell style would otherwise replace
+		dateStyleID, err := writer.GetCellStyle(sheetName, cell.Address)
+		if err != nil {
+			return fmt.Errorf("sheet %s cell %s: %w", sheetName, cell.Address, err)
+		}
+		dateStyle, err := r.File.GetStyle(dateStyleID)
+		if err != nil {
+			return fmt.Errorf("sheet %s cell %s: %w", sheetName, cell.Address, err)
+		}
+		if styleID, err = r.numFmtStyle(styleID, dateStyle.NumFmt); err != nil {
+			return fmt.Errorf("sheet %s cell %s: %w", sheetName, cell.Address, err)
+		}
+	}
+	if len(r.Options.PercentColumns) > 0 && isNumericValue(cell.Value, cell.Type) && r.isPercentColumn(cell.Address) {
+		percentStyleID, err := r.numFmtStyle(styleID, percentNumFmt)
+		if err != nil {
+			return fmt.Errorf("sheet %s cell %s: %w", sheetName, cell.Address, err)
+		}
+		styleID = percentStyleID
+	}
+	if sheetOpts.DefaultNumFmt != 0 && isNumericValue(cell.Value, cell.Type) {
+		numFmtStyleID, err := r.numFmtStyle(styleID, sheetOpts.DefaultNumFmt)
+		if err != nil {
+			return fmt.Errorf("sheet %s cell %s: %w", sheetName, cell.Address, err)
+		}
+		styleID = numFmtStyleID
+	}
+	if cellOpts.FillColor != "" {
+		fillStyleID, err := r.fillStyle(styleID, cellOpts.FillColor)
+		if err != nil {
+			return fmt.Errorf("sheet %s cell %s: %w", sheetName, cell.Address, err)
+		}
+		styleID = fillStyleID
+	}
+	if cellOpts.Indent > 0 {
+		indentStyleID, err := r.indentStyle(styleID, cellOpts.Indent)
+		if err != nil {
+			return fmt.Errorf("sheet %s cell %s: %w", sheetName, cell.Address, err)
+		}
+		styleID = indentStyleID
+	}
+	if cellOpts.QuotePrefix || cellOpts.AsText {
+		quoteStyleID, err := r.quotePrefixStyle(styleID)
+		if err != nil {
+			return fmt.Errorf("sheet %s cell %s: %w", sheetName, cell.Address, err)
+		}
+		styleID = quoteStyleID
+	}
+	if styleID != 0 {
+		writer.SetCellStyle(sheetName, cell.Address, cell.Address, styleID)
+	}
+
+	// Set hyperlink
+	if cell.Hyperlink != nil {
+		link, linkType := cell.Hyperlink.Link, "Location"
+		if r.Options.NormalizeHyperlinks {
+			if normalized := normalizeHyperlink(link); normalized != link {
+				r.warn(sheetName, cell.Address, WarningHyperlinkFixed, fmt.Sprintf("hyperlink %q normalized to %q", link, normalized))
+				link = normalized
+			}
+			linkType = imageHyperlinkType(link, "")
+		}
+		r.File.SetCellHyperLink(sheetName, cell.Address, link, linkType)
+	}
+
+	return nil
+}
+
+// normalizeHyperlink trims a link and makes web and email addresses valid
+// external links: "www.example.com" becomes "https://www.example.com",
+// "a@example.com" becomes "mailto:a@example.com", and characters such as
+// spaces are percent-encoded. Workbook locations such as "Sheet2!A1" and
+// file paths such as "docs/report.pdf", "C:\report.xlsx" or UNC paths are
+// kept.
+func normalizeHyperlink(link string) string {
+	link = strings.TrimSpace(link)
+	lower := strings.ToLower(link)
+	switch {
+	case link == "" || strings.HasPrefix(link, "#") || (strings.Contains(link, "!") && !strings.Contains(link, "://")):
+		return link
+	case strings.HasPrefix(lower, "mailto:") || strings.Contains(link, "://"):
+	case strings.Contains(link, "@") && !strings.ContainsAny(link, "/\\ "):
+		link = "mailto:" + link
+	case strings.HasPrefix(lower, "www.") || isHostLike(link):
+		link = "https://" + link
+	default:
+		return link
+	}
+	if u, err := url.Parse(link); err == nil {
+		u.RawQuery = strings.ReplaceAll(u.RawQuery, " ", "%20")
+		return u.String()
+	}
+	return strings.ReplaceAll(link, " ", "%20")
+}
+
+// hostLabel matches a label of a host name, such as "example" or "my-site"
+var hostLabel = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// fileExtensions are the extensions of files commonly linked from a workbook,
+// which isHostLike does not take for top-level domains
+var fileExtensions = map[string]bool{
+	"xlsx": true, "xlsm": true, "xls": true, "xlsb": true, "csv": true, "txt": true,
+	"pdf": true, "doc": true, "docx": true, "ppt": true, "pptx": true, "htm": true,
+	"html": true, "xml": true, "json": true, "png": true, "jpg": true, "jpeg": true,
+	"gif": true, "zip": true,
+}
+
+// isHostLike reports whether the first segment of a link, up to its path,
+// query or fragment and without a port, is a host name such as
+// "example.com" rather than a file name
+func isHostLike(link string) bool {
+	host := strings.ToLower(link)
+	if i := strings.IndexAny(host, "/?#"); i >= 0 {
+		host = host[:i]
+	}
+	if name, port, hasPort := strings.Cut(host, ":"); hasPort {
+		if _, err := strconv.Atoi(port); err != nil {
+			return false
+		}
+		host = name
+	}
+	labels := strings.Split(host, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if !hostLabel.MatchString(label) {
+			return false
+		}
+	}
+	tld := labels[len(labels)-1]
+	if len(tld) < 2 || fileExtensions[tld] || strings.Trim(tld, "abcdefghijklmnopqrstuvwxyz") != "" {
+		return false
+	}
+	return true
+}
+
+// richTextRuns converts rich text runs to excelize runs with a font per run
+func (r *Recreator) richTextRuns(runs []RichTextRun) []excelize.RichTextRun {
+	result := make([]excelize.RichTextRun, 0, len(runs))
+	for _, run := range runs {
+		result = append(result, excelize.RichTextRun{
+			Text: run.Text,
+			Font: &excelize.Font{
+				Bold:      run.Bold,
+				Italic:    run.Italic,
+				Underline: run.Underline,
+				Color:     normalizeColor(run.Color),
+				Size:      r.scaleFontSize(run.Size),
+				Family:    run.Family,
+			},
+		})
+	}
+	return result
+}
+
+// normalizeColor converts "#RGB", "#RRGGBB", "RRGGBB" and "AARRGGBB" colors to
+// the "RRGGBB" form excelize expects
+func normalizeColor(color string) string {
+	color = strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(color), "#"))
+	switch len(color) {
+	case 3:
+		return string([]byte{color[0], color[0], color[1], color[1], color[2], color[2]})
+	case 8:
+		return color[2:]
+	}
+	return color
+}
+
+// fillStyle returns a style that copies baseStyleID and sets a solid fill
+func (r *Recreator) fillStyle(baseStyleID int, color string) (int, error) {
+	key := newDerivedStyleKey("fill", baseStyleID, normalizeColor(color))
+	return r.derivedStyles.get(key, func() (int, error) {
+		style, err := r.File.GetStyle(baseStyleID)
+		if err != nil {
+			return 0, err
+		}
+		style.Fill = excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{normalizeColor(color)}}
+
+		return r.File.NewStyle(style)
+	})
+}
+
+// filledCells returns the addresses of cells with a value or formula
+func filledCells(cells []excelmetadata.CellMetadata) map[string]bool {
+	filled := make(map[string]bool)
+	for _, cell := range cells {
+		if cell.Value != nil || cell.Formula != "" {
+			filled[strings.ToUpper(cell.Address)] = true
+		}
+	}
+	return filled
+}
+
+// clearCoveredCells clears the values and formulas of filled cells under a
+// merge other than its top-left cell, which Excel hides but keeps in the file
+func (r *Recreator) clearCoveredCells(sheetName string, merge excelmetadata.MergedCell, filled map[string]bool) error {
+	col1, row1, err := excelize.CellNameToCoordinates(merge.StartCell)
+	if err != nil {
+		return err
+	}
+	col2, row2, err := excelize.CellNameToCoordinates(merge.EndCell)
+	if err != nil {
+		return err
+	}
+
+	writer := r.writer()
+	for row := min(row1, row2); row <= max(row1, row2); row++ {
+		for col := min(col1, col2); col <= max(col1, col2); col++ {
+			if col == min(col1, col2) && row == min(row1, row2) {
+				continue
+			}
+			cell, _ := excelize.CoordinatesToCellName(col, row)
+			if !filled[cell] {
+				continue
+			}
+			if err := writer.SetCellValue(sheetName, cell, nil); err != nil {
+				return err
+			}
+			if err := writer.SetCellFormula(sheetName, cell, ""); err != nil {
+				return err
+			}
+			r.warn(sheetName, cell, WarningCoveredCleared, fmt.Sprintf("value under merge %s:%s cleared", merge.StartCell, merge.EndCell))
+		}
+	}
+	return nil
+}
+
+// extendMergeBorders draws the anchor cell's borders around the whole merged
+// range. Excel draws each edge from the cells along it, so unstyled cells on
+// the edges get the anchor's borders for their outer sides.
+func (r *Recreator) extendMergeBorders(sheetName string, merge excelmetadata.MergedCell) error {
+	writer := r.writer()
+	col1, row1, err := excelize.CellNameToCoordinates(merge.StartCell)
+	if err != nil {
+		return err
+	}
+	col2, row2, err := excelize.CellNameToCoordinates(merge.EndCell)
+	if err != nil {
+		return err
+	}
+	col1, col2 = min(col1, col2), max(col1, col2)
+	row1, row2 = min(row1, row2), max(row1, row2)
+
+	anchorCell, _ := excelize.CoordinatesToCellName(col1, row1)
+	anchorStyleID, err := writer.GetCellStyle(sheetName, anchorCell)
+	if err != nil || anchorStyleID == 0 {
+		return err
+	}
+	anchorStyle, err := r.File.GetStyle(anchorStyleID)
+	if err != nil || len(anchorStyle.Border) == 0 {
+		return err
+	}
+
+	for row := row1; row <= row2; row++ {
+		for col := col1; col <= col2; col++ {
+			var sides []string
+			if col == col1 {
+				sides = append(sides, "left")
+			}
+			if row == row1 {
+				sides = append(sides, "top")
+			}
+			if col == col2 {
+				sides = append(sides, "right")
+			}
+			if row == row2 {
+				sides = append(sides, "bottom")
+			}
+			if len(sides) == 0 || (col == col1 && row == row1) {
+				continue
+			}
+
+			cell, _ := excelize.CoordinatesToCellName(col, row)
+			if styleID, err := writer.GetCellStyle(sheetName, cell); err != nil || styleID != 0 {
+				continue
+			}
+			styleID, err := r.borderStyle(anchorStyleID, sides)
+			if err != nil {
+				return err
+			}
+			if err := writer.SetCellStyle(sheetName, cell, cell, styleID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// borderStyle returns a style that copies baseStyleID with only the borders
+// on the given sides
+func (r *Recreator) borderStyle(baseStyleID int, sides []string) (int, error) {
+	key := newDerivedStyleKey("border", baseStyleID, sides)
+	return r.derivedStyles.get(key, func() (int, error) {
+		style, err := r.File.GetStyle(baseStyleID)
+		if err != nil {
+			return 0, err
+		}
+		var borders []excelize.Border
+		for _, border := range style.Border {
+			for _, side := range sides {
+				if border.Type == side {
+					borders = append(borders, border)
+				}
+			}
+		}
+		style.Border = borders
+
+		return r.File.NewStyle(style)
+	})
+}
+
+// indentStyle returns a style that copies baseStyleID with an indentation
+// level. Excel only indents left, right or distributed alignment, so other
+// alignments become left.
+func (r *Recreator) indentStyle(baseStyleID, indent int) (int, error) {
+	key := newDerivedStyleKey("indent", baseStyleID, indent)
+	return r.derivedStyles.get(key, func() (int, error) {
+		style, err := r.File.GetStyle(baseStyleID)
+		if err != nil {
+			return 0, err
+		}
+		if style.Alignment == nil {
+			style.Alignment = &excelize.Alignment{}
+		}
+		switch style.Alignment.Horizontal {
+		case "left", "right", "distributed":
+		default:
+			style.Alignment.Horizontal = "left"
+		}
+		style.Alignment.Indent = indent
+
+		return r.File.NewStyle(style)
+	})
+}
+
+// quotePrefixStyle returns a style that copies baseStyleID with the quote
+// prefix set, which excelize.Style has no field for
+func (r *Recreator) quotePrefixStyle(baseStyleID int) (int, error) {
+	opts := cellXfOptions{QuotePrefix: true}
+	return r.derivedStyles.get(newDerivedStyleKey("cellXf", baseStyleID, opts), func() (int, error) {
+		return r.appendCellXf(baseStyleID, opts)
+	})
+}
+
+// cellXfOptions are the cell format settings excelize.Style cannot express
+type cellXfOptions struct {
+	BgColor     string // Background color of a pattern fill, such as "FF0000"
+	QuotePrefix bool   // Store the value as text with a leading apostrophe
+}
+
+// appendCellXf appends a copy of the cell format of baseStyleID with opts
+// applied to the loaded stylesheet and returns its style ID. excelize v2.9.1
+// has no API for these settings, so the stylesheet is edited directly. The
+// copy comes after its base, so NewStyle keeps matching the base for the same
+// style, and a changed fill is appended as a new fill, as other styles may
+// share the base's fill.
+func (r *Recreator) appendCellXf(baseStyleID int, opts cellXfOptions) (int, error) {
+	if _, err := r.File.GetStyle(baseStyleID); err != nil {
+		return 0, err
+	}
+	styles := r.File.Styles
+	if styles == nil || styles.CellXfs == nil || baseStyleID < 0 || baseStyleID >= len(styles.CellXfs.Xf) {
+		return 0, fmt.Errorf("style %d not found", baseStyleID)
+	}
+	xf := styles.CellXfs.Xf[baseStyleID]
+
+	if opts.BgColor != "" {
+		if xf.FillID == nil || styles.Fills == nil || *xf.FillID < 0 || *xf.FillID >= len(styles.Fills.Fill) ||
+			styles.Fills.Fill[*xf.FillID].PatternFill == nil || styles.Fills.Fill[*xf.FillID].PatternFill.FgColor == nil {
+			return 0, fmt.Errorf("style %d has no pattern fill color", baseStyleID)
+		}
+		fill := *styles.Fills.Fill[*xf.FillID]
+		patternFill := *fill.PatternFill
+		bgColor := *patternFill.FgColor
+		bgColor.RGB = "FF" + normalizeColor(opts.BgColor)
+		patternFill.BgColor = &bgColor
+		fill.PatternFill = &patternFill
+		styles.Fills.Fill = append(styles.Fills.Fill, &fill)
+		styles.Fills.Count = len(styles.Fills.Fill)
+		fillID := len(styles.Fills.Fill) - 1
+		xf.FillID = &fillID
+	}
+	if opts.QuotePrefix {
+		quotePrefix := true
+		xf.QuotePrefix = &quotePrefix
+	}
+
+	styles.CellXfs.Xf = append(styles.CellXfs.Xf, xf)
+	styles.CellXfs.Count = len(styles.CellXfs.Xf)
+	return len(styles.CellXfs.Xf) - 1, nil
+}
+
+// numFmtStyle returns a style that copies baseStyleID with a number format.
+// Base styles with their own number format are kept.
+func (r *Recreator) numFmtStyle(baseStyleID, numFmt int) (int, error) {
+	key := newDerivedStyleKey("numFmt", baseStyleID, numFmt)
+	return r.derivedStyles.get(key, func() (int, error) {
+		style, err := r.File.GetStyle(baseStyleID)
+		if err != nil {
+			return 0, err
+		}
+		if style.NumFmt != 0 || style.CustomNumFmt != nil || numFmt == 0 {
+			return baseStyleID, nil
+		}
+		if code, ok := currencyNumFmts[numFmt]; ok {
+			style.CustomNumFmt = &code
+		} else {
+			style.NumFmt = numFmt
+		}
+
+		return r.File.NewStyle(style)
+	})
 }
 
-func (r *Recreator) recreateStyles() error {
-	for oldID, styleMeta := range r.Metadata.Styles {
-		style := &excelize.Style{}
+// currencyNumFmts holds the codes of the locale-dependent built-in currency
+// formats, which excelize does not accept as number format IDs
+var currencyNumFmts = map[int]string{
+	5: `"$"#,##0_);\("$"#,##0\)`,
+	6: `"$"#,##0_);[Red]\("$"#,##0\)`,
+	7: `"$"#,##0.00_);\("$"#,##0.00\)`,
+	8: `"$"#,##0.00_);[Red]\("$"#,##0.00\)`,
+}
 
-		// Recreate font
-		if styleMeta.Font != nil {
-			style.Font = &excelize.Font{
-				Bold:      styleMeta.Font.Bold,
-				Italic:    styleMeta.Font.Italic,
-				Underline: styleMeta.Font.Underline,
-				Strike:    styleMeta.Font.Strike,
-				Family:    styleMeta.Font.Family,
-				Size:      styleMeta.Font.Size,
-				Color:     styleMeta.Font.Color,
-			}
+// isPercentColumn reports whether a cell is in one of Options.PercentColumns
+func (r *Recreator) isPercentColumn(address string) bool {
+	col, _, err := excelize.SplitCellName(address)
+	if err != nil {
+		return false
+	}
+	for _, percentCol := range r.Options.PercentColumns {
+		if strings.EqualFold(percentCol, col) {
+			return true
 		}
+	}
+	return false
+}
 
-		// Recreate fill
-		if styleMeta.Fill != nil && len(styleMeta.Fill.Color) > 0 {
-			style.Fill = excelize.Fill{
-				Type:    styleMeta.Fill.Type,
-				Pattern: styleMeta.Fill.Pattern,
-				Color:   styleMeta.Fill.Color,
-			}
+// isNumericValue reports whether a value is written as a number
+func isNumericValue(value interface{}, cellType excelize.CellType) bool {
+	switch v := value.(type) {
+	case float32, float64, int, int8, int16, int32:
+		return true
+	case string:
+		if isTextCellType(cellType) {
+			return false
 		}
+		_, err := strconv.ParseFloat(v, 64)
+		return err == nil
+	}
+	return false
+}
 
-		// Recreate borders
-		if len(styleMeta.Border) > 0 {
-			style.Border = []excelize.Border{}
-			for _, borderMeta := range styleMeta.Border {
-				style.Border = append(style.Border, excelize.Border{
-					Type:  borderMeta.Type,
-					Color: borderMeta.Color,
-					Style: borderMeta.Style,
-				})
-			}
+// cellValue normalizes a metadata value before writing, returning nil for
+// values that should be treated as empty
+func (r *Recreator) cellValue(value interface{}) interface{} {
+	str, ok := value.(string)
+	if !ok {
+		return value
+	}
+	if r.Options.TrimCellWhitespace {
+		if str = strings.TrimSpace(str); str == "" {
+			return nil
 		}
+		value = str
+	}
+	if r.Options.TreatEmptyStringAsEmpty && str == "" {
+		return nil
+	}
+	return value
+}
 
-		// Recreate alignment
-		if styleMeta.Alignment != nil {
-			style.Alignment = &excelize.Alignment{
-				Horizontal:   styleMeta.Alignment.Horizontal,
-				Vertical:     styleMeta.Alignment.Vertical,
-				WrapText:     styleMeta.Alignment.WrapText,
-				TextRotation: styleMeta.Alignment.TextRotation,
-				Indent:       styleMeta.Alignment.Indent,
-				ShrinkToFit:  styleMeta.Alignment.ShrinkToFit,
-			}
+// isDateStyle reports whether the style created for a metadata style ID has a
+// date or time number format
+func (r *Recreator) isDateStyle(styleID int) bool {
+	newStyleID, exists := r.StyleMap[styleID]
+	if !exists || !r.Options.PreserveStyles {
+		return false
+	}
+	if isDate, cached := r.dateStyles[newStyleID]; cached {
+		return isDate
+	}
+	isDate := false
+	if style, err := r.File.GetStyle(newStyleID); err == nil {
+		if style.CustomNumFmt != nil {
+			isDate = isDateNumFmtCode(*style.CustomNumFmt)
+		} else {
+			isDate = isDateNumFmt(style.NumFmt)
 		}
+	}
+	if r.dateStyles == nil {
+		r.dateStyles = make(map[int]bool)
+	}
+	r.dateStyles[newStyleID] = isDate
+	return isDate
+}
 
-		// Recreate number format
-		if styleMeta.NumberFormat != 0 {
-			style.NumFmt = styleMeta.NumberFormat
-		}
+// isDateNumFmt reports whether a built-in number format shows a date or time
+func isDateNumFmt(numFmt int) bool {
+	return (numFmt >= 14 && numFmt <= 22) || (numFmt >= 27 && numFmt <= 36) ||
+		(numFmt >= 45 && numFmt <= 47) || (numFmt >= 50 && numFmt <= 58)
+}
 
-		// Recreate protection
-		if styleMeta.Protection != nil {
-			style.Protection = &excelize.Protection{
-				Hidden: styleMeta.Protection.Hidden,
-				Locked: styleMeta.Protection.Locked,
+// isDateNumFmtCode reports whether a custom number format shows a date or
+// time, ignoring quoted text, escaped characters and bracketed colors and
+// locales. Bracketed elapsed times such as [h] count as times.
+func isDateNumFmtCode(code string) bool {
+	var quoted, escaped bool
+	var bracket *strings.Builder // Text of the open bracket
+	for _, c := range strings.ToLower(code) {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '[':
+			bracket = &strings.Builder{}
+		case c == ']' && bracket != nil:
+			if elapsedTimeToken.MatchString(bracket.String()) {
+				return true
 			}
-		}
-
-		// Create the style and map old ID to new ID
-		newID, err := r.File.NewStyle(style)
-		if err == nil {
-			r.StyleMap[oldID] = newID
+			bracket = nil
+		case bracket != nil:
+			bracket.WriteRune(c)
+		case c == 'y' || c == 'd' || c == 'h' || c == 's':
+			return true
 		}
 	}
-
-	return nil
+	return false
 }
 
-func (r *Recreator) recreateSheet(sheetMeta excelmetadata.SheetMetadata) error {
-	sheetName := sheetMeta.Name
-	if sheetName == "" {
-		sheetName = fmt.Sprintf("%s%d", r.Options.DefaultSheetName, sheetMeta.Index+1)
-	}
+// elapsedTimeToken matches the bracketed elapsed hours, minutes or seconds of
+// a number format, such as the "h" of "[h]:mm"
+var elapsedTimeToken = regexp.MustCompile(`^(h+|m+|s+)$`)
 
-	// Create sheet
-	index, err := r.File.NewSheet(sheetName)
-	if err != nil {
-		return err
-	}
+// dateLayouts are the date strings CoerceDates parses, ISO formats first
+var dateLayouts = []string{
+	time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04",
+	"2006-01-02", "2006/01/02", "1/2/2006 15:04:05", "1/2/2006 15:04", "1/2/2006",
+}
 
-	// Delete default sheet if we have sheets to create
-	if len(r.Metadata.Sheets) > 0 {
-		if sheetMeta.Index == 0 {
-			r.File.SetActiveSheet(index)
-			_ = r.File.DeleteSheet("Sheet1")
+// dateSerial converts a time, a date string or a numeric string to a date
+// serial in the workbook's date system
+func (r *Recreator) dateSerial(value interface{}) (float64, bool) {
+	var t time.Time
+	switch v := value.(type) {
+	case time.Time:
+		t = v
+	case string:
+		str := strings.TrimSpace(v)
+		if serial, err := strconv.ParseFloat(str, 64); err == nil {
+			return serial, true
+		}
+		parsed := false
+		for _, layout := range dateLayouts {
+			if d, err := time.Parse(layout, str); err == nil {
+				t, parsed = d, true
+				break
+			}
+		}
+		if !parsed {
+			return 0, false
 		}
+	default:
+		return 0, false
 	}
 
-	// Set visibility
-	r.File.SetSheetVisible(sheetName, sheetMeta.Visible)
-
-	// Set column widths
-	for col, width := range sheetMeta.ColWidths {
-		r.File.SetColWidth(sheetName, col, col, width)
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if r.Options.Date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
 	}
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	return float64(wall.Unix()-epoch.Unix())/86400 + float64(wall.Nanosecond())/float64(24*time.Hour), true
+}
 
-	// Set row heights
-	for row, height := range sheetMeta.RowHeights {
-		r.File.SetRowHeight(sheetName, row, height)
+// originalTypeValue converts a decoded JSON value back to its original type
+func originalTypeValue(value interface{}, originalType string) (interface{}, error) {
+	str := fmt.Sprint(value)
+	switch originalType {
+	case "int":
+		if f, ok := value.(float64); ok && f == float64(int(f)) {
+			return int(f), nil
+		}
+		if i, err := strconv.Atoi(str); err == nil {
+			return i, nil
+		}
+	case "float":
+		if f, err := strconv.ParseFloat(str, 64); err == nil {
+			return f, nil
+		}
+	case "bool":
+		if f, ok := value.(float64); ok {
+			return f != 0, nil
+		}
+		if b, err := strconv.ParseBool(str); err == nil {
+			return b, nil
+		}
+	case "string":
+		return str, nil
+	case "time":
+		if t, ok := value.(time.Time); ok {
+			return t, nil
+		}
+		if t, err := time.Parse(time.RFC3339, str); err == nil {
+			return t, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown original type %q", originalType)
 	}
+	return nil, fmt.Errorf("value %v is not a valid %s", value, originalType)
+}
 
-	// Recreate cells
-	if err := r.recreateCells(sheetName, sheetMeta.Cells); err != nil {
-		return err
+// isErrorValue reports whether a value is an Excel error constant such as #N/A
+func isErrorValue(value string) bool {
+	switch value {
+	case "#NULL!", "#DIV/0!", "#VALUE!", "#REF!", "#NAME?", "#NUM!", "#N/A":
+		return true
 	}
+	return false
+}
 
-	// Recreate merged cells
-	for _, merge := range sheetMeta.MergedCells {
-		r.File.MergeCell(sheetName, merge.StartCell, merge.EndCell)
+// isTextCellType reports whether a cell type holds text. excelize reports
+// formulas with a text result ("str") as CellTypeFormula.
+func isTextCellType(cellType excelize.CellType) bool {
+	switch cellType {
+	case excelize.CellTypeSharedString, excelize.CellTypeInlineString, excelize.CellTypeFormula:
+		return true
 	}
+	return false
+}
 
-	// Recreate data validations
-	if r.Options.PreserveDataValidation {
-		for _, dv := range sheetMeta.DataValidations {
-			r.recreateDataValidation(sheetName, dv)
+// setCellValue writes a value using the setter that matches its type
+func (r *Recreator) setCellValue(sheetName, address string, value interface{}) error {
+	writer := r.writer()
+	switch v := value.(type) {
+	case float32:
+		return writer.SetCellFloat(sheetName, address, float64(v), -1, 64)
+	case float64:
+		return writer.SetCellFloat(sheetName, address, v, -1, 64)
+	case int:
+		return writer.SetCellInt(sheetName, address, int64(v))
+	case int8:
+		return writer.SetCellInt(sheetName, address, int64(v))
+	case int16:
+		return writer.SetCellInt(sheetName, address, int64(v))
+	case int32:
+		return writer.SetCellInt(sheetName, address, int64(v))
+	case bool:
+		if r.Options.BooleanAsNumber {
+			if v {
+				return writer.SetCellInt(sheetName, address, 1)
+			}
+			return writer.SetCellInt(sheetName, address, 0)
+		}
+		return writer.SetCellBool(sheetName, address, v)
+	case time.Time:
+		return writer.SetCellValue(sheetName, address, v)
+	default:
+		// Convert to string
+		strVal := fmt.Sprintf("%v", v)
+		// Try to parse as number
+		if floatVal, err := strconv.ParseFloat(strVal, 64); err == nil {
+			return writer.SetCellFloat(sheetName, address, floatVal, -1, 64)
 		}
+		return writer.SetCellValue(sheetName, address, strVal)
 	}
+}
 
-	// Recreate images
-	if r.Options.PreserveImages {
-		for _, img := range sheetMeta.Images {
-			r.recreateImage(sheetName, &img)
+func (r *Recreator) recreateComments(sheetName string) error {
+	cells := r.sheetOptions(sheetName).Cells
+	addresses := make([]string, 0, len(cells))
+	var capped int
+	for address, opts := range cells {
+		if opts == nil || opts.Comment == nil {
+			continue
+		}
+		if !r.Options.cellWithinCap(address) {
+			capped++
+			continue
 		}
+		addresses = append(addresses, address)
 	}
-
-	// Recreate sheet protection
-	if sheetMeta.Protection != nil && sheetMeta.Protection.Protected {
-		r.recreateSheetProtection(sheetName, sheetMeta.Protection)
+	sort.Strings(addresses)
+	r.warnCapped(sheetName, capped, "comments")
+
+	for _, address := range addresses {
+		comment := cells[address].Comment
+		opts := excelize.Comment{
+			Cell:   address,
+			Author: comment.Author,
+			Text:   comment.Text,
+		}
+		if len(comment.Runs) > 0 {
+			opts.Text = ""
+			opts.Paragraph = r.richTextRuns(comment.Runs)
+		}
+		if err := r.File.AddComment(sheetName, opts); err != nil {
+			return fmt.Errorf("failed to add comment at %s: %w", address, err)
+		}
+		if comment.Threaded {
+			r.warn(sheetName, address, WarningThreadedComment, "threaded comment written as a legacy note")
+		}
+		if !comment.Created.IsZero() {
+			r.warn(sheetName, address, WarningCommentTimestamp,
+				fmt.Sprintf("created time %s dropped, legacy comments have no timestamp", comment.Created.Format(time.RFC3339)))
+		}
 	}
 
 	return nil
 }
 
-func (r *Recreator) recreateCells(sheetName string, cells []excelmetadata.CellMetadata) error {
-	for _, cell := range cells {
-		// Skip empty cells if option is set
-		if r.Options.SkipEmptyCells && cell.Value == nil && cell.Formula == "" {
+// recreateConditionalFormats adds the rules in priority order, since excelize
+// assigns priorities in the order rules are added
+func (r *Recreator) recreateConditionalFormats(sheetName string) error {
+	formats := append([]ConditionalFormat{}, r.sheetOptions(sheetName).ConditionalFormats...)
+	sort.SliceStable(formats, func(i, j int) bool {
+		return formats[i].Priority < formats[j].Priority
+	})
+
+	var capped int
+	for _, format := range formats {
+		sqref, cut := r.Options.capSqref(format.Range)
+		if cut {
+			capped++
+		}
+		if sqref == "" {
 			continue
 		}
+		format.Range = sqref
 
-		// Set cell value or formula
-		if cell.Formula != "" && r.Options.PreserveFormulas {
-			if err := r.File.SetCellFormula(sheetName, cell.Address, cell.Formula); err != nil {
-				return err
+		rule := format.Rule
+		if rule.Type == "formula" {
+			// The rule formula is stored without "=", with its references
+			// relative to the top-left cell of the range
+			rule.Criteria = normalizeFormula(rule.Criteria)
+		}
+		if format.StyleID != 0 {
+			newStyleID, exists := r.StyleMap[format.StyleID]
+			if !exists {
+				return fmt.Errorf("conditional format %s: style %d not found", format.Range, format.StyleID)
 			}
-		} else if cell.Value != nil {
-			// Handle different value types
-			switch v := cell.Value.(type) {
-			case float32:
-				r.File.SetCellFloat(sheetName, cell.Address, float64(v), -1, 64)
-			case float64:
-				r.File.SetCellFloat(sheetName, cell.Address, v, -1, 64)
-			case int:
-				r.File.SetCellInt(sheetName, cell.Address, int64(v))
-			case int8:
-				r.File.SetCellInt(sheetName, cell.Address, int64(v))
-			case int16:
-				r.File.SetCellInt(sheetName, cell.Address, int64(v))
-			case int32:
-				r.File.SetCellInt(sheetName, cell.Address, int64(v))
-			case bool:
-				r.File.SetCellBool(sheetName, cell.Address, v)
-			case time.Time:
-				r.File.SetCellValue(sheetName, cell.Address, v)
-			default:
-				// Convert to string
-				strVal := fmt.Sprintf("%v", v)
-				// Try to parse as number
-				if floatVal, err := strconv.ParseFloat(strVal, 64); err == nil {
-					r.File.SetCellFloat(sheetName, cell.Address, floatVal, -1, 64)
-				} else {
-					r.File.SetCellValue(sheetName, cell.Address, strVal)
-				}
+			style, err := r.File.GetStyle(newStyleID)
+			if err != nil {
+				return err
 			}
-		}
-
-		// Apply style
-		if r.Options.PreserveStyles && cell.StyleID != 0 {
-			if newStyleID, exists := r.StyleMap[cell.StyleID]; exists {
-				r.File.SetCellStyle(sheetName, cell.Address, cell.Address, newStyleID)
+			formatID, err := r.File.NewConditionalStyle(style)
+			if err != nil {
+				return err
 			}
+			rule.Format = &formatID
 		}
-
-		// Set hyperlink
-		if cell.Hyperlink != nil {
-			r.File.SetCellHyperLink(sheetName, cell.Address, cell.Hyperlink.Link, "Location")
+		if err := r.File.SetConditionalFormat(sheetName, format.Range, []excelize.ConditionalFormatOptions{rule}); err != nil {
+			return fmt.Errorf("conditional format %s: %w", format.Range, err)
 		}
 	}
-
+	r.warnCapped(sheetName, capped, "conditional format ranges")
 	return nil
 }
 
 func (r *Recreator) recreateDataValidation(sheetName string, dv excelmetadata.DataValidation) error {
+	sqref, err := normalizeSqref(dv.Range)
+	if err != nil {
+		return err
+	}
+
 	validation := &excelize.DataValidation{
 		Type:             dv.Type,
 		Operator:         dv.Operator,
@@ -349,13 +2878,46 @@ func (r *Recreator) recreateDataValidation(sheetName string, dv excelmetadata.Da
 		ShowErrorMessage: dv.ShowError,
 		ErrorTitle:       dv.ErrorTitle,
 		Error:            dv.ErrorMessage,
-		Sqref:            dv.Range,
+		Sqref:            sqref,
 	}
 
 	return r.File.AddDataValidation(sheetName, validation)
 }
 
+// recreateCellValidations adds the data validations of CellOptions, each
+// covering its own cell
+func (r *Recreator) recreateCellValidations(sheetName string) error {
+	cells := r.sheetOptions(sheetName).Cells
+	addresses := make([]string, 0, len(cells))
+	var capped int
+	for address, opts := range cells {
+		if opts == nil || opts.Validation == nil {
+			continue
+		}
+		if !r.Options.cellWithinCap(address) {
+			capped++
+			continue
+		}
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	r.warnCapped(sheetName, capped, "cell validations")
+
+	for _, address := range addresses {
+		dv := *cells[address].Validation
+		dv.Range = address
+		if err := r.recreateDataValidation(sheetName, dv); err != nil {
+			return fmt.Errorf("validation %s: %w", address, err)
+		}
+	}
+	return nil
+}
+
 func (r *Recreator) recreateImage(sheetName string, img *excelmetadata.ImageMetadata) error {
+	if img.Format == nil {
+		img.Format = &excelmetadata.ImageFormat{}
+	}
+
 	picture := &excelize.Picture{
 		Extension: img.Extension,
 		File:      img.File,
@@ -371,22 +2933,113 @@ func (r *Recreator) recreateImage(sheetName string, img *excelmetadata.ImageMeta
 			ScaleX:              img.Format.ScaleX,
 			ScaleY:              img.Format.ScaleY,
 			Hyperlink:           img.Format.Hyperlink,
-			HyperlinkType:       img.Format.HyperlinkType,
+			HyperlinkType:       imageHyperlinkType(img.Format.Hyperlink, img.Format.HyperlinkType),
 			Positioning:         img.Format.Positioning,
 		},
 		InsertType: excelize.PictureInsertType(img.InsertType),
 	}
 
+	// Scale to the target size from the image's natural dimensions
+	cellOpts := r.sheetOptions(sheetName).cellOptions(img.Cell)
+	if cellOpts.ImageWidth > 0 || cellOpts.ImageHeight > 0 {
+		scaleX, scaleY, err := imageScale(img.File, cellOpts.ImageWidth, cellOpts.ImageHeight, img.Format.LockAspectRatio)
+		if err != nil {
+			return fmt.Errorf("failed to scale image at %s: %w", img.Cell, err)
+		}
+		picture.Format.ScaleX, picture.Format.ScaleY = scaleX, scaleY
+	}
+
+	if r.Options.RecompressImages {
+		quality := r.Options.ImageQuality
+		if quality <= 0 {
+			quality = defaultImageQuality
+		}
+		picture.File = recompressImage(img.File, quality)
+	}
+
 	return r.File.AddPictureFromBytes(sheetName, img.Cell, picture)
 }
 
+// imageHyperlinkType returns the "External" or "Location" type excelize needs
+// to write an image hyperlink. Types are matched case-insensitively, and a
+// missing type, which excelize would drop the link for, is inferred from the
+// link: URLs and mailto links are external, others are workbook locations.
+func imageHyperlinkType(link, hyperlinkType string) string {
+	switch {
+	case link == "":
+		return hyperlinkType
+	case strings.EqualFold(hyperlinkType, "External"):
+		return "External"
+	case strings.EqualFold(hyperlinkType, "Location"):
+		return "Location"
+	case strings.Contains(link, "://") || strings.HasPrefix(strings.ToLower(link), "mailto:"):
+		return "External"
+	}
+	return "Location"
+}
+
+// recompressImage re-encodes a JPEG or PNG image, returning the original data
+// for other formats, on failure, or when re-encoding does not make it smaller
+func recompressImage(data []byte, quality int) []byte {
+	decoded, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return data
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, decoded, &jpeg.Options{Quality: min(quality, 100)})
+	case "png":
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, decoded)
+	default:
+		return data
+	}
+	if err != nil || buf.Len() >= len(data) {
+		return data
+	}
+	return buf.Bytes()
+}
+
+// imageScale returns the scale factors that size an image to width by height
+// pixels. A zero dimension, or lockAspect, keeps the aspect ratio.
+func imageScale(data []byte, width, height int, lockAspect bool) (float64, float64, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	if config.Width == 0 || config.Height == 0 {
+		return 0, 0, fmt.Errorf("image has no size")
+	}
+
+	scaleX := float64(width) / float64(config.Width)
+	scaleY := float64(height) / float64(config.Height)
+	switch {
+	case width <= 0:
+		scaleX = scaleY
+	case height <= 0:
+		scaleY = scaleX
+	case lockAspect:
+		scaleX = min(scaleX, scaleY)
+		scaleY = scaleX
+	}
+
+	return scaleX, scaleY, nil
+}
+
 func (r *Recreator) recreateSheetProtection(sheetName string, protection *excelmetadata.SheetProtection) error {
 	editObjects := protection.EditObjects
 	editScenarios := protection.EditScenarios
 	selectLockedCells := protection.SelectLockedCells
 	selectUnlockedCells := protection.SelectUnlockedCells
 
+	algorithm, err := protectionAlgorithm(r.sheetOptions(sheetName).ProtectionAlgorithm)
+	if err != nil {
+		return err
+	}
+
 	opts := &excelize.SheetProtectionOptions{
+		AlgorithmName:       algorithm,
 		Password:            protection.Password,
 		EditObjects:         editObjects,
 		EditScenarios:       editScenarios,
@@ -397,12 +3050,61 @@ func (r *Recreator) recreateSheetProtection(sheetName string, protection *excelm
 	return r.File.ProtectSheet(sheetName, opts)
 }
 
+// protectionAlgorithms are the password hashes of sheet protection, matched
+// case-insensitively. XOR is the legacy hash excelize uses without a name.
+var protectionAlgorithms = []string{"XOR", "MD4", "MD5", "SHA-1", "SHA-256", "SHA-384", "SHA-512"}
+
+// protectionAlgorithm returns the excelize name of a password hash, which is
+// empty for the legacy XOR hash
+func protectionAlgorithm(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	for _, algorithm := range protectionAlgorithms {
+		if strings.EqualFold(name, algorithm) {
+			if algorithm == "XOR" {
+				return "", nil
+			}
+			return algorithm, nil
+		}
+	}
+	return "", fmt.Errorf("protection algorithm %q: %w", name, excelize.ErrUnsupportedHashAlgorithm)
+}
+
+func (r *Recreator) recreateSheetGroup() error {
+	// The active sheet must be part of the group
+	activeSheet := r.File.GetSheetName(r.File.GetActiveSheetIndex())
+	inGroup := false
+	for _, name := range r.Options.SelectedSheets {
+		if strings.EqualFold(name, activeSheet) {
+			inGroup = true
+			break
+		}
+	}
+	if !inGroup {
+		index, err := r.File.GetSheetIndex(r.Options.SelectedSheets[0])
+		if err != nil {
+			return err
+		}
+		if index == -1 {
+			return fmt.Errorf("sheet %s does not exist", r.Options.SelectedSheets[0])
+		}
+		r.File.SetActiveSheet(index)
+	}
+
+	return r.File.GroupSheets(r.Options.SelectedSheets)
+}
+
 func (r *Recreator) recreateDefinedNames() error {
 	for _, name := range r.Metadata.DefinedNames {
+		scope, created := r.definedNameScope(name.Scope)
+		if !created {
+			continue
+		}
 		if err := r.File.SetDefinedName(&excelize.DefinedName{
 			Name:     name.Name,
-			RefersTo: name.RefersTo,
-			Scope:    name.Scope,
+			RefersTo: normalizeFormula(name.RefersTo),
+			Scope:    scope,
 		}); err != nil {
 			return err
 		}
@@ -410,6 +3112,37 @@ func (r *Recreator) recreateDefinedNames() error {
 	return nil
 }
 
+// definedNameScope returns the name a metadata sheet scope was created under,
+// and false when that sheet was not created, such as one skipped by
+// SheetFilter or ContinueOnError. A numeric scope, the sheet index some
+// metadata stores, is translated too; a sheet actually named like the number
+// wins. Other scopes are returned unchanged.
+func (r *Recreator) definedNameScope(scope string) (string, bool) {
+	if scope == "" {
+		return scope, true
+	}
+	position := -1
+	for i, sheet := range r.Metadata.Sheets {
+		if sheet.Name == scope {
+			position = i
+			break
+		}
+	}
+	if index, err := strconv.Atoi(scope); err == nil && position == -1 {
+		for i, sheet := range r.Metadata.Sheets {
+			if sheet.Index == index {
+				position = i
+				break
+			}
+		}
+	}
+	if position == -1 {
+		return scope, true
+	}
+	name, created := r.sheetNames[position]
+	return name, created
+}
+
 // Utility functions
 
 // QuickRecreate recreates an Excel file from metadata with default options
@@ -451,6 +3184,30 @@ func RecreateWithOptions(jsonPath, outputPath string, options *Options) error {
 	return recreator.Save(outputPath)
 }
 
+// RecreateStream decodes one metadata object per line (NDJSON) from reader and
+// recreates each to the path returned by outputFn, without loading the whole
+// stream into memory
+func RecreateStream(reader io.Reader, outputFn func(index int, metadata *excelmetadata.Metadata) (string, error)) error {
+	decoder := json.NewDecoder(reader)
+	for index := 0; ; index++ {
+		var metadata excelmetadata.Metadata
+		if err := decoder.Decode(&metadata); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to decode metadata %d: %w", index, err)
+		}
+
+		outputPath, err := outputFn(index, &metadata)
+		if err != nil {
+			return err
+		}
+
+		if err := QuickRecreate(&metadata, outputPath); err != nil {
+			return fmt.Errorf("failed to recreate metadata %d: %w", index, err)
+		}
+	}
+}
+
 // ValidateMetadata checks if metadata is valid for recreation
 func ValidateMetadata(metadata *excelmetadata.Metadata) []string {
 	var issues []string
@@ -484,7 +3241,116 @@ func ValidateMetadata(metadata *excelmetadata.Metadata) []string {
 				issues = append(issues, fmt.Sprintf("invalid merge end cell: %s", merge.EndCell))
 			}
 		}
+
+		// Check data validation ranges
+		for _, dv := range sheet.DataValidations {
+			if _, err := normalizeSqref(dv.Range); err != nil {
+				issues = append(issues, fmt.Sprintf("invalid data validation range in sheet %s: %v", sheet.Name, err))
+			}
+		}
+
+		// Check overlapping merged cells, parsing each range once
+		coordinates := make([][]int, len(sheet.MergedCells))
+		for j, merge := range sheet.MergedCells {
+			coordinates[j], _ = rangeCoordinates(merge.StartCell + ":" + merge.EndCell)
+		}
+		for j, a := range sheet.MergedCells {
+			for k := j + 1; k < len(sheet.MergedCells); k++ {
+				if rangesOverlap(coordinates[j], coordinates[k]) {
+					b := sheet.MergedCells[k]
+					issues = append(issues, fmt.Sprintf("overlapping merges in sheet %s: %s:%s and %s:%s", sheet.Name, a.StartCell, a.EndCell, b.StartCell, b.EndCell))
+				}
+			}
+		}
 	}
 
 	return issues
 }
+
+// AutoFix repairs recoverable metadata issues in place and returns a
+// description of each fix. Unnamed sheets are given a default name, and cells
+// or merged cells with invalid addresses are dropped.
+func AutoFix(metadata *excelmetadata.Metadata, options *Options) []string {
+	var fixes []string
+
+	if metadata == nil {
+		return fixes
+	}
+	if options == nil {
+		options = DefaultOptions()
+	}
+
+	names := make(map[string]bool)
+	for _, sheet := range metadata.Sheets {
+		if sheet.Name != "" {
+			names[strings.ToLower(sheet.Name)] = true
+		}
+	}
+
+	for i := range metadata.Sheets {
+		sheet := &metadata.Sheets[i]
+
+		if sheet.Name == "" {
+			name := uniqueSheetName(options.unnamedSheetName(sheet.Index), func(name string) bool {
+				return names[strings.ToLower(name)]
+			})
+			names[strings.ToLower(name)] = true
+			sheet.Name = name
+			fixes = append(fixes, fmt.Sprintf("sheet %d named %s", i, name))
+		}
+
+		cells := sheet.Cells[:0]
+		for _, cell := range sheet.Cells {
+			if _, _, err := excelize.CellNameToCoordinates(cell.Address); err != nil {
+				fixes = append(fixes, fmt.Sprintf("removed cell with invalid address %q from sheet %s", cell.Address, sheet.Name))
+				continue
+			}
+			cells = append(cells, cell)
+		}
+		sheet.Cells = cells
+
+		merges := sheet.MergedCells[:0]
+		for _, merge := range sheet.MergedCells {
+			_, _, startErr := excelize.CellNameToCoordinates(merge.StartCell)
+			_, _, endErr := excelize.CellNameToCoordinates(merge.EndCell)
+			if startErr != nil || endErr != nil {
+				fixes = append(fixes, fmt.Sprintf("removed invalid merge %s:%s from sheet %s", merge.StartCell, merge.EndCell, sheet.Name))
+				continue
+			}
+			merges = append(merges, merge)
+		}
+		sheet.MergedCells = merges
+	}
+
+	return fixes
+}
+
+// RecreateReport summarizes a SafeRecreate run
+type RecreateReport struct {
+	Issues    []string // Validation issues found before fixing
+	Fixed     []string // Fixes applied by AutoFix
+	Remaining []string // Validation issues left after fixing
+}
+
+// SafeRecreate validates the metadata, fixes recoverable issues in place with
+// AutoFix, then recreates and saves the Excel file
+func SafeRecreate(metadata *excelmetadata.Metadata, outputPath string, options *Options) (RecreateReport, error) {
+	var report RecreateReport
+
+	if metadata == nil {
+		return report, fmt.Errorf("metadata is nil")
+	}
+
+	report.Issues = ValidateMetadata(metadata)
+	if len(report.Issues) > 0 {
+		report.Fixed = AutoFix(metadata, options)
+		report.Remaining = ValidateMetadata(metadata)
+	}
+
+	recreator := New(metadata, options)
+	if err := recreator.Recreate(); err != nil {
+		return report, err
+	}
+
+	return report, recreator.Save(outputPath)
+}
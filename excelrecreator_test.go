@@ -0,0 +1,4513 @@
+package excelrecreator
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prongbang/excelmetadata"
+	"github.com/xuri/excelize/v2"
+)
+
+// newSheet returns a visible sheet metadata with the given cells
+func newSheet(index int, name string, cells ...excelmetadata.CellMetadata) excelmetadata.SheetMetadata {
+	return excelmetadata.SheetMetadata{Index: index, Name: name, Visible: true, Cells: cells}
+}
+
+// newCell returns the metadata of a cell holding value
+func newCell(address string, value interface{}) excelmetadata.CellMetadata {
+	return excelmetadata.CellMetadata{Address: address, Value: value}
+}
+
+// recreate runs Recreate and fails the test on error
+func recreate(t *testing.T, metadata *excelmetadata.Metadata, options *Options) *Recreator {
+	t.Helper()
+	r := New(metadata, options)
+	if err := r.Recreate(); err != nil {
+		t.Fatalf("Recreate() error = %v", err)
+	}
+	return r
+}
+
+// hasWarning reports whether Recreate reported a warning with code
+func hasWarning(r *Recreator, code string) bool {
+	for _, w := range r.Warnings() {
+		if w.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// getCellValue returns a cell's value, failing the test on error
+func getCellValue(t *testing.T, r *Recreator, sheetName, address string) string {
+	t.Helper()
+	value, err := r.File.GetCellValue(sheetName, address)
+	if err != nil {
+		t.Fatalf("GetCellValue(%s, %s) error = %v", sheetName, address, err)
+	}
+	return value
+}
+
+// partXML returns the XML of a part of the written workbook, such as
+// "xl/workbook.xml"
+func partXML(t *testing.T, f *excelize.File, name string) string {
+	t.Helper()
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range reader.File {
+		if file.Name == name {
+			data, err := readZipFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(data)
+		}
+	}
+	t.Fatalf("part %s not found", name)
+	return ""
+}
+
+// newPNG returns a PNG image of the given size
+func newPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDeleteDefaultSheet(t *testing.T) {
+	tests := []struct {
+		name   string
+		sheets []excelmetadata.SheetMetadata
+		want   []string
+	}{
+		{
+			name:   "metadata sheet named Sheet1 is kept",
+			sheets: []excelmetadata.SheetMetadata{newSheet(0, "Sheet1", newCell("A1", "keep"))},
+			want:   []string{"Sheet1"},
+		},
+		{
+			// excelize reuses the default sheet for a name differing in case
+			name:   "metadata sheet named sheet1 in another case is kept",
+			sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data"), newSheet(1, "SHEET1")},
+			want:   []string{"Sheet1", "Data"},
+		},
+		{
+			name:   "default sheet is removed",
+			sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data")},
+			want:   []string{"Data"},
+		},
+		{
+			name: "default sheet is kept without recreated sheets",
+			want: []string{"Sheet1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := recreate(t, &excelmetadata.Metadata{Sheets: tt.sheets}, nil)
+			got := r.File.GetSheetList()
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("sheets = %v, want %v", got, tt.want)
+			}
+			if tt.sheets != nil && tt.sheets[0].Name == "Sheet1" {
+				if value := getCellValue(t, r, "Sheet1", "A1"); value != "keep" {
+					t.Errorf("Sheet1!A1 = %q, want %q", value, "keep")
+				}
+			}
+
+			// A second call deletes nothing more
+			r.deleteDefaultSheet()
+			if count := len(r.File.GetSheetList()); count != len(tt.want) {
+				t.Errorf("sheet count after second delete = %d, want %d", count, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestRecreateStylesFontScheme(t *testing.T) {
+	tests := []struct {
+		name        string
+		font        *excelmetadata.FontStyle
+		wantFamily  string
+		wantWarning bool
+	}{
+		{name: "theme font uses the default font", font: &excelmetadata.FontStyle{Size: 11}, wantFamily: "Calibri", wantWarning: true},
+		{name: "explicit family is kept", font: &excelmetadata.FontStyle{Family: "Arial", Size: 11}, wantFamily: "Arial"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := &excelmetadata.Metadata{
+				Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", excelmetadata.CellMetadata{Address: "A1", Value: "x", StyleID: 1})},
+				Styles: map[int]excelmetadata.StyleDetails{1: {Font: tt.font}},
+			}
+			r := recreate(t, metadata, nil)
+			if got := hasWarning(r, WarningFontScheme); got != tt.wantWarning {
+				t.Errorf("fontScheme warning = %v, want %v", got, tt.wantWarning)
+			}
+			style, err := r.File.GetStyle(r.StyleMap[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			family := style.Font.Family
+			if family == "" {
+				if family, err = r.File.GetDefaultFont(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if family != tt.wantFamily {
+				t.Errorf("font family = %q, want %q", family, tt.wantFamily)
+			}
+		})
+	}
+}
+
+func TestRecreateStylesFontSchemeWarnedOnce(t *testing.T) {
+	tests := []struct {
+		name        string
+		familyless  int
+		withFamily  int
+		wantWarning string
+	}{
+		{name: "every font has a family", withFamily: 3},
+		{name: "one font without a family", familyless: 1, withFamily: 2, wantWarning: "1 styles"},
+		{name: "many fonts without a family", familyless: 50, withFamily: 5, wantWarning: "50 styles"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			styles := make(map[int]excelmetadata.StyleDetails)
+			for i := 0; i < tt.familyless; i++ {
+				styles[len(styles)+1] = excelmetadata.StyleDetails{Font: &excelmetadata.FontStyle{Size: float64(8 + i)}}
+			}
+			for i := 0; i < tt.withFamily; i++ {
+				styles[len(styles)+1] = excelmetadata.StyleDetails{Font: &excelmetadata.FontStyle{Family: "Arial", Size: float64(8 + i)}}
+			}
+			metadata := &excelmetadata.Metadata{
+				Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("A1", "x"))},
+				Styles: styles,
+			}
+			r := recreate(t, metadata, nil)
+
+			var messages []string
+			for _, w := range r.Warnings() {
+				if w.Code == WarningFontScheme {
+					messages = append(messages, w.Message)
+				}
+			}
+			if tt.wantWarning == "" {
+				if len(messages) != 0 {
+					t.Fatalf("fontScheme warnings = %q, want none", messages)
+				}
+				return
+			}
+			if len(messages) != 1 || !strings.Contains(messages[0], tt.wantWarning) {
+				t.Fatalf("fontScheme warnings = %q, want one containing %q", messages, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestDeduplicateStyles(t *testing.T) {
+	bold := excelmetadata.StyleDetails{Font: &excelmetadata.FontStyle{Bold: true, Family: "Arial"}}
+	italic := excelmetadata.StyleDetails{Font: &excelmetadata.FontStyle{Italic: true, Family: "Arial"}}
+
+	tests := []struct {
+		name       string
+		styles     map[int]excelmetadata.StyleDetails
+		wantStyles int
+	}{
+		{name: "three identical styles", styles: map[int]excelmetadata.StyleDetails{1: bold, 2: bold, 3: bold}, wantStyles: 1},
+		{name: "identical and distinct styles", styles: map[int]excelmetadata.StyleDetails{1: bold, 2: bold, 3: italic}, wantStyles: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data")}, Styles: tt.styles}
+			options := DefaultOptions()
+			options.DeduplicateStyles = true
+			r := recreate(t, metadata, options)
+
+			ids := make(map[int]bool)
+			for _, newID := range r.StyleMap {
+				ids[newID] = true
+			}
+			if len(r.StyleMap) != len(tt.styles) {
+				t.Errorf("style map has %d entries, want %d", len(r.StyleMap), len(tt.styles))
+			}
+			if len(ids) != tt.wantStyles {
+				t.Errorf("created %d styles, want %d", len(ids), tt.wantStyles)
+			}
+		})
+	}
+}
+
+func TestAppProps(t *testing.T) {
+	tests := []struct {
+		name     string
+		appProps *excelize.AppProperties
+		want     string
+	}{
+		{name: "company is set", appProps: &excelize.AppProperties{Company: "Acme", Application: "Report Builder"}, want: "Acme"},
+		{name: "no app properties", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.AppProps = tt.appProps
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data")}}, options)
+
+			props, err := r.File.GetAppProps()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if props.Company != tt.want {
+				t.Errorf("Company = %q, want %q", props.Company, tt.want)
+			}
+			if tt.appProps != nil && props.Application != tt.appProps.Application {
+				t.Errorf("Application = %q, want %q", props.Application, tt.appProps.Application)
+			}
+		})
+	}
+}
+
+func TestAutoFix(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   *Options
+		sheets    []excelmetadata.SheetMetadata
+		wantNames []string
+		wantFixes int
+	}{
+		{
+			name:      "unnamed sheet gets the default name",
+			sheets:    []excelmetadata.SheetMetadata{newSheet(0, ""), newSheet(1, "Data")},
+			wantNames: []string{"Sheet1", "Data"},
+			wantFixes: 1,
+		},
+		{
+			name:      "empty default name falls back to Sheet",
+			options:   &Options{},
+			sheets:    []excelmetadata.SheetMetadata{newSheet(0, ""), newSheet(1, "")},
+			wantNames: []string{"Sheet1", "Sheet2"},
+			wantFixes: 2,
+		},
+		{
+			name:      "taken name is numbered",
+			sheets:    []excelmetadata.SheetMetadata{newSheet(0, ""), newSheet(1, "sheet1")},
+			wantNames: []string{"Sheet1 (2)", "sheet1"},
+			wantFixes: 1,
+		},
+		{
+			name:      "numbered names skip taken suffixes",
+			sheets:    []excelmetadata.SheetMetadata{newSheet(0, ""), newSheet(1, "Sheet1"), newSheet(2, "Sheet1 (2)")},
+			wantNames: []string{"Sheet1 (3)", "Sheet1", "Sheet1 (2)"},
+			wantFixes: 1,
+		},
+		{
+			name:      "template names unnamed sheets",
+			options:   &Options{SheetNameTemplate: "Data_%02d"},
+			sheets:    []excelmetadata.SheetMetadata{newSheet(0, "")},
+			wantNames: []string{"Data_01"},
+			wantFixes: 1,
+		},
+		{
+			name: "invalid cells and merges are removed",
+			sheets: []excelmetadata.SheetMetadata{{
+				Name:        "Data",
+				Cells:       []excelmetadata.CellMetadata{newCell("A1", 1), newCell("1A", 2)},
+				MergedCells: []excelmetadata.MergedCell{{StartCell: "A1", EndCell: "B2"}, {StartCell: "A1", EndCell: "??"}},
+			}},
+			wantNames: []string{"Data"},
+			wantFixes: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := &excelmetadata.Metadata{Sheets: tt.sheets}
+			fixes := AutoFix(metadata, tt.options)
+			if len(fixes) != tt.wantFixes {
+				t.Errorf("fixes = %v, want %d", fixes, tt.wantFixes)
+			}
+			for i, sheet := range metadata.Sheets {
+				if sheet.Name != tt.wantNames[i] {
+					t.Errorf("sheet %d name = %q, want %q", i, sheet.Name, tt.wantNames[i])
+				}
+			}
+			if issues := ValidateMetadata(metadata); len(issues) > 0 {
+				t.Errorf("issues after AutoFix = %v", issues)
+			}
+		})
+	}
+}
+
+func TestUniqueSheetName(t *testing.T) {
+	long := strings.Repeat("x", 31)
+
+	tests := []struct {
+		name  string
+		sheet string
+		taken []string
+		want  string
+	}{
+		{name: "free name kept", sheet: "Data", taken: []string{"Other"}, want: "Data"},
+		{name: "taken name numbered", sheet: "Data", taken: []string{"Data"}, want: "Data (2)"},
+		{name: "taken suffix skipped", sheet: "Data", taken: []string{"Data", "Data (2)"}, want: "Data (3)"},
+		{name: "long name cut to fit", sheet: long, taken: []string{long}, want: long[:27] + " (2)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := uniqueSheetName(tt.sheet, func(name string) bool { return slices.Contains(tt.taken, name) })
+			if got != tt.want {
+				t.Errorf("uniqueSheetName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSafeRecreate(t *testing.T) {
+	metadata := &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{
+		newSheet(0, "", newCell("A1", "kept"), newCell("A0", "dropped")),
+	}}
+	output := filepath.Join(t.TempDir(), "out.xlsx")
+
+	report, err := SafeRecreate(metadata, output, nil)
+	if err != nil {
+		t.Fatalf("SafeRecreate() error = %v", err)
+	}
+	if len(report.Issues) != 2 || len(report.Fixed) != 2 || len(report.Remaining) != 0 {
+		t.Errorf("report = %+v, want 2 issues fixed", report)
+	}
+
+	f, err := excelize.OpenFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if value, err := f.GetCellValue("Sheet1", "A1"); err != nil || value != "kept" {
+		t.Errorf("Sheet1!A1 = %q, %v, want %q", value, err, "kept")
+	}
+}
+
+func TestSelectedSheets(t *testing.T) {
+	tests := []struct {
+		name       string
+		selected   []string
+		wantActive string
+		wantErr    bool
+	}{
+		{name: "group includes the active sheet", selected: []string{"A", "B"}, wantActive: "A"},
+		{name: "active sheet moves into the group", selected: []string{"B", "C"}, wantActive: "B"},
+		{name: "missing sheet fails", selected: []string{"B", "Missing"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "A"), newSheet(1, "B"), newSheet(2, "C")}}
+			options := DefaultOptions()
+			options.SelectedSheets = tt.selected
+			r := New(metadata, options)
+			err := r.Recreate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Recreate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if active := r.File.GetSheetName(r.File.GetActiveSheetIndex()); active != tt.wantActive {
+				t.Errorf("active sheet = %s, want %s", active, tt.wantActive)
+			}
+			for id, name := range r.File.GetSheetMap() {
+				xml := partXML(t, r.File, fmt.Sprintf("xl/worksheets/sheet%d.xml", id))
+				selected := strings.Contains(xml, `tabSelected="true"`) || strings.Contains(xml, `tabSelected="1"`)
+				if want := slices.Contains(tt.selected, name); selected != want {
+					t.Errorf("sheet %s selected = %v, want %v", name, selected, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRecreateCellErrorContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		cell    excelmetadata.CellMetadata
+		options func(*Options)
+		want    string
+	}{
+		{
+			name: "formula at an invalid address",
+			cell: excelmetadata.CellMetadata{Address: "XFE1", Formula: "=1+1"},
+			want: "sheet Data cell XFE1",
+		},
+		{
+			name: "value at an invalid address",
+			cell: newCell("A0", 1.5),
+			want: "sheet Data cell A0",
+		},
+		{
+			name: "string over the cell limit",
+			cell: newCell("B2", strings.Repeat("x", excelize.TotalCellChars+1)),
+			options: func(o *Options) {
+				o.LongStringPolicy = LongStringError
+			},
+			want: "sheet Data cell B2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			if tt.options != nil {
+				tt.options(options)
+			}
+			r := New(&excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", tt.cell)}}, options)
+			err := r.Recreate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Recreate() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRowHeightAndStyle(t *testing.T) {
+	for _, flush := range []bool{false, true} {
+		t.Run(fmt.Sprintf("FlushPerSheet=%v", flush), func(t *testing.T) {
+			sheet := newSheet(0, "Data", newCell("A1", "header"))
+			sheet.RowHeights = map[int]float64{2: 30}
+			metadata := &excelmetadata.Metadata{
+				Sheets: []excelmetadata.SheetMetadata{sheet},
+				Styles: map[int]excelmetadata.StyleDetails{
+					1: {Fill: &excelmetadata.FillStyle{Type: "pattern", Pattern: 1, Color: []string{"#FFFF00"}}},
+				},
+			}
+			options := DefaultOptions()
+			options.FlushPerSheet = flush
+			options.Sheets = map[string]*SheetOptions{"Data": {RowStyles: map[int]int{2: 1}}}
+			r := recreate(t, metadata, options)
+
+			height, err := r.File.GetRowHeight("Data", 2)
+			if err != nil || height != 30 {
+				t.Errorf("row 2 height = %v, %v, want 30", height, err)
+			}
+			row := regexp.MustCompile(`<row r="2"[^>]*>`).FindString(partXML(t, r.File, "xl/worksheets/sheet2.xml"))
+			if want := fmt.Sprintf(`s="%d"`, r.StyleMap[1]); !strings.Contains(row, want) {
+				t.Errorf("row 2 = %s, want style %s", row, want)
+			}
+		})
+	}
+}
+
+func TestWorkbookProtection(t *testing.T) {
+	tests := []struct {
+		name       string
+		protection *excelize.WorkbookProtectionOptions
+		want       []string
+	}{
+		{
+			name:       "structure locked with a password",
+			protection: &excelize.WorkbookProtectionOptions{LockStructure: true, Password: "secret"},
+			want:       []string{`lockStructure="true"`, `workbookHashValue=`},
+		},
+		{
+			name:       "windows locked",
+			protection: &excelize.WorkbookProtectionOptions{LockWindows: true},
+			want:       []string{`lockWindows="true"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.WorkbookProtection = tt.protection
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data")}}, options)
+
+			xml := regexp.MustCompile(`<workbookProtection[^>]*>`).FindString(partXML(t, r.File, "xl/workbook.xml"))
+			for _, want := range tt.want {
+				if !strings.Contains(xml, want) {
+					t.Errorf("workbook protection = %q, want %s", xml, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCellFillColor(t *testing.T) {
+	tests := []struct {
+		name     string
+		styleID  int
+		color    string
+		wantBold bool
+	}{
+		{name: "unstyled cell", color: "#FFFF00"},
+		{name: "fill merged into the cell style", styleID: 1, color: "ffff00", wantBold: true},
+		{name: "short color", color: "#FF0", wantBold: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := &excelmetadata.Metadata{
+				Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data",
+					excelmetadata.CellMetadata{Address: "A1", Value: "x", StyleID: tt.styleID},
+					excelmetadata.CellMetadata{Address: "A2", Value: "y", StyleID: tt.styleID},
+				)},
+				Styles: map[int]excelmetadata.StyleDetails{1: {Font: &excelmetadata.FontStyle{Bold: true, Family: "Arial"}}},
+			}
+			options := DefaultOptions()
+			options.Sheets = map[string]*SheetOptions{"Data": {Cells: map[string]*CellOptions{
+				"A1": {FillColor: tt.color},
+				"A2": {FillColor: tt.color},
+			}}}
+			r := recreate(t, metadata, options)
+
+			styleID, err := r.File.GetCellStyle("Data", "A1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if other, _ := r.File.GetCellStyle("Data", "A2"); other != styleID {
+				t.Errorf("A2 style = %d, want the cached style %d", other, styleID)
+			}
+			style, err := r.File.GetStyle(styleID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if style.Fill.Pattern != 1 || len(style.Fill.Color) != 1 || style.Fill.Color[0] != "FFFF00" {
+				t.Errorf("fill = %+v, want solid FFFF00", style.Fill)
+			}
+			if bold := style.Font != nil && style.Font.Bold; bold != tt.wantBold {
+				t.Errorf("bold = %v, want %v", bold, tt.wantBold)
+			}
+		})
+	}
+}
+
+func TestRecreateStream(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantFiles int
+		wantErr   bool
+	}{
+		{
+			name: "two workbooks",
+			input: `{"sheets":[{"name":"One","visible":true,"cells":[{"address":"A1","value":"first"}]}]}
+{"sheets":[{"name":"Two","visible":true,"cells":[{"address":"A1","value":"second"}]}]}
+`,
+			wantFiles: 2,
+		},
+		{name: "empty stream"},
+		{
+			name:      "invalid line after a valid one",
+			input:     `{"sheets":[{"name":"One","visible":true}]}` + "\n{not json}\n",
+			wantFiles: 1,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := RecreateStream(strings.NewReader(tt.input), func(index int, metadata *excelmetadata.Metadata) (string, error) {
+				return filepath.Join(dir, fmt.Sprintf("%d_%s.xlsx", index, metadata.Sheets[0].Name)), nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RecreateStream() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			files, _ := filepath.Glob(filepath.Join(dir, "*.xlsx"))
+			if len(files) != tt.wantFiles {
+				t.Errorf("wrote %v, want %d files", files, tt.wantFiles)
+			}
+			if tt.wantFiles == 2 {
+				f, err := excelize.OpenFile(filepath.Join(dir, "1_Two.xlsx"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				if value, _ := f.GetCellValue("Two", "A1"); value != "second" {
+					t.Errorf("Two!A1 = %q, want %q", value, "second")
+				}
+			}
+		})
+	}
+}
+
+func TestTreatEmptyStringAsEmpty(t *testing.T) {
+	tests := []struct {
+		name     string
+		option   bool
+		wantType excelize.CellType
+	}{
+		{name: "empty string is an empty cell", option: true, wantType: excelize.CellTypeUnset},
+		{name: "empty string is text", option: false, wantType: excelize.CellTypeSharedString},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.TreatEmptyStringAsEmpty = tt.option
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("A1", ""))}}, options)
+
+			cellType, err := r.File.GetCellType("Data", "A1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cellType != tt.wantType {
+				t.Errorf("A1 type = %v, want %v", cellType, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestDefinedNamesSpillRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		refersTo string
+		want     string
+	}{
+		{name: "spill range", refersTo: "=Data!$A$1#", want: "Data!$A$1#"},
+		{name: "spill range in a function", refersTo: "SUM(Data!$B$2#)", want: "SUM(Data!$B$2#)"},
+		{name: "plain range", refersTo: "=Data!$A$1:$A$5", want: "Data!$A$1:$A$5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := &excelmetadata.Metadata{
+				Sheets:       []excelmetadata.SheetMetadata{newSheet(0, "Data")},
+				DefinedNames: []excelmetadata.DefinedName{{Name: "Results", RefersTo: tt.refersTo}},
+			}
+			r := recreate(t, metadata, nil)
+
+			names := r.File.GetDefinedName()
+			if len(names) != 1 || names[0].RefersTo != tt.want {
+				t.Errorf("defined names = %+v, want Results referring to %s", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimCellWhitespace(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		trim      bool
+		wantType  excelize.CellType
+		wantValue string
+	}{
+		{name: "whitespace-only value is skipped", value: "   ", trim: true, wantType: excelize.CellTypeUnset},
+		{name: "value is trimmed", value: "  text ", trim: true, wantType: excelize.CellTypeSharedString, wantValue: "text"},
+		{name: "whitespace is kept without the option", value: "   ", wantType: excelize.CellTypeSharedString, wantValue: "   "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.TrimCellWhitespace = tt.trim
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("A1", tt.value))}}, options)
+
+			if cellType, _ := r.File.GetCellType("Data", "A1"); cellType != tt.wantType {
+				t.Errorf("A1 type = %v, want %v", cellType, tt.wantType)
+			}
+			if value := getCellValue(t, r, "Data", "A1"); value != tt.wantValue {
+				t.Errorf("A1 = %q, want %q", value, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestSpillRange(t *testing.T) {
+	tests := []struct {
+		name       string
+		spillRange string
+		wantValues []string
+	}{
+		{name: "spilled values are skipped", spillRange: "A1:A3", wantValues: []string{"", "", "x"}},
+		{name: "values are written without a spill range", wantValues: []string{"2", "3", "x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data",
+				excelmetadata.CellMetadata{Address: "A1", Formula: "=SEQUENCE(3)", Value: 1.0},
+				newCell("A2", 2.0), newCell("A3", 3.0), newCell("A4", "x"),
+			)}}
+			options := DefaultOptions()
+			if tt.spillRange != "" {
+				options.Sheets = map[string]*SheetOptions{"Data": {Cells: map[string]*CellOptions{"A1": {SpillRange: tt.spillRange}}}}
+			}
+			r := recreate(t, metadata, options)
+
+			if formula, _ := r.File.GetCellFormula("Data", "A1"); formula != "SEQUENCE(3)" {
+				t.Errorf("A1 formula = %q, want SEQUENCE(3)", formula)
+			}
+			for i, want := range tt.wantValues {
+				address := fmt.Sprintf("A%d", i+2)
+				if got := getCellValue(t, r, "Data", address); got != want {
+					t.Errorf("%s = %q, want %q", address, got, want)
+				}
+			}
+			isArray := strings.Contains(partXML(t, r.File, "xl/worksheets/sheet2.xml"), `t="array" ref="A1:A3"`)
+			if want := tt.spillRange != ""; isArray != want {
+				t.Errorf("array formula = %v, want %v", isArray, want)
+			}
+		})
+	}
+}
+
+func TestStripDocumentProperties(t *testing.T) {
+	tests := []struct {
+		name        string
+		strip       bool
+		wantCreator string
+		wantTitle   string
+	}{
+		{name: "properties are stripped", strip: true},
+		{name: "properties are kept", wantCreator: "Jane", wantTitle: "Budget"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := &excelmetadata.Metadata{
+				Properties: excelmetadata.DocumentProperties{Creator: "Jane", Title: "Budget", LastModifiedBy: "Jane"},
+				Sheets:     []excelmetadata.SheetMetadata{newSheet(0, "Data")},
+			}
+			options := DefaultOptions()
+			options.StripDocumentProperties = tt.strip
+			r := recreate(t, metadata, options)
+
+			props, err := r.File.GetDocProps()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if props.Creator != tt.wantCreator || props.Title != tt.wantTitle {
+				t.Errorf("creator, title = %q, %q, want %q, %q", props.Creator, props.Title, tt.wantCreator, tt.wantTitle)
+			}
+			if tt.strip && props.LastModifiedBy != "" {
+				t.Errorf("stripped properties = %+v, want none", props)
+			}
+		})
+	}
+}
+
+func TestPatternFillColors(t *testing.T) {
+	tests := []struct {
+		name   string
+		fill   *excelmetadata.FillStyle
+		wantFg string
+		wantBg string
+	}{
+		{
+			name:   "striped fill with two colors",
+			fill:   &excelmetadata.FillStyle{Type: "pattern", Pattern: 6, Color: []string{"#FF0000", "#0000FF"}},
+			wantFg: "FFFF0000",
+			wantBg: "FF0000FF",
+		},
+		{
+			name:   "solid fill with one color",
+			fill:   &excelmetadata.FillStyle{Type: "pattern", Pattern: 1, Color: []string{"#FF0000"}},
+			wantFg: "FFFF0000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Style 2 shares the foreground, and must keep no background
+			metadata := &excelmetadata.Metadata{
+				Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data",
+					excelmetadata.CellMetadata{Address: "A1", Value: "x", StyleID: 1},
+					excelmetadata.CellMetadata{Address: "A2", Value: "y", StyleID: 2},
+				)},
+				Styles: map[int]excelmetadata.StyleDetails{
+					1: {Fill: tt.fill},
+					2: {Fill: &excelmetadata.FillStyle{Type: "pattern", Pattern: tt.fill.Pattern, Color: tt.fill.Color[:1]}},
+				},
+			}
+			r := recreate(t, metadata, nil)
+
+			fills := r.File.Styles.Fills.Fill
+			fill := fills[*r.File.Styles.CellXfs.Xf[r.StyleMap[1]].FillID].PatternFill
+			if fill.FgColor == nil || fill.FgColor.RGB != tt.wantFg {
+				t.Errorf("foreground = %+v, want %s", fill.FgColor, tt.wantFg)
+			}
+			bg := ""
+			if fill.BgColor != nil {
+				bg = fill.BgColor.RGB
+			}
+			if bg != tt.wantBg {
+				t.Errorf("background = %q, want %q", bg, tt.wantBg)
+			}
+			if other := fills[*r.File.Styles.CellXfs.Xf[r.StyleMap[2]].FillID].PatternFill; other.BgColor != nil {
+				t.Errorf("style 2 background = %+v, want none", other.BgColor)
+			}
+
+			// The background is written to the stylesheet
+			if tt.wantBg != "" && !strings.Contains(partXML(t, r.File, "xl/styles.xml"), `<bgColor rgb="`+tt.wantBg+`"`) {
+				t.Errorf("styles.xml has no background color %s", tt.wantBg)
+			}
+		})
+	}
+}
+
+func TestImageScale(t *testing.T) {
+	data := newPNG(t, 200, 50)
+
+	tests := []struct {
+		name          string
+		width, height int
+		lockAspect    bool
+		wantX, wantY  float64
+		wantErr       bool
+		data          []byte
+	}{
+		{name: "width only keeps the aspect ratio", width: 100, wantX: 0.5, wantY: 0.5},
+		{name: "height only keeps the aspect ratio", height: 100, wantX: 2, wantY: 2},
+		{name: "both stretch", width: 100, height: 100, wantX: 0.5, wantY: 2},
+		{name: "both with a locked aspect ratio fit inside", width: 100, height: 100, lockAspect: true, wantX: 0.5, wantY: 0.5},
+		{name: "not an image", width: 100, data: []byte("text"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := data
+			if tt.data != nil {
+				img = tt.data
+			}
+			x, y, err := imageScale(img, tt.width, tt.height, tt.lockAspect)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("imageScale() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if x != tt.wantX || y != tt.wantY {
+				t.Errorf("imageScale() = %v, %v, want %v, %v", x, y, tt.wantX, tt.wantY)
+			}
+		})
+	}
+}
+
+func TestRecreateImageTargetSize(t *testing.T) {
+	sheet := newSheet(0, "Data")
+	sheet.Images = []excelmetadata.ImageMetadata{{Cell: "B2", File: newPNG(t, 200, 50), Extension: ".png"}}
+	options := DefaultOptions()
+	options.Sheets = map[string]*SheetOptions{"Data": {Cells: map[string]*CellOptions{"B2": {ImageWidth: 100}}}}
+	r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{sheet}}, options)
+
+	// A 100 by 25 pixel image at B2 ends 36 pixels into the 64 pixel wide
+	// column C and 5 pixels into the 20 pixel high row 3, at 9525 EMU per pixel
+	want := `<xdr:to><xdr:col>2</xdr:col><xdr:colOff>342900</xdr:colOff><xdr:row>2</xdr:row><xdr:rowOff>47625</xdr:rowOff></xdr:to>`
+	if drawing := partXML(t, r.File, "xl/drawings/drawing1.xml"); !strings.Contains(drawing, want) {
+		t.Errorf("drawing = %s, want a 100 by 25 pixel image", drawing)
+	}
+}
+
+func TestDumpStyles(t *testing.T) {
+	metadata := &excelmetadata.Metadata{
+		Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", excelmetadata.CellMetadata{Address: "A1", Value: "x", StyleID: 1})},
+		Styles: map[int]excelmetadata.StyleDetails{
+			1: {Font: &excelmetadata.FontStyle{Bold: true, Family: "Arial"}},
+			2: {NumberFormat: 4},
+		},
+	}
+	options := DefaultOptions()
+	options.Sheets = map[string]*SheetOptions{"Data": {Cells: map[string]*CellOptions{"A1": {FillColor: "#00FF00"}}}}
+	r := recreate(t, metadata, options)
+
+	styles := r.DumpStyles()
+	fillStyleID, err := r.File.GetCellStyle("Data", "A1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		styleID int
+		check   func(excelize.Style) bool
+	}{
+		{name: "bold style", styleID: r.StyleMap[1], check: func(s excelize.Style) bool { return s.Font != nil && s.Font.Bold }},
+		{name: "number format style", styleID: r.StyleMap[2], check: func(s excelize.Style) bool { return s.NumFmt == 4 }},
+		{name: "derived fill style", styleID: fillStyleID, check: func(s excelize.Style) bool { return s.Font != nil && s.Font.Bold && len(s.Fill.Color) == 1 }},
+	}
+
+	if len(styles) != 3 {
+		t.Errorf("dumped %d styles, want 3", len(styles))
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			style, exists := styles[tt.styleID]
+			if !exists {
+				t.Fatalf("style %d not dumped", tt.styleID)
+			}
+			if !tt.check(style) {
+				t.Errorf("style %d = %+v", tt.styleID, style)
+			}
+		})
+	}
+}
+
+func TestPreserveRTL(t *testing.T) {
+	tests := []struct {
+		name        string
+		preserveRTL bool
+		rightToLeft bool
+		want        bool
+	}{
+		{name: "right-to-left sheet", preserveRTL: true, rightToLeft: true, want: true},
+		{name: "option off by default", rightToLeft: true, want: false},
+		{name: "left-to-right sheet", preserveRTL: true, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.PreserveRTL = tt.preserveRTL
+			options.Sheets = map[string]*SheetOptions{"Data": {
+				RightToLeft: tt.rightToLeft,
+				Panes:       &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"},
+			}}
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("A1", "header"))}}, options)
+
+			// Reopen to check the flag round-trips through the file
+			buf, err := r.File.WriteToBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := excelize.OpenReader(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			view, err := f.GetSheetView("Data", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := view.RightToLeft != nil && *view.RightToLeft; got != tt.want {
+				t.Errorf("right-to-left = %v, want %v", got, tt.want)
+			}
+			if panes, err := f.GetPanes("Data"); err != nil || !panes.Freeze || panes.YSplit != 1 {
+				t.Errorf("panes = %+v, %v, want the header row frozen", panes, err)
+			}
+		})
+	}
+}
+
+func TestResolveMergeConflicts(t *testing.T) {
+	merges := []excelmetadata.MergedCell{
+		{StartCell: "A1", EndCell: "C1"},
+		{StartCell: "B1", EndCell: "D2"},
+		{StartCell: "F1", EndCell: "G1"},
+	}
+
+	tests := []struct {
+		name   string
+		policy MergeConflictPolicy
+		want   []string
+	}{
+		{name: "no policy", want: []string{"A1:C1", "B1:D2", "F1:G1"}},
+		{name: "skip", policy: MergeConflictSkip, want: []string{"F1:G1"}},
+		{name: "keep first", policy: MergeConflictKeepFirst, want: []string{"A1:C1", "F1:G1"}},
+		{name: "keep largest", policy: MergeConflictKeepLargest, want: []string{"B1:D2", "F1:G1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, merge := range resolveMergeConflicts(merges, tt.policy) {
+				got = append(got, merge.StartCell+":"+merge.EndCell)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("merges = %v, want %v", got, tt.want)
+			}
+
+			// The workbook carries the same merges; without a policy excelize
+			// itself decides what overlapping merges become
+			if tt.policy == "" {
+				return
+			}
+			sheet := newSheet(0, "Data")
+			sheet.MergedCells = merges
+			options := DefaultOptions()
+			options.MergeConflictPolicy = tt.policy
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{sheet}}, options)
+			cells, err := r.File.GetMergeCells("Data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var written []string
+			for _, cell := range cells {
+				written = append(written, cell.GetStartAxis()+":"+cell.GetEndAxis())
+			}
+			if !slices.Equal(written, tt.want) {
+				t.Errorf("written merges = %v, want %v", written, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateMetadataOverlappingMerges(t *testing.T) {
+	tests := []struct {
+		name   string
+		merges []excelmetadata.MergedCell
+		want   int
+	}{
+		{name: "disjoint", merges: []excelmetadata.MergedCell{{StartCell: "A1", EndCell: "B1"}, {StartCell: "C1", EndCell: "D1"}}},
+		{name: "overlapping", merges: []excelmetadata.MergedCell{{StartCell: "A1", EndCell: "C1"}, {StartCell: "B1", EndCell: "D1"}}, want: 1},
+		{name: "all overlapping", merges: []excelmetadata.MergedCell{{StartCell: "A1", EndCell: "C3"}, {StartCell: "B2", EndCell: "D4"}, {StartCell: "C3", EndCell: "E5"}}, want: 3},
+		{name: "invalid range ignored", merges: []excelmetadata.MergedCell{{StartCell: "A1", EndCell: "C1"}, {StartCell: "bad", EndCell: "D1"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sheet := newSheet(0, "Data")
+			sheet.MergedCells = tt.merges
+			got := 0
+			for _, issue := range ValidateMetadata(&excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{sheet}}) {
+				if strings.HasPrefix(issue, "overlapping merges") {
+					got++
+				}
+			}
+			if got != tt.want {
+				t.Errorf("overlap issues = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRichText(t *testing.T) {
+	runs := []RichTextRun{
+		{Text: "red ", Bold: true, Color: "#FF0000", Size: 14, Family: "Arial"},
+		{Text: "green ", Italic: true, Color: "0f0", Size: 10},
+		{Text: "blue", Underline: "single", Color: "#0000ff", Size: 18, Family: "Calibri"},
+	}
+	options := DefaultOptions()
+	options.Sheets = map[string]*SheetOptions{"Data": {Cells: map[string]*CellOptions{"A1": {RichText: runs}}}}
+	r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("A1", "plain"))}}, options)
+
+	got, err := r.File.GetCellRichText("Data", "A1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(runs) {
+		t.Fatalf("runs = %d, want %d", len(got), len(runs))
+	}
+
+	tests := []struct {
+		text      string
+		bold      bool
+		italic    bool
+		underline string
+		color     string
+		size      float64
+		family    string
+	}{
+		{text: "red ", bold: true, color: "FF0000", size: 14, family: "Arial"},
+		{text: "green ", italic: true, color: "00FF00", size: 10},
+		{text: "blue", underline: "single", color: "0000FF", size: 18, family: "Calibri"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			run := got[i]
+			if run.Text != tt.text || run.Font == nil {
+				t.Fatalf("run %d = %q with font %v, want %q", i, run.Text, run.Font, tt.text)
+			}
+			font := run.Font
+			if font.Bold != tt.bold || font.Italic != tt.italic || font.Underline != tt.underline {
+				t.Errorf("bold, italic, underline = %v, %v, %q, want %v, %v, %q", font.Bold, font.Italic, font.Underline, tt.bold, tt.italic, tt.underline)
+			}
+			if !strings.HasSuffix(strings.ToUpper(font.Color), tt.color) {
+				t.Errorf("color = %q, want %q", font.Color, tt.color)
+			}
+			if font.Size != tt.size {
+				t.Errorf("size = %v, want %v", font.Size, tt.size)
+			}
+			if font.Family != tt.family {
+				t.Errorf("family = %q, want %q", font.Family, tt.family)
+			}
+		})
+	}
+}
+
+func TestDefaultFont(t *testing.T) {
+	tests := []struct {
+		name       string
+		font       *DefaultFont
+		fontScale  float64
+		wantFamily string
+		wantSize   float64
+	}{
+		{name: "family and size", font: &DefaultFont{Family: "Arial", Size: 10}, wantFamily: "Arial", wantSize: 10},
+		{name: "family only", font: &DefaultFont{Family: "Arial"}, wantFamily: "Arial", wantSize: 11},
+		{name: "scaled", font: &DefaultFont{Family: "Arial", Size: 10}, fontScale: 1.5, wantFamily: "Arial", wantSize: 15},
+		{name: "unset", wantFamily: "Calibri", wantSize: 11},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.DefaultFont = tt.font
+			options.FontScale = tt.fontScale
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("A1", "value"))}}, options)
+
+			family, err := r.File.GetDefaultFont()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if family != tt.wantFamily {
+				t.Errorf("family = %q, want %q", family, tt.wantFamily)
+			}
+			if size := *r.File.Styles.Fonts.Font[0].Sz.Val; size != tt.wantSize {
+				t.Errorf("size = %v, want %v", size, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestPanes(t *testing.T) {
+	tests := []struct {
+		name       string
+		panes      *excelize.Panes
+		activeCell string
+		wantFreeze bool
+		wantXML    string
+	}{
+		{name: "frozen", panes: &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}, wantFreeze: true, wantXML: `state="frozen"`},
+		{name: "split", panes: &excelize.Panes{Split: true, XSplit: 2000, YSplit: 1500, TopLeftCell: "C4", ActivePane: "bottomRight"}, wantXML: `xSplit="2000"`},
+		{name: "active cell", panes: &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}, activeCell: "B5", wantFreeze: true, wantXML: `activeCell="B5"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.Sheets = map[string]*SheetOptions{"Data": {Panes: tt.panes, ActiveCell: tt.activeCell}}
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("A1", "header"))}}, options)
+
+			panes, err := r.File.GetPanes("Data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// excelize reads back Freeze only; a split pane has no state
+			// attribute, which Excel reads as "split"
+			if panes.Freeze != tt.wantFreeze {
+				t.Errorf("freeze = %v, want %v", panes.Freeze, tt.wantFreeze)
+			}
+			if panes.XSplit != tt.panes.XSplit || panes.YSplit != tt.panes.YSplit || panes.TopLeftCell != tt.panes.TopLeftCell {
+				t.Errorf("panes = %+v, want %+v", panes, *tt.panes)
+			}
+			if sheetXML := partXML(t, r.File, "xl/worksheets/sheet2.xml"); !strings.Contains(sheetXML, tt.wantXML) {
+				t.Errorf("sheet XML has no %s", tt.wantXML)
+			}
+		})
+	}
+}
+
+func TestRequireAllStyles(t *testing.T) {
+	tests := []struct {
+		name        string
+		require     bool
+		styleID     int
+		wantErr     bool
+		wantWarning bool
+	}{
+		{name: "dangling style required", require: true, styleID: 99, wantErr: true},
+		{name: "dangling style warned", styleID: 99, wantWarning: true},
+		{name: "known style", require: true, styleID: 1},
+		{name: "no style", require: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cell := newCell("B2", "value")
+			cell.StyleID = tt.styleID
+			metadata := &excelmetadata.Metadata{
+				Styles: map[int]excelmetadata.StyleDetails{1: {Font: &excelmetadata.FontStyle{Bold: true}}},
+				Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", cell)},
+			}
+			options := DefaultOptions()
+			options.RequireAllStyles = tt.require
+			r := New(metadata, options)
+			defer r.File.Close()
+
+			err := r.Recreate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Recreate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "cell B2: style 99 not found") {
+				t.Errorf("error = %v, want the cell and style", err)
+			}
+			if got := hasWarning(r, WarningStyleMissing); got != tt.wantWarning {
+				t.Errorf("styleMissing warning = %v, want %v", got, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestBooleanAsNumber(t *testing.T) {
+	tests := []struct {
+		name     string
+		asNumber bool
+		value    bool
+		want     string
+	}{
+		{name: "true as number", asNumber: true, value: true, want: "1"},
+		{name: "false as number", asNumber: true, value: false, want: "0"},
+		{name: "true as boolean", value: true, want: "TRUE"},
+		{name: "false as boolean", value: false, want: "FALSE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.BooleanAsNumber = tt.asNumber
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("A1", tt.value))}}, options)
+
+			if got := getCellValue(t, r, "Data", "A1"); got != tt.want {
+				t.Errorf("A1 = %q, want %q", got, tt.want)
+			}
+			cellType, err := r.File.GetCellType("Data", "A1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wantNumber := tt.asNumber; (cellType != excelize.CellTypeBool) != wantNumber {
+				t.Errorf("cell type = %v, want a number %v", cellType, wantNumber)
+			}
+		})
+	}
+}
+
+func TestCommentRichText(t *testing.T) {
+	tests := []struct {
+		name     string
+		comment  *Comment
+		wantText string
+		wantRuns []string
+		wantBold []bool
+	}{
+		{name: "plain text", comment: &Comment{Author: "Ann", Text: "check this"}, wantText: "check this"},
+		{
+			name: "runs",
+			comment: &Comment{Author: "Ann", Runs: []RichTextRun{
+				{Text: "Ann:", Bold: true},
+				{Text: " check this"},
+			}},
+			wantRuns: []string{"Ann:", " check this"},
+			wantBold: []bool{true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.Sheets = map[string]*SheetOptions{"Data": {Cells: map[string]*CellOptions{"B2": {Comment: tt.comment}}}}
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("B2", "value"))}}, options)
+
+			comments, err := r.File.GetComments("Data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(comments) != 1 {
+				t.Fatalf("comments = %d, want 1", len(comments))
+			}
+			comment := comments[0]
+			if comment.Cell != "B2" || comment.Author != tt.comment.Author {
+				t.Errorf("comment at %s by %s, want B2 by %s", comment.Cell, comment.Author, tt.comment.Author)
+			}
+			if tt.wantText != "" && comment.Text != tt.wantText {
+				t.Errorf("text = %q, want %q", comment.Text, tt.wantText)
+			}
+			if len(comment.Paragraph) != len(tt.wantRuns) {
+				t.Fatalf("runs = %d, want %d", len(comment.Paragraph), len(tt.wantRuns))
+			}
+			for i, run := range comment.Paragraph {
+				if run.Text != tt.wantRuns[i] {
+					t.Errorf("run %d = %q, want %q", i, run.Text, tt.wantRuns[i])
+				}
+				if bold := run.Font != nil && run.Font.Bold; bold != tt.wantBold[i] {
+					t.Errorf("run %d bold = %v, want %v", i, bold, tt.wantBold[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDataValidationRanges(t *testing.T) {
+	tests := []struct {
+		name        string
+		sqref       string
+		want        string
+		wantWarning bool
+	}{
+		{name: "single range", sqref: "A1:A5", want: "A1:A5"},
+		{name: "two ranges", sqref: "A1:A5 C1:C5", want: "A1:A5 C1:C5"},
+		{name: "comma separated", sqref: "A1:A5, C1:C5", want: "A1:A5 C1:C5"},
+		{name: "single cells", sqref: "A1 B2", want: "A1 B2"},
+		{name: "invalid range", sqref: "A1:A5 bad", wantWarning: true},
+		{name: "empty", sqref: " ", wantWarning: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sheet := newSheet(0, "Data", newCell("A1", "yes"))
+			sheet.DataValidations = []excelmetadata.DataValidation{{Range: tt.sqref, Type: "list", Formula1: `"yes,no"`}}
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{sheet}}, DefaultOptions())
+
+			if got := hasWarning(r, WarningValidationFailed); got != tt.wantWarning {
+				t.Errorf("validationFailed warning = %v, want %v", got, tt.wantWarning)
+			}
+			validations, err := r.File.GetDataValidations("Data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantWarning {
+				if len(validations) != 0 {
+					t.Errorf("validations = %d, want none", len(validations))
+				}
+				return
+			}
+			if len(validations) != 1 {
+				t.Fatalf("validations = %d, want 1", len(validations))
+			}
+			if validations[0].Sqref != tt.want || validations[0].Type != "list" {
+				t.Errorf("validation = %s over %q, want list over %q", validations[0].Type, validations[0].Sqref, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeColor(t *testing.T) {
+	tests := []struct {
+		color string
+		want  string
+	}{
+		{color: "#fff", want: "FFFFFF"},
+		{color: "fff", want: "FFFFFF"},
+		{color: "FFFFFF", want: "FFFFFF"},
+		{color: "#FFFFFF", want: "FFFFFF"},
+		{color: " #1f4e79 ", want: "1F4E79"},
+		{color: "FF1F4E79", want: "1F4E79"},
+		{color: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.color, func(t *testing.T) {
+			if got := normalizeColor(tt.color); got != tt.want {
+				t.Errorf("normalizeColor(%q) = %q, want %q", tt.color, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStyleColorFormats(t *testing.T) {
+	variants := []string{"#fff", "FFFFFF", "#FFFFFF", "ffffff"}
+
+	var want *excelize.Style
+	for _, color := range variants {
+		t.Run(color, func(t *testing.T) {
+			cell := newCell("A1", "value")
+			cell.StyleID = 1
+			r := recreate(t, &excelmetadata.Metadata{
+				Styles: map[int]excelmetadata.StyleDetails{1: {
+					Font:   &excelmetadata.FontStyle{Family: "Arial", Color: color},
+					Fill:   &excelmetadata.FillStyle{Type: "pattern", Pattern: 1, Color: []string{color}},
+					Border: []excelmetadata.BorderStyle{{Type: "left", Color: color, Style: 1}},
+				}},
+				Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", cell)},
+			}, DefaultOptions())
+
+			style, err := r.File.GetStyle(r.StyleMap[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(strings.ToUpper(style.Font.Color), "FFFFFF") {
+				t.Errorf("font color = %q, want white", style.Font.Color)
+			}
+			if len(style.Fill.Color) != 1 || !strings.HasSuffix(strings.ToUpper(style.Fill.Color[0]), "FFFFFF") {
+				t.Errorf("fill color = %v, want white", style.Fill.Color)
+			}
+			if len(style.Border) != 1 || !strings.HasSuffix(strings.ToUpper(style.Border[0].Color), "FFFFFF") {
+				t.Errorf("border = %v, want white", style.Border)
+			}
+
+			// Every variant renders the same style
+			if want == nil {
+				want = style
+			} else if fmt.Sprint(style.Font, style.Fill, style.Border) != fmt.Sprint(want.Font, want.Fill, want.Border) {
+				t.Errorf("style = %v %v %v, want %v %v %v", style.Font, style.Fill, style.Border, want.Font, want.Fill, want.Border)
+			}
+		})
+	}
+}
+
+func TestFlattenedTextFormula(t *testing.T) {
+	tests := []struct {
+		name     string
+		cellType excelize.CellType
+		value    interface{}
+		want     excelize.CellType
+	}{
+		{name: "text formula result", cellType: excelize.CellTypeFormula, value: "123", want: excelize.CellTypeSharedString},
+		{name: "shared string", cellType: excelize.CellTypeSharedString, value: "0042", want: excelize.CellTypeSharedString},
+		{name: "inline string", cellType: excelize.CellTypeInlineString, value: "1e3", want: excelize.CellTypeSharedString},
+		{name: "untyped numeric text", value: "123", want: excelize.CellTypeUnset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cell := excelmetadata.CellMetadata{Address: "C1", Value: tt.value, Type: tt.cellType, Formula: `CONCAT("1","23")`}
+			options := DefaultOptions()
+			options.PreserveFormulas = false
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", cell)}}, options)
+
+			if formula, _ := r.File.GetCellFormula("Data", "C1"); formula != "" {
+				t.Errorf("formula = %q, want the flattened value", formula)
+			}
+			if got := getCellValue(t, r, "Data", "C1"); got != fmt.Sprint(tt.value) {
+				t.Errorf("C1 = %q, want %q", got, tt.value)
+			}
+			cellType, err := r.File.GetCellType("Data", "C1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cellType != tt.want {
+				t.Errorf("cell type = %v, want %v", cellType, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenumberSheets(t *testing.T) {
+	tests := []struct {
+		name     string
+		renumber bool
+		want     []string
+	}{
+		{name: "renumbered", renumber: true, want: []string{"B", "Sheet2", "A"}},
+		{name: "metadata order", want: []string{"A", "B", "Sheet3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{
+				newSheet(5, "A", newCell("A1", "a")),
+				newSheet(0, "B", newCell("A1", "b")),
+				newSheet(2, "", newCell("A1", "unnamed")),
+			}}
+			options := DefaultOptions()
+			options.RenumberSheets = tt.renumber
+			r := recreate(t, metadata, options)
+
+			if got := r.File.GetSheetList(); !slices.Equal(got, tt.want) {
+				t.Errorf("sheets = %v, want %v", got, tt.want)
+			}
+			if got := r.File.GetActiveSheetIndex(); got != 0 {
+				t.Errorf("active sheet = %d, want 0", got)
+			}
+			// The metadata itself is not reordered
+			if metadata.Sheets[0].Name != "A" || metadata.Sheets[0].Index != 5 {
+				t.Errorf("metadata sheet 0 = %s at %d, want A at 5", metadata.Sheets[0].Name, metadata.Sheets[0].Index)
+			}
+		})
+	}
+}
+
+func TestDateOnMergeAnchor(t *testing.T) {
+	date := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	styles := map[int]excelmetadata.StyleDetails{
+		1: {Font: &excelmetadata.FontStyle{Bold: true}},
+		2: {NumberFormat: 15},
+	}
+
+	tests := []struct {
+		name    string
+		styleID int
+		flush   bool
+		want    string
+	}{
+		{name: "unstyled", want: "01-15-24"},
+		{name: "style without number format", styleID: 1, want: "01-15-24"},
+		{name: "style with number format", styleID: 2, want: "15-Jan-24"},
+		{name: "flushed", styleID: 1, flush: true, want: "01-15-24"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cell := newCell("A1", date)
+			cell.StyleID = tt.styleID
+			sheet := newSheet(0, "Data", cell)
+			sheet.MergedCells = []excelmetadata.MergedCell{{StartCell: "A1", EndCell: "C1"}}
+			options := DefaultOptions()
+			options.FlushPerSheet = tt.flush
+			r := recreate(t, &excelmetadata.Metadata{Styles: styles, Sheets: []excelmetadata.SheetMetadata{sheet}}, options)
+
+			buf, err := r.File.WriteToBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := excelize.OpenReader(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if got, err := f.GetCellValue("Data", "A1"); err != nil || got != tt.want {
+				t.Errorf("A1 = %q, %v, want %q", got, err, tt.want)
+			}
+			if tt.styleID == 1 {
+				styleID, _ := f.GetCellStyle("Data", "A1")
+				if style, err := f.GetStyle(styleID); err != nil || style.Font == nil || !style.Font.Bold {
+					t.Errorf("A1 style lost its bold font")
+				}
+			}
+			if merges, err := f.GetMergeCells("Data"); err != nil || len(merges) != 1 {
+				t.Errorf("merges = %v, %v, want A1:C1", merges, err)
+			}
+		})
+	}
+}
+
+func TestTabColorByCategory(t *testing.T) {
+	byPrefix := func(sheet excelmetadata.SheetMetadata) string {
+		switch {
+		case strings.HasPrefix(sheet.Name, "Sales"):
+			return "#00B050"
+		case strings.HasPrefix(sheet.Name, "Cost"):
+			return "c00000"
+		}
+		return ""
+	}
+
+	tests := []struct {
+		name         string
+		category     func(excelmetadata.SheetMetadata) string
+		defaultColor string
+		want         map[string]string
+	}{
+		{
+			name:     "by prefix",
+			category: byPrefix,
+			want:     map[string]string{"Sales Q1": "FF00B050", "Sales Q2": "FF00B050", "Cost Q1": "FFC00000", "Notes": ""},
+		},
+		{
+			name:         "default color",
+			category:     byPrefix,
+			defaultColor: "#808080",
+			want:         map[string]string{"Sales Q1": "FF00B050", "Sales Q2": "FF00B050", "Cost Q1": "FFC00000", "Notes": "FF808080"},
+		},
+		{
+			name: "no category",
+			want: map[string]string{"Sales Q1": "", "Sales Q2": "", "Cost Q1": "", "Notes": ""},
+		},
+		{
+			name:         "default color only",
+			defaultColor: "808080",
+			want:         map[string]string{"Sales Q1": "FF808080", "Sales Q2": "FF808080", "Cost Q1": "FF808080", "Notes": "FF808080"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.TabColorByCategory = tt.category
+			options.DefaultTabColor = tt.defaultColor
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{
+				newSheet(0, "Sales Q1"), newSheet(1, "Sales Q2"), newSheet(2, "Cost Q1"), newSheet(3, "Notes"),
+			}}, options)
+
+			for sheetName, want := range tt.want {
+				props, err := r.File.GetSheetProps(sheetName)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := ""
+				if props.TabColorRGB != nil {
+					got = *props.TabColorRGB
+				}
+				if got != want {
+					t.Errorf("%s tab color = %q, want %q", sheetName, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBaseStyles(t *testing.T) {
+	styles := map[int]excelmetadata.StyleDetails{
+		1: {Font: &excelmetadata.FontStyle{Family: "Arial", Size: 14, Bold: true}, NumberFormat: 4},
+		2: {Fill: &excelmetadata.FillStyle{Type: "pattern", Pattern: 1, Color: []string{"FFFF00"}}},
+		3: {Font: &excelmetadata.FontStyle{Family: "Arial", Size: 9}},
+		4: {},
+		5: {},
+	}
+
+	tests := []struct {
+		name       string
+		baseStyles map[int]int
+		styleID    int
+		wantErr    string
+		wantBold   bool
+		wantSize   float64
+		wantFill   bool
+		wantNumFmt int
+	}{
+		{name: "inherits font, overrides fill", baseStyles: map[int]int{2: 1}, styleID: 2, wantBold: true, wantSize: 14, wantFill: true, wantNumFmt: 4},
+		{name: "overrides font", baseStyles: map[int]int{3: 1}, styleID: 3, wantSize: 9, wantNumFmt: 4},
+		{name: "chain", baseStyles: map[int]int{4: 2, 2: 1}, styleID: 4, wantBold: true, wantSize: 14, wantFill: true, wantNumFmt: 4},
+		{name: "circular", baseStyles: map[int]int{4: 5, 5: 4}, styleID: 4, wantErr: "circular base style"},
+		{name: "missing base", baseStyles: map[int]int{4: 99}, styleID: 4, wantErr: "base style 99 not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cell := newCell("A1", 1.5)
+			cell.StyleID = tt.styleID
+			options := DefaultOptions()
+			options.BaseStyles = tt.baseStyles
+			r := New(&excelmetadata.Metadata{Styles: styles, Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", cell)}}, options)
+			defer r.File.Close()
+
+			err := r.Recreate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Recreate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			style, err := r.File.GetStyle(r.StyleMap[tt.styleID])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if style.Font == nil || style.Font.Bold != tt.wantBold || style.Font.Size != tt.wantSize || style.Font.Family != "Arial" {
+				t.Errorf("font = %+v, want Arial %v bold %v", style.Font, tt.wantSize, tt.wantBold)
+			}
+			if hasFill := len(style.Fill.Color) > 0; hasFill != tt.wantFill {
+				t.Errorf("fill = %+v, want fill %v", style.Fill, tt.wantFill)
+			}
+			if style.NumFmt != tt.wantNumFmt {
+				t.Errorf("number format = %d, want %d", style.NumFmt, tt.wantNumFmt)
+			}
+			// The base style is still created on its own
+			if base, err := r.File.GetStyle(r.StyleMap[1]); err != nil || len(base.Fill.Color) > 0 {
+				t.Errorf("base style = %+v, %v, want no fill", base, err)
+			}
+		})
+	}
+}
+
+func TestCellProgressFunc(t *testing.T) {
+	tests := []struct {
+		name      string
+		cells     int
+		interval  int
+		wantCalls int
+		wantLast  int
+	}{
+		{name: "interval 100", cells: 1000, interval: 100, wantCalls: 10, wantLast: 1000},
+		{name: "partial last interval", cells: 250, interval: 100, wantCalls: 3, wantLast: 250},
+		{name: "default interval", cells: 2500, wantCalls: 3, wantLast: 2500},
+		{name: "no cells", cells: 0, interval: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sheet := newSheet(0, "Data")
+			for i := 0; i < tt.cells; i++ {
+				sheet.Cells = append(sheet.Cells, newCell(fmt.Sprintf("A%d", i+1), float64(i)))
+			}
+
+			var calls, last int
+			options := DefaultOptions()
+			options.CellProgressInterval = tt.interval
+			options.CellProgressFunc = func(sheetName string, done, total int) {
+				calls++
+				if sheetName != "Data" || total != tt.cells || done <= last {
+					t.Errorf("progress %s %d/%d after %d", sheetName, done, total, last)
+				}
+				last = done
+			}
+			recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{sheet}}, options)
+
+			if calls != tt.wantCalls || last != tt.wantLast {
+				t.Errorf("calls = %d ending at %d, want %d ending at %d", calls, last, tt.wantCalls, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestActiveCell(t *testing.T) {
+	tests := []struct {
+		name       string
+		activeCell string
+		panes      *excelize.Panes
+		wantPane   string
+	}{
+		{name: "without panes", activeCell: "C5"},
+		{name: "with frozen panes", activeCell: "C5", panes: &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}, wantPane: "bottomLeft"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.Sheets = map[string]*SheetOptions{"Data": {ActiveCell: tt.activeCell, Panes: tt.panes}}
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("A1", "header"))}}, options)
+
+			buf, err := r.File.WriteToBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := excelize.OpenReader(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			panes, err := f.GetPanes("Data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(panes.Selection) != 1 {
+				t.Fatalf("selections = %v, want one", panes.Selection)
+			}
+			selection := panes.Selection[0]
+			if selection.ActiveCell != tt.activeCell || selection.SQRef != tt.activeCell || selection.Pane != tt.wantPane {
+				t.Errorf("selection = %+v, want %s in pane %q", selection, tt.activeCell, tt.wantPane)
+			}
+			if panes.Freeze != (tt.panes != nil) {
+				t.Errorf("freeze = %v, want %v", panes.Freeze, tt.panes != nil)
+			}
+		})
+	}
+}
+
+func TestColWidthRanges(t *testing.T) {
+	const defaultWidth = 9.140625 // excelize's default column width
+
+	tests := []struct {
+		name      string
+		colWidths map[string]float64
+		want      map[string]float64
+	}{
+		{name: "range", colWidths: map[string]float64{"B:D": 18}, want: map[string]float64{"A": defaultWidth, "B": 18, "C": 18, "D": 18, "E": defaultWidth}},
+		{name: "single column", colWidths: map[string]float64{"C": 25}, want: map[string]float64{"B": defaultWidth, "C": 25, "D": defaultWidth}},
+		{name: "range and column", colWidths: map[string]float64{"A:B": 12, "D": 30}, want: map[string]float64{"A": 12, "B": 12, "C": defaultWidth, "D": 30}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sheet := newSheet(0, "Data", newCell("A1", "header"))
+			sheet.ColWidths = tt.colWidths
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{sheet}}, DefaultOptions())
+
+			for col, want := range tt.want {
+				got, err := r.File.GetColWidth("Data", col)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					t.Errorf("column %s width = %v, want %v", col, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestContinueOnError(t *testing.T) {
+	// A dangling style fails the sheet after its first cell is written
+	failing := func(index int, name string) excelmetadata.SheetMetadata {
+		bad := newCell("A2", "bad")
+		bad.StyleID = 99
+		return newSheet(index, name, newCell("A1", "written"), bad)
+	}
+
+	tests := []struct {
+		name        string
+		sheets      []excelmetadata.SheetMetadata
+		continueOn  bool
+		flush       bool
+		wantErr     string
+		wantSheets  []string
+		wantSkipped string
+	}{
+		{
+			name:        "failed sheet removed",
+			sheets:      []excelmetadata.SheetMetadata{newSheet(0, "Data"), failing(1, "Bad"), newSheet(2, "Summary")},
+			continueOn:  true,
+			wantSheets:  []string{"Data", "Summary"},
+			wantSkipped: "Bad",
+		},
+		{
+			name:        "warned under the sanitized name",
+			sheets:      []excelmetadata.SheetMetadata{newSheet(0, "Data"), failing(1, "Bad/Name")},
+			continueOn:  true,
+			wantSheets:  []string{"Data"},
+			wantSkipped: "Bad_Name",
+		},
+		{
+			name:        "warned under the unique name",
+			sheets:      []excelmetadata.SheetMetadata{newSheet(0, "Data"), failing(1, "Data")},
+			continueOn:  true,
+			wantSheets:  []string{"Data"},
+			wantSkipped: "Data (2)",
+		},
+		{
+			name:        "only sheet failed",
+			sheets:      []excelmetadata.SheetMetadata{failing(0, "Bad")},
+			continueOn:  true,
+			wantSheets:  []string{"Sheet1"},
+			wantSkipped: "Bad",
+		},
+		{
+			name:        "flushed",
+			sheets:      []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("A1", "kept")), failing(1, "Bad")},
+			continueOn:  true,
+			flush:       true,
+			wantSheets:  []string{"Data"},
+			wantSkipped: "Bad",
+		},
+		{
+			name:    "aborted",
+			sheets:  []excelmetadata.SheetMetadata{newSheet(0, "Data"), failing(1, "Bad/Name")},
+			wantErr: "failed to recreate sheet Bad_Name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.RequireAllStyles = true
+			options.ContinueOnError = tt.continueOn
+			options.FlushPerSheet = tt.flush
+			r := New(&excelmetadata.Metadata{Sheets: tt.sheets}, options)
+			defer r.File.Close()
+
+			err := r.Recreate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Recreate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := r.File.GetSheetList(); !slices.Equal(got, tt.wantSheets) {
+				t.Errorf("sheets = %v, want %v", got, tt.wantSheets)
+			}
+			var skipped []string
+			for _, w := range r.Warnings() {
+				if w.Code == WarningSheetSkipped {
+					skipped = append(skipped, w.SheetName)
+				}
+			}
+			if !slices.Equal(skipped, []string{tt.wantSkipped}) {
+				t.Errorf("skipped sheets = %v, want %s", skipped, tt.wantSkipped)
+			}
+			if _, err := r.File.WriteToBuffer(); err != nil {
+				t.Errorf("WriteToBuffer() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestDefinedNameScope(t *testing.T) {
+	tests := []struct {
+		name       string
+		sheets     []excelmetadata.SheetMetadata
+		scope      string
+		options    func(o *Options)
+		wantScope  string
+		wantExists bool
+	}{
+		{
+			name:       "sheet index",
+			sheets:     []excelmetadata.SheetMetadata{newSheet(0, "Data"), newSheet(1, "Summary")},
+			scope:      "1",
+			wantScope:  "Summary",
+			wantExists: true,
+		},
+		{
+			name:       "sheet name",
+			sheets:     []excelmetadata.SheetMetadata{newSheet(0, "Data"), newSheet(1, "Summary")},
+			scope:      "Summary",
+			wantScope:  "Summary",
+			wantExists: true,
+		},
+		{
+			name:       "sheet named like a number",
+			sheets:     []excelmetadata.SheetMetadata{newSheet(0, "Data"), newSheet(1, "0")},
+			scope:      "0",
+			wantScope:  "0",
+			wantExists: true,
+		},
+		{
+			name:       "made unique",
+			sheets:     []excelmetadata.SheetMetadata{newSheet(0, "Data"), newSheet(1, "data")},
+			scope:      "1",
+			wantScope:  "data (2)",
+			wantExists: true,
+		},
+		{
+			name:       "sanitized",
+			sheets:     []excelmetadata.SheetMetadata{newSheet(0, "Data"), newSheet(1, "Q1/Q2")},
+			scope:      "Q1/Q2",
+			wantScope:  "Q1_Q2",
+			wantExists: true,
+		},
+		{
+			name:       "renumbered",
+			sheets:     []excelmetadata.SheetMetadata{newSheet(5, "Data"), newSheet(2, "")},
+			scope:      "2",
+			options:    func(o *Options) { o.RenumberSheets = true },
+			wantScope:  "Sheet1",
+			wantExists: true,
+		},
+		{
+			name:   "filtered out",
+			sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data"), newSheet(1, "Hidden")},
+			scope:  "1",
+			options: func(o *Options) {
+				o.SheetFilter = func(s excelmetadata.SheetMetadata) bool { return s.Name != "Hidden" }
+			},
+		},
+		{
+			name: "skipped on error",
+			sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data"), newSheet(1, "Bad", excelmetadata.CellMetadata{
+				Address: "A1", Value: "x", StyleID: 99,
+			})},
+			scope: "Bad",
+			options: func(o *Options) {
+				o.RequireAllStyles = true
+				o.ContinueOnError = true
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			if tt.options != nil {
+				tt.options(options)
+			}
+			r := recreate(t, &excelmetadata.Metadata{
+				Sheets:       tt.sheets,
+				DefinedNames: []excelmetadata.DefinedName{{Name: "Total", RefersTo: "Data!$A$1", Scope: tt.scope}},
+			}, options)
+
+			names := r.File.GetDefinedName()
+			if exists := len(names) == 1; exists != tt.wantExists {
+				t.Fatalf("defined names = %+v, want exists %v", names, tt.wantExists)
+			}
+			if tt.wantExists && names[0].Scope != tt.wantScope {
+				t.Errorf("scope = %q, want %q", names[0].Scope, tt.wantScope)
+			}
+		})
+	}
+}
+
+func TestVerifyAfterSave(t *testing.T) {
+	tests := []struct {
+		name    string
+		write   func(t *testing.T, path string) error
+		wantErr bool
+	}{
+		{
+			name: "valid file",
+			write: func(t *testing.T, path string) error {
+				options := DefaultOptions()
+				options.VerifyAfterSave = true
+				r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("A1", "value"))}}, options)
+				return r.Save(path)
+			},
+		},
+		{
+			name: "corrupt file",
+			write: func(t *testing.T, path string) error {
+				if err := os.WriteFile(path, []byte("not a workbook"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return verifyFile(path)
+			},
+			wantErr: true,
+		},
+		{
+			name: "truncated file",
+			write: func(t *testing.T, path string) error {
+				f := excelize.NewFile()
+				defer f.Close()
+				buf, err := f.WriteToBuffer()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, buf.Bytes()[:buf.Len()/2], 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return verifyFile(path)
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.write(t, filepath.Join(t.TempDir(), "out.xlsx"))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSheetDefaultNumFmt(t *testing.T) {
+	const currency = 7
+	currencyCode := currencyNumFmts[currency]
+	styles := map[int]excelmetadata.StyleDetails{
+		1: {NumberFormat: 4},
+		2: {Font: &excelmetadata.FontStyle{Bold: true}},
+	}
+
+	tests := []struct {
+		name       string
+		value      interface{}
+		styleID    int
+		wantNumFmt int
+		wantCode   string
+		wantBold   bool
+	}{
+		{name: "unstyled number", value: 1234.5, wantCode: currencyCode},
+		{name: "numeric text", value: "99", wantCode: currencyCode},
+		{name: "own number format", value: 1234.5, styleID: 1, wantNumFmt: 4},
+		{name: "style without number format", value: 1234.5, styleID: 2, wantCode: currencyCode, wantBold: true},
+		{name: "text", value: "label"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cell := newCell("B2", tt.value)
+			cell.StyleID = tt.styleID
+			options := DefaultOptions()
+			options.Sheets = map[string]*SheetOptions{"Data": {DefaultNumFmt: currency}}
+			r := recreate(t, &excelmetadata.Metadata{Styles: styles, Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", cell)}}, options)
+
+			styleID, err := r.File.GetCellStyle("Data", "B2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			style, err := r.File.GetStyle(styleID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if style.NumFmt != tt.wantNumFmt {
+				t.Errorf("number format = %d, want %d", style.NumFmt, tt.wantNumFmt)
+			}
+			code := ""
+			if style.CustomNumFmt != nil {
+				code = *style.CustomNumFmt
+			}
+			if code != tt.wantCode {
+				t.Errorf("number format code = %q, want %q", code, tt.wantCode)
+			}
+			if bold := style.Font != nil && style.Font.Bold; bold != tt.wantBold {
+				t.Errorf("bold = %v, want %v", bold, tt.wantBold)
+			}
+		})
+	}
+}
+
+func TestLongStringPolicy(t *testing.T) {
+	long := strings.Repeat("a", 40000)
+
+	tests := []struct {
+		name          string
+		policy        LongStringPolicy
+		value         string
+		wantErr       bool
+		wantLen       int
+		wantTruncated bool
+	}{
+		{name: "default truncates", value: long, wantLen: excelize.TotalCellChars, wantTruncated: true},
+		{name: "truncate", policy: LongStringTruncate, value: long, wantLen: excelize.TotalCellChars, wantTruncated: true},
+		{name: "error", policy: LongStringError, value: long, wantErr: true},
+		{name: "at the limit", policy: LongStringError, value: long[:excelize.TotalCellChars], wantLen: excelize.TotalCellChars},
+		{name: "multibyte under the limit", value: strings.Repeat("ก", 20000), wantLen: 20000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.LongStringPolicy = tt.policy
+			r := New(&excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("A1", tt.value))}}, options)
+			err := r.Recreate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Recreate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			value, err := r.File.GetCellValue("Data", "A1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := utf8.RuneCountInString(value); n != tt.wantLen {
+				t.Errorf("length = %d, want %d", n, tt.wantLen)
+			}
+			if got := hasWarning(r, WarningTruncated); got != tt.wantTruncated {
+				t.Errorf("truncated warning = %v, want %v", got, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestAddTitleRow(t *testing.T) {
+	styles := map[int]excelmetadata.StyleDetails{3: {Font: &excelmetadata.FontStyle{Bold: true}}}
+
+	tests := []struct {
+		name      string
+		cells     []excelmetadata.CellMetadata
+		styleID   int
+		wantErr   bool
+		wantMerge string
+		wantBold  bool
+	}{
+		{name: "spans the used columns", cells: []excelmetadata.CellMetadata{newCell("A1", "Name"), newCell("D2", 1)}, wantMerge: "A1:D1"},
+		{name: "metadata style", cells: []excelmetadata.CellMetadata{newCell("A1", "Name"), newCell("C1", "Total")}, styleID: 3, wantMerge: "A1:C1", wantBold: true},
+		{name: "single column", cells: []excelmetadata.CellMetadata{newCell("A1", "Name")}},
+		{name: "missing style", cells: []excelmetadata.CellMetadata{newCell("A1", "Name")}, styleID: 9, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := recreate(t, &excelmetadata.Metadata{Styles: styles, Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", tt.cells...)}}, DefaultOptions())
+			err := r.AddTitleRow("Data", "Report", tt.styleID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AddTitleRow() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if value, _ := r.File.GetCellValue("Data", "A1"); value != "Name" {
+					t.Errorf("A1 = %q after a failed title, want the sheet unchanged", value)
+				}
+				return
+			}
+
+			if value, _ := r.File.GetCellValue("Data", "A1"); value != "Report" {
+				t.Errorf("A1 = %q, want %q", value, "Report")
+			}
+			if value, _ := r.File.GetCellValue("Data", "A2"); value != "Name" {
+				t.Errorf("A2 = %q, want the content shifted down", value)
+			}
+			mergeCells, err := r.File.GetMergeCells("Data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			merge := ""
+			if len(mergeCells) > 0 {
+				merge = mergeCells[0].GetStartAxis() + ":" + mergeCells[0].GetEndAxis()
+			}
+			if merge != tt.wantMerge {
+				t.Errorf("merge = %q, want %q", merge, tt.wantMerge)
+			}
+
+			styleID, err := r.File.GetCellStyle("Data", "A1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			style, err := r.File.GetStyle(styleID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if style.Alignment == nil || style.Alignment.Horizontal != "center" {
+				t.Errorf("alignment = %+v, want centered", style.Alignment)
+			}
+			if bold := style.Font != nil && style.Font.Bold; bold != tt.wantBold {
+				t.Errorf("bold = %v, want %v", bold, tt.wantBold)
+			}
+		})
+	}
+}
+
+func TestConditionalFormatPriority(t *testing.T) {
+	high := excelize.ConditionalFormatOptions{Type: "cell", Criteria: ">", Value: "100", StopIfTrue: true}
+	positive := excelize.ConditionalFormatOptions{Type: "cell", Criteria: ">", Value: "0"}
+
+	tests := []struct {
+		name    string
+		formats []ConditionalFormat
+		want    []string
+	}{
+		{
+			name: "added in priority order",
+			formats: []ConditionalFormat{
+				{Range: "A1:A10", Priority: 1, Rule: high},
+				{Range: "A1:A10", Priority: 2, Rule: positive},
+			},
+			want: []string{`priority="1" stopIfTrue="true"`, `priority="2"`},
+		},
+		{
+			name: "sorted by priority",
+			formats: []ConditionalFormat{
+				{Range: "A1:A10", Priority: 2, Rule: positive},
+				{Range: "A1:A10", Priority: 1, Rule: high},
+			},
+			want: []string{`priority="1" stopIfTrue="true"`, `priority="2"`},
+		},
+		{
+			name: "equal priorities keep their order",
+			formats: []ConditionalFormat{
+				{Range: "A1:A10", Rule: positive},
+				{Range: "A1:A10", Rule: high},
+			},
+			want: []string{`priority="1"`, `priority="2" stopIfTrue="true"`},
+		},
+	}
+
+	rulePattern := regexp.MustCompile(`<cfRule type="cellIs"[^>]*(priority="\d+"(?: stopIfTrue="true")?)[^>]*operator="greaterThan"><formula>`)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.Sheets = map[string]*SheetOptions{"Data": {ConditionalFormats: tt.formats}}
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("A1", 150))}}, options)
+
+			var got []string
+			for _, match := range rulePattern.FindAllStringSubmatch(partXML(t, r.File, "xl/worksheets/sheet2.xml"), -1) {
+				got = append(got, match[1])
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("rules = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructureOnly(t *testing.T) {
+	sheet := newSheet(0, "Data",
+		newCell("A1", "Name"), newCell("B1", "Total"),
+		newCell("A2", "Units"), newCell("B2", "Count"),
+		newCell("A3", "apple"), newCell("B3", 3),
+		newCell("A4", "pear"), newCell("B4", 4),
+	)
+	sheet.ColWidths = map[string]float64{"A": 20}
+	sheet.MergedCells = []excelmetadata.MergedCell{{StartCell: "A5", EndCell: "B5"}}
+
+	tests := []struct {
+		name          string
+		structureOnly bool
+		headerRows    int
+		wantRows      int
+	}{
+		{name: "all rows", wantRows: 4},
+		{name: "default header row", structureOnly: true, wantRows: 1},
+		{name: "two header rows", structureOnly: true, headerRows: 2, wantRows: 2},
+		{name: "more header rows than data", structureOnly: true, headerRows: 10, wantRows: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.StructureOnly = tt.structureOnly
+			options.HeaderRows = tt.headerRows
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{sheet}}, options)
+
+			rows, err := r.File.GetRows("Data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != tt.wantRows {
+				t.Errorf("rows = %q, want %d rows", rows, tt.wantRows)
+			}
+			if got := getCellValue(t, r, "Data", "A1"); got != "Name" {
+				t.Errorf("A1 = %q, want the header kept", got)
+			}
+
+			width, err := r.File.GetColWidth("Data", "A")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if width != 20 {
+				t.Errorf("column A width = %v, want 20", width)
+			}
+			mergeCells, err := r.File.GetMergeCells("Data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(mergeCells) != 1 {
+				t.Errorf("merges = %d, want 1", len(mergeCells))
+			}
+		})
+	}
+}
+
+func TestSheetFilter(t *testing.T) {
+	hasCells := func(sheet excelmetadata.SheetMetadata) bool { return len(sheet.Cells) > 0 }
+
+	tests := []struct {
+		name      string
+		filter    func(sheet excelmetadata.SheetMetadata) bool
+		want      []string
+		wantNames []string
+	}{
+		{name: "no filter", want: []string{"Summary", "Empty", "Data"}, wantNames: []string{"EmptyTotal", "Total"}},
+		{name: "skip sheets without cells", filter: hasCells, want: []string{"Summary", "Data"}, wantNames: []string{"Total"}},
+		{name: "skip every sheet", filter: func(excelmetadata.SheetMetadata) bool { return false }, want: []string{"Sheet1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := &excelmetadata.Metadata{
+				Sheets: []excelmetadata.SheetMetadata{
+					newSheet(0, "Summary", newCell("A1", "total")),
+					newSheet(1, "Empty"),
+					newSheet(2, "Data", newCell("A1", 1)),
+				},
+				DefinedNames: []excelmetadata.DefinedName{
+					{Name: "Total", RefersTo: "Data!$A$1", Scope: "Data"},
+					{Name: "EmptyTotal", RefersTo: "Empty!$A$1", Scope: "Empty"},
+				},
+			}
+			options := DefaultOptions()
+			options.SheetFilter = tt.filter
+			r := recreate(t, metadata, options)
+
+			if got := r.File.GetSheetList(); !slices.Equal(got, tt.want) {
+				t.Errorf("sheets = %v, want %v", got, tt.want)
+			}
+			var names []string
+			for _, name := range r.File.GetDefinedName() {
+				names = append(names, name.Name)
+			}
+			slices.Sort(names)
+			if !slices.Equal(names, tt.wantNames) {
+				t.Errorf("defined names = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestQuotePrefix(t *testing.T) {
+	styles := map[int]excelmetadata.StyleDetails{1: {Font: &excelmetadata.FontStyle{Bold: true}}}
+
+	tests := []struct {
+		name            string
+		styleID         int
+		quotePrefix     bool
+		wantQuotePrefix bool
+		wantBold        bool
+	}{
+		{name: "quote prefix", quotePrefix: true, wantQuotePrefix: true},
+		{name: "quote prefix on a style", styleID: 1, quotePrefix: true, wantQuotePrefix: true, wantBold: true},
+		{name: "no quote prefix", styleID: 1, wantBold: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cell := newCell("A1", "=abc")
+			cell.StyleID = tt.styleID
+			options := DefaultOptions()
+			options.Sheets = map[string]*SheetOptions{"Data": {Cells: map[string]*CellOptions{"A1": {QuotePrefix: tt.quotePrefix}}}}
+			r := recreate(t, &excelmetadata.Metadata{Styles: styles, Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", cell)}}, options)
+
+			// Reopen the saved file so the flag is read back from styles.xml
+			filename := filepath.Join(t.TempDir(), "quote.xlsx")
+			if err := r.Save(filename); err != nil {
+				t.Fatal(err)
+			}
+			f, err := excelize.OpenFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			if formula, _ := f.GetCellFormula("Data", "A1"); formula != "" {
+				t.Errorf("formula = %q, want none", formula)
+			}
+			if value, _ := f.GetCellValue("Data", "A1"); value != "=abc" {
+				t.Errorf("value = %q, want %q", value, "=abc")
+			}
+			styleID, err := f.GetCellStyle("Data", "A1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			xf := f.Styles.CellXfs.Xf[styleID]
+			if got := xf.QuotePrefix != nil && *xf.QuotePrefix; got != tt.wantQuotePrefix {
+				t.Errorf("quotePrefix = %v, want %v", got, tt.wantQuotePrefix)
+			}
+			style, err := f.GetStyle(styleID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bold := style.Font != nil && style.Font.Bold; bold != tt.wantBold {
+				t.Errorf("bold = %v, want %v", bold, tt.wantBold)
+			}
+		})
+	}
+}
+
+func TestNewFromJSONDir(t *testing.T) {
+	shard := func(name string) string {
+		return fmt.Sprintf(`{"sheets": [{"index": 0, "name": %q, "visible": true, "cells": [{"address": "A1", "value": %q}]}]}`, name, name)
+	}
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr bool
+		want    []string
+	}{
+		{
+			name:  "filename order",
+			files: map[string]string{"02_b.json": shard("Beta"), "01_a.json": shard("Alpha"), "03_c.json": shard("Gamma")},
+			want:  []string{"Alpha", "Beta", "Gamma"},
+		},
+		{
+			name:  "other files ignored",
+			files: map[string]string{"01_a.json": shard("Alpha"), "notes.txt": "not metadata"},
+			want:  []string{"Alpha"},
+		},
+		{name: "empty directory", wantErr: true},
+		{name: "invalid JSON", files: map[string]string{"01_a.json": shard("Alpha"), "02_b.json": "{"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, data := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r, err := NewFromJSONDir(dir, DefaultOptions())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewFromJSONDir() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if err := r.Recreate(); err != nil {
+				t.Fatalf("Recreate() error = %v", err)
+			}
+			if got := r.File.GetSheetList(); !slices.Equal(got, tt.want) {
+				t.Errorf("sheets = %v, want %v", got, tt.want)
+			}
+			for _, sheetName := range tt.want {
+				if got := getCellValue(t, r, sheetName, "A1"); got != sheetName {
+					t.Errorf("%s!A1 = %q, want %q", sheetName, got, sheetName)
+				}
+			}
+		})
+	}
+}
+
+func TestFontScale(t *testing.T) {
+	styles := map[int]excelmetadata.StyleDetails{1: {Font: &excelmetadata.FontStyle{Size: 10}}}
+
+	tests := []struct {
+		name            string
+		scale           float64
+		wantStyleSize   float64
+		wantRunSize     float64
+		wantDefaultSize float64
+	}{
+		{name: "unscaled", wantStyleSize: 10, wantRunSize: 12, wantDefaultSize: 11},
+		{name: "double", scale: 2, wantStyleSize: 20, wantRunSize: 24, wantDefaultSize: 22},
+		{name: "large print", scale: 1.5, wantStyleSize: 15, wantRunSize: 18, wantDefaultSize: 16.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cell := newCell("A1", "styled")
+			cell.StyleID = 1
+			options := DefaultOptions()
+			options.FontScale = tt.scale
+			options.Sheets = map[string]*SheetOptions{"Data": {Cells: map[string]*CellOptions{
+				"A2": {RichText: []RichTextRun{{Text: "rich", Size: 12}}},
+			}}}
+			r := recreate(t, &excelmetadata.Metadata{Styles: styles, Sheets: []excelmetadata.SheetMetadata{
+				newSheet(0, "Data", cell, newCell("A2", "rich")),
+			}}, options)
+
+			styleID, err := r.File.GetCellStyle("Data", "A1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			style, err := r.File.GetStyle(styleID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if style.Font == nil || style.Font.Size != tt.wantStyleSize {
+				t.Errorf("style font = %+v, want size %v", style.Font, tt.wantStyleSize)
+			}
+
+			runs, err := r.File.GetCellRichText("Data", "A2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(runs) != 1 || runs[0].Font == nil || runs[0].Font.Size != tt.wantRunSize {
+				t.Errorf("runs = %+v, want one run of size %v", runs, tt.wantRunSize)
+			}
+
+			if size := *r.File.Styles.Fonts.Font[0].Sz.Val; size != tt.wantDefaultSize {
+				t.Errorf("default font size = %v, want %v", size, tt.wantDefaultSize)
+			}
+		})
+	}
+}
+
+func TestImageHyperlink(t *testing.T) {
+	tests := []struct {
+		name          string
+		link          string
+		hyperlinkType string
+		wantType      string
+		wantExternal  bool
+	}{
+		{name: "external", link: "https://example.com", hyperlinkType: "External", wantType: "External", wantExternal: true},
+		{name: "lower case type", link: "https://example.com", hyperlinkType: "external", wantType: "External", wantExternal: true},
+		{name: "inferred URL", link: "https://example.com", wantType: "External", wantExternal: true},
+		{name: "inferred mailto", link: "mailto:team@example.com", wantType: "External", wantExternal: true},
+		{name: "inferred location", link: "Data!A1", wantType: "Location"},
+		{name: "no link", wantType: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := imageHyperlinkType(tt.link, tt.hyperlinkType); got != tt.wantType {
+				t.Errorf("imageHyperlinkType(%q, %q) = %q, want %q", tt.link, tt.hyperlinkType, got, tt.wantType)
+			}
+			if tt.link == "" {
+				return
+			}
+
+			sheet := newSheet(0, "Data")
+			sheet.Images = []excelmetadata.ImageMetadata{{
+				Cell:      "B2",
+				File:      newPNG(t, 20, 20),
+				Extension: ".png",
+				Format:    &excelmetadata.ImageFormat{Hyperlink: tt.link, HyperlinkType: tt.hyperlinkType},
+			}}
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{sheet}}, DefaultOptions())
+
+			rels := partXML(t, r.File, "xl/drawings/_rels/drawing1.xml.rels")
+			rel := regexp.MustCompile(`<Relationship [^>]*Target="` + regexp.QuoteMeta(tt.link) + `"[^>]*>`).FindString(rels)
+			if rel == "" {
+				t.Fatalf("drawing relationships = %s, want a link to %s", rels, tt.link)
+			}
+			if external := strings.Contains(rel, `TargetMode="External"`); external != tt.wantExternal {
+				t.Errorf("relationship = %s, want external %v", rel, tt.wantExternal)
+			}
+		})
+	}
+}
+
+func TestEstimateSize(t *testing.T) {
+	rows := func(n int) []excelmetadata.CellMetadata {
+		var cells []excelmetadata.CellMetadata
+		for i := 1; i <= n; i++ {
+			cells = append(cells, newCell(fmt.Sprintf("A%d", i), fmt.Sprintf("row %d", i)), newCell(fmt.Sprintf("B%d", i), i))
+		}
+		return cells
+	}
+
+	tests := []struct {
+		name  string
+		cells []excelmetadata.CellMetadata
+	}{
+		{name: "empty sheet"},
+		{name: "small sheet", cells: rows(10)},
+		{name: "larger sheet", cells: rows(5000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", tt.cells...)}}, DefaultOptions())
+
+			estimate, err := r.EstimateSize()
+			if err != nil {
+				t.Fatalf("EstimateSize() error = %v", err)
+			}
+			filename := filepath.Join(t.TempDir(), "size.xlsx")
+			if err := r.Save(filename); err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Allow 1% for differences in zip timestamps and compression
+			if diff := estimate - info.Size(); diff < -info.Size()/100 || diff > info.Size()/100 {
+				t.Errorf("estimate = %d, saved size = %d", estimate, info.Size())
+			}
+		})
+	}
+}
+
+func TestSetRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		topLeft  string
+		data     [][]interface{}
+		trim     bool
+		wantErr  bool
+		want     map[string]string
+		wantType map[string]excelize.CellType // Numbers are written without a type
+	}{
+		{
+			name:     "2x3 block",
+			topLeft:  "B2",
+			data:     [][]interface{}{{"Name", 1, 2.5}, {"Total", true, int32(7)}},
+			want:     map[string]string{"B2": "Name", "C2": "1", "D2": "2.5", "B3": "Total", "C3": "TRUE", "D3": "7", "A1": "", "E2": ""},
+			wantType: map[string]excelize.CellType{"B2": excelize.CellTypeSharedString, "C2": excelize.CellTypeUnset, "D2": excelize.CellTypeUnset, "D3": excelize.CellTypeUnset, "C3": excelize.CellTypeBool},
+		},
+		{
+			name:    "nil skipped",
+			topLeft: "A1",
+			data:    [][]interface{}{{"a", nil, "c"}},
+			want:    map[string]string{"A1": "a", "B1": "", "C1": "c"},
+		},
+		{
+			name:    "ragged rows",
+			topLeft: "A1",
+			data:    [][]interface{}{{"a"}, {"b", "c"}},
+			want:    map[string]string{"A1": "a", "B1": "", "A2": "b", "B2": "c"},
+		},
+		{
+			name:    "cell value options",
+			topLeft: "A1",
+			data:    [][]interface{}{{"  padded  ", "   "}},
+			trim:    true,
+			want:    map[string]string{"A1": "padded", "B1": ""},
+		},
+		{name: "invalid top left", topLeft: "1A", data: [][]interface{}{{"a"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.TrimCellWhitespace = tt.trim
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data")}}, options)
+
+			err := r.SetRange("Data", tt.topLeft, tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for address, want := range tt.want {
+				if got := getCellValue(t, r, "Data", address); got != want {
+					t.Errorf("%s = %q, want %q", address, got, want)
+				}
+			}
+			for address, want := range tt.wantType {
+				cellType, err := r.File.GetCellType("Data", address)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cellType != want {
+					t.Errorf("%s type = %v, want %v", address, cellType, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPercentColumns(t *testing.T) {
+	styles := map[int]excelmetadata.StyleDetails{1: {NumberFormat: 4}}
+
+	tests := []struct {
+		name      string
+		address   string
+		value     interface{}
+		styleID   int
+		columns   []string
+		wantValue string
+	}{
+		{name: "percent column", address: "C2", value: 0.25, columns: []string{"C"}, wantValue: "25%"},
+		{name: "lower case column", address: "C2", value: 0.25, columns: []string{"c"}, wantValue: "25%"},
+		{name: "other column", address: "B2", value: 0.25, columns: []string{"C"}, wantValue: "0.25"},
+		{name: "own number format", address: "C2", value: 0.25, styleID: 1, columns: []string{"C"}, wantValue: "0.25"},
+		{name: "text", address: "C2", value: "n/a", columns: []string{"C"}, wantValue: "n/a"},
+		{name: "no percent columns", address: "C2", value: 0.25, wantValue: "0.25"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cell := newCell(tt.address, tt.value)
+			cell.StyleID = tt.styleID
+			options := DefaultOptions()
+			options.PercentColumns = tt.columns
+			r := recreate(t, &excelmetadata.Metadata{Styles: styles, Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", cell)}}, options)
+
+			if got := getCellValue(t, r, "Data", tt.address); got != tt.wantValue {
+				t.Errorf("%s = %q, want %q", tt.address, got, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestAutoMergeRepeats(t *testing.T) {
+	cells := []excelmetadata.CellMetadata{
+		newCell("A1", "A"), newCell("A2", "A"), newCell("A3", "B"),
+		newCell("B1", 1), newCell("B2", 1), newCell("B3", 1),
+		newCell("C1", "x"), newCell("C3", "x"),
+		newCell("D1", "y"), {Address: "D2", Value: "y", Formula: "D1"},
+	}
+
+	tests := []struct {
+		name    string
+		enabled bool
+		columns []string
+		want    []string
+	}{
+		{name: "disabled"},
+		{name: "every column", enabled: true, want: []string{"A1:A2", "B1:B3"}},
+		{name: "allowlist", enabled: true, columns: []string{"a"}, want: []string{"A1:A2"}},
+		{name: "column without repeats", enabled: true, columns: []string{"C"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.AutoMergeRepeats = tt.enabled
+			options.AutoMergeColumns = tt.columns
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", cells...)}}, options)
+
+			mergeCells, err := r.File.GetMergeCells("Data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, merge := range mergeCells {
+				got = append(got, merge.GetStartAxis()+":"+merge.GetEndAxis())
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("merges = %v, want %v", got, tt.want)
+			}
+			if value := getCellValue(t, r, "Data", "A1"); value != "A" {
+				t.Errorf("A1 = %q, want %q", value, "A")
+			}
+		})
+	}
+}
+
+func TestAsText(t *testing.T) {
+	tests := []struct {
+		name            string
+		cell            excelmetadata.CellMetadata
+		asText          bool
+		wantValue       string
+		wantFormula     string
+		wantQuotePrefix bool
+	}{
+		{name: "documented formula", cell: excelmetadata.CellMetadata{Address: "A1", Formula: "SUM(A:A)"}, asText: true, wantValue: "=SUM(A:A)", wantQuotePrefix: true},
+		{name: "formula with equals sign", cell: excelmetadata.CellMetadata{Address: "A1", Formula: "=SUM(A:A)"}, asText: true, wantValue: "=SUM(A:A)", wantQuotePrefix: true},
+		{name: "number", cell: newCell("A1", 42), asText: true, wantValue: "42", wantQuotePrefix: true},
+		{name: "formula", cell: excelmetadata.CellMetadata{Address: "A1", Formula: "SUM(B:B)"}, wantFormula: "SUM(B:B)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.Sheets = map[string]*SheetOptions{"Data": {Cells: map[string]*CellOptions{"A1": {AsText: tt.asText}}}}
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", tt.cell)}}, options)
+
+			formula, err := r.File.GetCellFormula("Data", "A1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if formula != tt.wantFormula {
+				t.Errorf("formula = %q, want %q", formula, tt.wantFormula)
+			}
+			if tt.wantFormula == "" {
+				if got := getCellValue(t, r, "Data", "A1"); got != tt.wantValue {
+					t.Errorf("value = %q, want %q", got, tt.wantValue)
+				}
+				cellType, err := r.File.GetCellType("Data", "A1")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cellType != excelize.CellTypeSharedString {
+					t.Errorf("type = %v, want a string", cellType)
+				}
+			}
+
+			styleID, err := r.File.GetCellStyle("Data", "A1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			xf := r.File.Styles.CellXfs.Xf[styleID]
+			if got := xf.QuotePrefix != nil && *xf.QuotePrefix; got != tt.wantQuotePrefix {
+				t.Errorf("quotePrefix = %v, want %v", got, tt.wantQuotePrefix)
+			}
+		})
+	}
+}
+
+func TestRecreateWithTimeout(t *testing.T) {
+	var cells []excelmetadata.CellMetadata
+	for i := 1; i <= 20000; i++ {
+		cells = append(cells, newCell(fmt.Sprintf("A%d", i), i))
+	}
+	metadata := &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", cells...), newSheet(1, "More", cells...)}}
+
+	tests := []struct {
+		name            string
+		recreate        func(r *Recreator) error
+		continueOnError bool
+		wantErr         error
+	}{
+		{name: "tiny timeout", recreate: func(r *Recreator) error { return r.RecreateWithTimeout(time.Nanosecond) }, wantErr: context.DeadlineExceeded},
+		{name: "tiny timeout with ContinueOnError", recreate: func(r *Recreator) error { return r.RecreateWithTimeout(time.Nanosecond) }, continueOnError: true, wantErr: context.DeadlineExceeded},
+		{name: "generous timeout", recreate: func(r *Recreator) error { return r.RecreateWithTimeout(time.Minute) }},
+		{
+			name: "canceled between cells",
+			recreate: func(r *Recreator) error {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				r.Options.CellProgressInterval = 100
+				r.Options.CellProgressFunc = func(string, int, int) { cancel() }
+				return r.RecreateContext(ctx)
+			},
+			wantErr: context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.ContinueOnError = tt.continueOnError
+			r := New(metadata, options)
+
+			err := tt.recreate(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				if got := getCellValue(t, r, "More", "A20000"); got != "20000" {
+					t.Errorf("More!A20000 = %q, want %q", got, "20000")
+				}
+			}
+		})
+	}
+}
+
+func TestCellWriteOrder(t *testing.T) {
+	cells := []excelmetadata.CellMetadata{
+		newCell("B2", "b2"), newCell("A2", "a2"), newCell("B1", "b1"), newCell("bad", "x"), newCell("A1", "a1"), newCell("C1", "c1"),
+	}
+
+	tests := []struct {
+		name  string
+		order CellWriteOrder
+		want  []string
+	}{
+		{name: "as is", order: CellWriteAsIs, want: []string{"B2", "A2", "B1", "bad", "A1", "C1"}},
+		{name: "row major", order: CellWriteRowMajor, want: []string{"A1", "B1", "C1", "A2", "B2", "bad"}},
+		{name: "column major", order: CellWriteColMajor, want: []string{"A1", "A2", "B1", "B2", "C1", "bad"}},
+	}
+
+	wantRows := [][]string{{"a1", "b1", "c1"}, {"a2", "b2"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sorted := cells
+			if tt.order != CellWriteAsIs {
+				sorted = sortCells(cells, tt.order)
+			}
+			var got []string
+			for _, cell := range sorted {
+				got = append(got, cell.Address)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("order = %v, want %v", got, tt.want)
+			}
+			if cells[0].Address != "B2" {
+				t.Errorf("metadata cells were reordered")
+			}
+
+			// Every order produces the same content
+			valid := slices.DeleteFunc(slices.Clone(cells), func(cell excelmetadata.CellMetadata) bool { return cell.Address == "bad" })
+			options := DefaultOptions()
+			options.CellWriteOrder = tt.order
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", valid...)}}, options)
+			rows, err := r.File.GetRows("Data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.EqualFunc(rows, wantRows, slices.Equal) {
+				t.Errorf("rows = %v, want %v", rows, wantRows)
+			}
+		})
+	}
+}
+
+func TestCommentAuthor(t *testing.T) {
+	created := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		comment       Comment
+		wantTimestamp bool
+	}{
+		{name: "author and text", comment: Comment{Author: "Alice", Text: "Check this"}},
+		{name: "created time", comment: Comment{Author: "Alice", Text: "Check this", Created: created}, wantTimestamp: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.Sheets = map[string]*SheetOptions{"Data": {Cells: map[string]*CellOptions{"B2": {Comment: &tt.comment}}}}
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("B2", 1))}}, options)
+
+			comments, err := r.File.GetComments("Data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(comments) != 1 {
+				t.Fatalf("comments = %d, want 1", len(comments))
+			}
+			if comments[0].Cell != "B2" || comments[0].Author != tt.comment.Author {
+				t.Errorf("comment = %s by %q, want B2 by %q", comments[0].Cell, comments[0].Author, tt.comment.Author)
+			}
+			if !strings.Contains(comments[0].Text, tt.comment.Text) {
+				t.Errorf("text = %q, want %q", comments[0].Text, tt.comment.Text)
+			}
+			if got := hasWarning(r, WarningCommentTimestamp); got != tt.wantTimestamp {
+				t.Errorf("timestamp warning = %v, want %v", got, tt.wantTimestamp)
+			}
+		})
+	}
+}
+
+func TestMergeBorders(t *testing.T) {
+	box := excelmetadata.StyleDetails{Border: []excelmetadata.BorderStyle{
+		{Type: "left", Style: 1}, {Type: "top", Style: 1}, {Type: "right", Style: 1}, {Type: "bottom", Style: 1},
+	}}
+	styles := map[int]excelmetadata.StyleDetails{1: box, 2: {Font: &excelmetadata.FontStyle{Bold: true}}}
+	boxed := map[string][]string{
+		"A1": {"left", "top", "right", "bottom"}, "B1": {"top"}, "C1": {"right", "top"},
+		"A2": {"left"}, "B2": nil, "C2": {"right"},
+		"A3": {"bottom", "left"}, "B3": {"bottom"}, "C3": {"bottom", "right"},
+	}
+
+	tests := []struct {
+		name  string
+		cells []excelmetadata.CellMetadata
+		want  map[string][]string
+	}{
+		{
+			name:  "box border",
+			cells: []excelmetadata.CellMetadata{{Address: "A1", Value: "title", StyleID: 1}},
+			want:  boxed,
+		},
+		{
+			name:  "styled covered cell kept",
+			cells: []excelmetadata.CellMetadata{{Address: "A1", Value: "title", StyleID: 1}, {Address: "C3", Value: "note", StyleID: 2}},
+			want:  map[string][]string{"B1": {"top"}, "C3": nil},
+		},
+		{
+			name:  "anchor without borders",
+			cells: []excelmetadata.CellMetadata{{Address: "A1", Value: "title", StyleID: 2}},
+			want:  map[string][]string{"B1": nil, "C3": nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sheet := newSheet(0, "Data", tt.cells...)
+			sheet.MergedCells = []excelmetadata.MergedCell{{StartCell: "A1", EndCell: "C3"}}
+			r := recreate(t, &excelmetadata.Metadata{Styles: styles, Sheets: []excelmetadata.SheetMetadata{sheet}}, DefaultOptions())
+
+			for address, want := range tt.want {
+				styleID, err := r.File.GetCellStyle("Data", address)
+				if err != nil {
+					t.Fatal(err)
+				}
+				style, err := r.File.GetStyle(styleID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var sides []string
+				for _, border := range style.Border {
+					sides = append(sides, border.Type)
+				}
+				slices.Sort(sides)
+				slices.Sort(want)
+				if !slices.Equal(sides, want) {
+					t.Errorf("%s borders = %v, want %v", address, sides, want)
+				}
+			}
+		})
+	}
+}
+
+func TestOriginalType(t *testing.T) {
+	date := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		value        interface{}
+		originalType string
+		want         interface{}
+		wantErr      bool
+	}{
+		{name: "float as int", value: 42.0, originalType: "int", want: 42},
+		{name: "text as int", value: "42", originalType: "int", want: 42},
+		{name: "fraction as int", value: 42.5, originalType: "int", wantErr: true},
+		{name: "text as float", value: "2.5", originalType: "float", want: 2.5},
+		{name: "number as bool", value: 1.0, originalType: "bool", want: true},
+		{name: "text as bool", value: "false", originalType: "bool", want: false},
+		{name: "number as string", value: 7.0, originalType: "string", want: "7"},
+		{name: "RFC 3339 time", value: "2024-01-15T08:00:00Z", originalType: "time", want: date},
+		{name: "invalid time", value: "15/01/2024", originalType: "time", wantErr: true},
+		{name: "unknown type", value: 1.0, originalType: "decimal", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := originalTypeValue(tt.value, tt.originalType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("originalTypeValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("originalTypeValue() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOriginalTypeCell(t *testing.T) {
+	tests := []struct {
+		name         string
+		value        interface{}
+		originalType string
+		wantValue    string
+		wantType     excelize.CellType
+	}{
+		{name: "int", value: 42.0, originalType: "int", wantValue: "42", wantType: excelize.CellTypeUnset},
+		{name: "string", value: 7.0, originalType: "string", wantValue: "7", wantType: excelize.CellTypeSharedString},
+		{name: "bool", value: 1.0, originalType: "bool", wantValue: "TRUE", wantType: excelize.CellTypeBool},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.Sheets = map[string]*SheetOptions{"Data": {Cells: map[string]*CellOptions{"A1": {OriginalType: tt.originalType}}}}
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("A1", tt.value))}}, options)
+
+			if got := getCellValue(t, r, "Data", "A1"); got != tt.wantValue {
+				t.Errorf("value = %q, want %q", got, tt.wantValue)
+			}
+			cellType, err := r.File.GetCellType("Data", "A1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cellType != tt.wantType {
+				t.Errorf("type = %v, want %v", cellType, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestFormulaConditionalFormat(t *testing.T) {
+	styles := map[int]excelmetadata.StyleDetails{1: {Font: &excelmetadata.FontStyle{Bold: true}}}
+
+	tests := []struct {
+		name     string
+		criteria string
+		want     string
+	}{
+		{name: "mixed reference", criteria: "$B2>100", want: "<formula>$B2&gt;100</formula>"},
+		{name: "leading equals sign", criteria: "=$B2>100", want: "<formula>$B2&gt;100</formula>"},
+		{name: "absolute reference", criteria: "=A2>$C$1", want: "<formula>A2&gt;$C$1</formula>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.Sheets = map[string]*SheetOptions{"Data": {ConditionalFormats: []ConditionalFormat{{
+				Range:   "A2:A10",
+				StyleID: 1,
+				Rule:    excelize.ConditionalFormatOptions{Type: "formula", Criteria: tt.criteria},
+			}}}}
+			r := recreate(t, &excelmetadata.Metadata{Styles: styles, Sheets: []excelmetadata.SheetMetadata{
+				newSheet(0, "Data", newCell("A2", "high"), newCell("B2", 150)),
+			}}, options)
+
+			sheetXML := partXML(t, r.File, "xl/worksheets/sheet2.xml")
+			if !strings.Contains(sheetXML, `<conditionalFormatting sqref="A2:A10"><cfRule type="expression"`) || !strings.Contains(sheetXML, tt.want) {
+				t.Errorf("sheet = %s, want an expression rule with %s", sheetXML, tt.want)
+			}
+			formats, err := r.File.GetConditionalFormats("Data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rules := formats["A2:A10"]; len(rules) != 1 || rules[0].Format == nil {
+				t.Errorf("rules = %+v, want one rule with a format", rules)
+			}
+		})
+	}
+}
+
+func TestRecompressImages(t *testing.T) {
+	gradient := image.NewRGBA(image.Rect(0, 0, 400, 400))
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 400; x++ {
+			gradient.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: uint8(x + y), A: 255})
+		}
+	}
+	encode := func(encode func(*bytes.Buffer) error) []byte {
+		var buf bytes.Buffer
+		if err := encode(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	uncompressedPNG := encode(func(buf *bytes.Buffer) error {
+		return (&png.Encoder{CompressionLevel: png.NoCompression}).Encode(buf, gradient)
+	})
+	compressedPNG := encode(func(buf *bytes.Buffer) error {
+		return (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(buf, gradient)
+	})
+	fineJPEG := encode(func(buf *bytes.Buffer) error { return jpeg.Encode(buf, gradient, &jpeg.Options{Quality: 100}) })
+
+	tests := []struct {
+		name        string
+		data        []byte
+		extension   string
+		recompress  bool
+		quality     int
+		wantSmaller bool
+	}{
+		{name: "uncompressed PNG", data: uncompressedPNG, extension: ".png", recompress: true, wantSmaller: true},
+		{name: "compressed PNG kept", data: compressedPNG, extension: ".png", recompress: true},
+		{name: "JPEG", data: fineJPEG, extension: ".jpeg", recompress: true, quality: 50, wantSmaller: true},
+		{name: "disabled", data: uncompressedPNG, extension: ".png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sheet := newSheet(0, "Data")
+			sheet.Images = []excelmetadata.ImageMetadata{{Cell: "B2", File: tt.data, Extension: tt.extension}}
+			options := DefaultOptions()
+			options.RecompressImages = tt.recompress
+			options.ImageQuality = tt.quality
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{sheet}}, options)
+
+			embedded := len(partXML(t, r.File, "xl/media/image1"+tt.extension))
+			if smaller := embedded < len(tt.data); smaller != tt.wantSmaller {
+				t.Errorf("embedded %d bytes from %d, want smaller %v", embedded, len(tt.data), tt.wantSmaller)
+			}
+			if !tt.wantSmaller && embedded != len(tt.data) {
+				t.Errorf("embedded %d bytes, want the original %d", embedded, len(tt.data))
+			}
+		})
+	}
+}
+
+func TestDate1904(t *testing.T) {
+	date := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	styles := map[int]excelmetadata.StyleDetails{1: {NumberFormat: 14}}
+
+	tests := []struct {
+		name     string
+		date1904 bool
+		wantRaw  string
+	}{
+		{name: "1900 date system", wantRaw: "45306"},
+		{name: "1904 date system", date1904: true, wantRaw: "43844"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cell := newCell("A1", date)
+			cell.StyleID = 1
+			options := DefaultOptions()
+			options.Date1904 = tt.date1904
+			r := recreate(t, &excelmetadata.Metadata{Styles: styles, Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", cell)}}, options)
+
+			props, err := r.File.GetWorkbookProps()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := props.Date1904 != nil && *props.Date1904; got != tt.date1904 {
+				t.Errorf("date1904 = %v, want %v", got, tt.date1904)
+			}
+			raw, err := r.File.GetCellValue("Data", "A1", excelize.Options{RawCellValue: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if raw != tt.wantRaw {
+				t.Errorf("serial = %s, want %s", raw, tt.wantRaw)
+			}
+			if got := getCellValue(t, r, "Data", "A1"); got != "01-15-24" {
+				t.Errorf("displayed date = %q, want %q", got, "01-15-24")
+			}
+		})
+	}
+}
+
+func TestErrorValues(t *testing.T) {
+	tests := []struct {
+		name        string
+		cell        excelmetadata.CellMetadata
+		wantFormula string
+		wantValue   string
+	}{
+		{name: "not available", cell: newCell("A1", "#N/A"), wantFormula: "#N/A"},
+		{name: "division by zero", cell: newCell("A1", "#DIV/0!"), wantFormula: "#DIV/0!"},
+		{name: "text cell", cell: excelmetadata.CellMetadata{Address: "A1", Value: "#N/A", Type: excelize.CellTypeSharedString}, wantValue: "#N/A"},
+		{name: "not an error", cell: newCell("A1", "#hashtag"), wantValue: "#hashtag"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", tt.cell)}}, DefaultOptions())
+
+			formula, err := r.File.GetCellFormula("Data", "A1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if formula != tt.wantFormula {
+				t.Errorf("formula = %q, want %q", formula, tt.wantFormula)
+			}
+			if tt.wantFormula == "" {
+				if got := getCellValue(t, r, "Data", "A1"); got != tt.wantValue {
+					t.Errorf("value = %q, want %q", got, tt.wantValue)
+				}
+				return
+			}
+			// Excel evaluates the formula constant to the error; the cell
+			// holds no text
+			want := "<f>" + escapeXMLText(tt.wantFormula) + "</f>"
+			if sheetXML := partXML(t, r.File, "xl/worksheets/sheet2.xml"); !strings.Contains(sheetXML, `<c r="A1" t="str">`+want+`</c>`) {
+				t.Errorf("sheet = %s, want A1 with only %s", sheetXML, want)
+			}
+		})
+	}
+}
+
+func TestCellIndent(t *testing.T) {
+	styles := map[int]excelmetadata.StyleDetails{
+		1: {Font: &excelmetadata.FontStyle{Bold: true}, Alignment: &excelmetadata.AlignmentStyle{Horizontal: "center", Vertical: "top"}},
+		2: {Alignment: &excelmetadata.AlignmentStyle{Horizontal: "right"}},
+		3: {Alignment: &excelmetadata.AlignmentStyle{Horizontal: "left", Indent: 1}},
+	}
+
+	tests := []struct {
+		name           string
+		styleID        int
+		indent         int
+		wantIndent     int
+		wantHorizontal string
+		wantVertical   string
+		wantBold       bool
+	}{
+		{name: "unstyled cell", indent: 2, wantIndent: 2, wantHorizontal: "left"},
+		{name: "centered cell becomes left", styleID: 1, indent: 2, wantIndent: 2, wantHorizontal: "left", wantVertical: "top", wantBold: true},
+		{name: "right alignment kept", styleID: 2, indent: 2, wantIndent: 2, wantHorizontal: "right"},
+		{name: "style indent overridden", styleID: 3, indent: 2, wantIndent: 2, wantHorizontal: "left"},
+		{name: "style indent kept without override", styleID: 3, wantIndent: 1, wantHorizontal: "left"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.Sheets = map[string]*SheetOptions{"Data": {Cells: map[string]*CellOptions{"A1": {Indent: tt.indent}}}}
+			sheet := newSheet(0, "Data", excelmetadata.CellMetadata{Address: "A1", Value: "item", StyleID: tt.styleID})
+			r := recreate(t, &excelmetadata.Metadata{Styles: styles, Sheets: []excelmetadata.SheetMetadata{sheet}}, options)
+
+			styleID, err := r.File.GetCellStyle("Data", "A1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			style, err := r.File.GetStyle(styleID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if style.Alignment == nil {
+				t.Fatal("alignment not set")
+			}
+			if style.Alignment.Indent != tt.wantIndent || style.Alignment.Horizontal != tt.wantHorizontal || style.Alignment.Vertical != tt.wantVertical {
+				t.Errorf("alignment = %+v, want indent %d, horizontal %q, vertical %q", *style.Alignment, tt.wantIndent, tt.wantHorizontal, tt.wantVertical)
+			}
+			if bold := style.Font != nil && style.Font.Bold; bold != tt.wantBold {
+				t.Errorf("bold = %v, want %v", bold, tt.wantBold)
+			}
+			if got := getCellValue(t, r, "Data", "A1"); got != "item" {
+				t.Errorf("value = %q, want %q", got, "item")
+			}
+		})
+	}
+}
+
+func TestTables(t *testing.T) {
+	off, on := false, true
+	cells := []excelmetadata.CellMetadata{
+		newCell("A1", "Name"), newCell("B1", "Amount"),
+		newCell("A2", "apples"), newCell("B2", 3),
+		newCell("A3", "pears"), newCell("B3", 5),
+	}
+
+	tests := []struct {
+		name          string
+		table         excelize.Table
+		flushPerSheet bool
+		want          excelize.Table
+		wantErr       string
+	}{
+		{
+			name:  "named style with stripes off",
+			table: excelize.Table{Range: "A1:B3", Name: "Fruit", StyleName: "TableStyleMedium9", ShowRowStripes: &off},
+			want:  excelize.Table{Range: "A1:B3", Name: "Fruit", StyleName: "TableStyleMedium9", ShowRowStripes: &off},
+		},
+		{
+			name: "column emphasis and column stripes",
+			table: excelize.Table{Range: "A1:B3", Name: "Emphasis", StyleName: "TableStyleLight1",
+				ShowFirstColumn: true, ShowLastColumn: true, ShowColumnStripes: true, ShowRowStripes: &on},
+			want: excelize.Table{Range: "A1:B3", Name: "Emphasis", StyleName: "TableStyleLight1",
+				ShowFirstColumn: true, ShowLastColumn: true, ShowColumnStripes: true, ShowRowStripes: &on},
+		},
+		{
+			name:          "flush per sheet",
+			table:         excelize.Table{Range: "A1:B3", Name: "Flushed"},
+			flushPerSheet: true,
+			wantErr:       "tables cannot be written with FlushPerSheet",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.FlushPerSheet = tt.flushPerSheet
+			options.Sheets = map[string]*SheetOptions{"Data": {Tables: []excelize.Table{tt.table}}}
+			r := New(&excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", cells...)}}, options)
+			err := r.Recreate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Recreate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Recreate() error = %v", err)
+			}
+
+			tables, err := r.File.GetTables("Data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tables) != 1 {
+				t.Fatalf("tables = %d, want 1", len(tables))
+			}
+			got := tables[0]
+			if got.Range != tt.want.Range || got.Name != tt.want.Name || got.StyleName != tt.want.StyleName ||
+				got.ShowFirstColumn != tt.want.ShowFirstColumn || got.ShowLastColumn != tt.want.ShowLastColumn ||
+				got.ShowColumnStripes != tt.want.ShowColumnStripes ||
+				!jsonEqual(got.ShowRowStripes, tt.want.ShowRowStripes) {
+				t.Errorf("table = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreserveExistingActiveSheet(t *testing.T) {
+	tests := []struct {
+		name          string
+		preserve      bool
+		flushPerSheet bool
+		want          string
+	}{
+		{name: "first recreated sheet activated", want: "Appended"},
+		{name: "existing active sheet kept", preserve: true, want: "Summary"},
+		{name: "existing active sheet kept with FlushPerSheet", preserve: true, flushPerSheet: true, want: "Summary"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existing := excelize.NewFile()
+			defer existing.Close()
+			if err := existing.SetSheetName("Sheet1", "Notes"); err != nil {
+				t.Fatal(err)
+			}
+			index, err := existing.NewSheet("Summary")
+			if err != nil {
+				t.Fatal(err)
+			}
+			existing.SetActiveSheet(index)
+
+			options := DefaultOptions()
+			options.PreserveExistingActiveSheet = tt.preserve
+			options.FlushPerSheet = tt.flushPerSheet
+			metadata := &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{
+				newSheet(0, "Appended", newCell("A1", 1)),
+				newSheet(1, "Appended 2", newCell("A1", 2)),
+			}}
+			r := New(metadata, options)
+			r.File = existing
+			if err := r.Recreate(); err != nil {
+				t.Fatalf("Recreate() error = %v", err)
+			}
+
+			if got := r.File.GetSheetName(r.File.GetActiveSheetIndex()); got != tt.want {
+				t.Errorf("active sheet = %q, want %q", got, tt.want)
+			}
+			if got := getCellValue(t, r, "Appended 2", "A1"); got != "2" {
+				t.Errorf("appended value = %q, want %q", got, "2")
+			}
+		})
+	}
+}
+
+func TestClearCoveredCells(t *testing.T) {
+	cells := []excelmetadata.CellMetadata{
+		newCell("A1", "title"), newCell("B1", "hidden"), newCell("A2", 42),
+		{Address: "B2", Formula: "A2*2"}, newCell("D1", "outside"),
+	}
+
+	cleared := map[string]bool{"A1": true, "B1": false, "A2": false, "B2": false, "D1": true}
+
+	tests := []struct {
+		name          string
+		clear         bool
+		flushPerSheet bool
+		wantFilled    map[string]bool
+		wantWarnings  int
+	}{
+		{name: "covered values cleared", clear: true, wantFilled: cleared, wantWarnings: 3},
+		{name: "covered values cleared with FlushPerSheet", clear: true, flushPerSheet: true, wantFilled: cleared, wantWarnings: 3},
+		{name: "merge discards covered values without warnings", wantFilled: cleared},
+		{
+			name:          "covered values kept with FlushPerSheet",
+			flushPerSheet: true,
+			wantFilled:    map[string]bool{"A1": true, "B1": true, "A2": true, "B2": true, "D1": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.FlushPerSheet = tt.flushPerSheet
+			options.ClearCoveredCells = tt.clear
+			sheet := newSheet(0, "Data", cells...)
+			sheet.MergedCells = []excelmetadata.MergedCell{{StartCell: "A1", EndCell: "B2"}}
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{sheet}}, options)
+
+			// GetCellValue reads covered cells from the top-left cell, so
+			// the stored values are read from the sheet XML
+			sheetXML := partXML(t, r.File, "xl/worksheets/sheet2.xml")
+			for address, want := range tt.wantFilled {
+				cellXML := regexp.MustCompile(`<c r="` + address + `"[^>]*(/>|>.*?</c>)`).FindString(sheetXML)
+				if filled := strings.Contains(cellXML, "<v>") || strings.Contains(cellXML, "<f>") || strings.Contains(cellXML, "<is>"); filled != want {
+					t.Errorf("%s filled = %v, want %v (%s)", address, filled, want, cellXML)
+				}
+			}
+			if got := getCellValue(t, r, "Data", "A1"); got != "title" {
+				t.Errorf("A1 = %q, want %q", got, "title")
+			}
+			merges, err := r.File.GetMergeCells("Data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(merges) != 1 || merges[0].GetStartAxis() != "A1" || merges[0].GetEndAxis() != "B2" {
+				t.Errorf("merges = %v, want A1:B2", merges)
+			}
+			var warnings int
+			for _, w := range r.Warnings() {
+				if w.Code == WarningCoveredCleared {
+					warnings++
+				}
+			}
+			if warnings != tt.wantWarnings {
+				t.Errorf("covered cleared warnings = %d, want %d", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestSheetNameTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		sheets   []excelmetadata.SheetMetadata
+		want     []string
+		wantErr  error
+	}{
+		{
+			name:     "zero padded numbers",
+			template: "Data_%02d",
+			sheets:   []excelmetadata.SheetMetadata{newSheet(0, ""), newSheet(1, "")},
+			want:     []string{"Data_01", "Data_02"},
+		},
+		{
+			name:     "named sheets kept",
+			template: "Data_%02d",
+			sheets:   []excelmetadata.SheetMetadata{newSheet(0, "Summary"), newSheet(1, "")},
+			want:     []string{"Summary", "Data_02"},
+		},
+		{
+			name:   "default sheet name without template",
+			sheets: []excelmetadata.SheetMetadata{newSheet(0, ""), newSheet(1, "")},
+			want:   []string{unnamedSheetPrefix + "1", unnamedSheetPrefix + "2"},
+		},
+		{
+			name:     "invalid character",
+			template: "Data/%d",
+			sheets:   []excelmetadata.SheetMetadata{newSheet(0, "")},
+			wantErr:  excelize.ErrSheetNameInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.SheetNameTemplate = tt.template
+			r := New(&excelmetadata.Metadata{Sheets: tt.sheets}, options)
+			err := r.Recreate()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Recreate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Recreate() error = %v", err)
+			}
+			if got := r.File.GetSheetList(); !slices.Equal(got, tt.want) {
+				t.Errorf("sheets = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSheetNameTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		wantErr  string
+	}{
+		{template: "Data_%02d"},
+		{template: "Sheet %d of data"},
+		{template: "Data", wantErr: "must format one integer"},
+		{template: "Data_%s", wantErr: "must format one integer"},
+		{template: "Data_%d_%d", wantErr: "must format one integer"},
+		{template: "Data_%.0f", wantErr: "must format one integer"},
+		{template: "Data_%[2]d", wantErr: "must format one integer"},
+		{template: "Data*%d", wantErr: excelize.ErrSheetNameInvalid.Error()},
+		{template: strings.Repeat("x", 31) + "%d", wantErr: excelize.ErrSheetNameLength.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			err := validateSheetNameTemplate(tt.template)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateSheetNameTemplate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateSheetNameTemplate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCellValidation(t *testing.T) {
+	list := &excelmetadata.DataValidation{Type: "list", Formula1: `"Yes,No"`, ShowError: true}
+
+	tests := []struct {
+		name          string
+		cells         map[string]*CellOptions
+		sheetRules    []excelmetadata.DataValidation
+		keepValidated bool
+		want          map[string]string // Maps sqref to the validation type
+		wantErr       string
+	}{
+		{
+			name:          "inline list on C2",
+			cells:         map[string]*CellOptions{"C2": {Validation: list}},
+			keepValidated: true,
+			want:          map[string]string{"C2": "list"},
+		},
+		{
+			name:          "range ignored",
+			cells:         map[string]*CellOptions{"C2": {Validation: &excelmetadata.DataValidation{Range: "A1:Z99", Type: "list", Formula1: `"Yes,No"`}}},
+			keepValidated: true,
+			want:          map[string]string{"C2": "list"},
+		},
+		{
+			name:  "with sheet validations",
+			cells: map[string]*CellOptions{"C2": {Validation: list}, "D4": {Validation: &excelmetadata.DataValidation{Type: "whole", Operator: "between", Formula1: "1", Formula2: "10"}}},
+			sheetRules: []excelmetadata.DataValidation{
+				{Range: "A1:A10", Type: "decimal", Operator: "greaterThan", Formula1: "0"},
+			},
+			keepValidated: true,
+			want:          map[string]string{"A1:A10": "decimal", "C2": "list", "D4": "whole"},
+		},
+		{
+			name:  "validations not preserved",
+			cells: map[string]*CellOptions{"C2": {Validation: list}},
+			want:  map[string]string{},
+		},
+		{
+			name:          "invalid address",
+			cells:         map[string]*CellOptions{"C0": {Validation: list}},
+			keepValidated: true,
+			wantErr:       "validation C0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.PreserveDataValidation = tt.keepValidated
+			options.Sheets = map[string]*SheetOptions{"Data": {Cells: tt.cells}}
+			sheet := newSheet(0, "Data", newCell("C2", "Yes"))
+			sheet.DataValidations = tt.sheetRules
+			r := New(&excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{sheet}}, options)
+			err := r.Recreate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Recreate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Recreate() error = %v", err)
+			}
+
+			validations, err := r.File.GetDataValidations("Data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]string)
+			for _, dv := range validations {
+				got[dv.Sqref] = dv.Type
+				if dv.Sqref == "C2" && dv.Formula1 != `"Yes,No"` {
+					t.Errorf("C2 list = %s, want %s", dv.Formula1, `"Yes,No"`)
+				}
+			}
+			if !jsonEqual(got, tt.want) {
+				t.Errorf("validations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutlines(t *testing.T) {
+	yes, no := true, false
+
+	tests := []struct {
+		name          string
+		sheetOpts     *SheetOptions
+		flushPerSheet bool
+		wantRows      map[int]uint8
+		wantCols      map[string]uint8
+		wantBelow     bool
+		wantRight     bool
+		wantErr       string
+	}{
+		{
+			name:      "grouped columns with summary left",
+			sheetOpts: &SheetOptions{ColOutlineLevels: map[string]uint8{"B": 1, "C": 1, "D": 2}, OutlineSummaryRight: &no},
+			wantCols:  map[string]uint8{"A": 0, "B": 1, "C": 1, "D": 2},
+			wantBelow: true,
+		},
+		{
+			name:      "grouped rows with summary above",
+			sheetOpts: &SheetOptions{RowOutlineLevels: map[int]uint8{2: 1, 3: 2}, OutlineSummaryBelow: &no, OutlineSummaryRight: &yes},
+			wantRows:  map[int]uint8{1: 0, 2: 1, 3: 2},
+			wantRight: true,
+		},
+		{
+			name:          "grouped rows with FlushPerSheet",
+			sheetOpts:     &SheetOptions{RowOutlineLevels: map[int]uint8{2: 1, 3: 2}},
+			flushPerSheet: true,
+			wantRows:      map[int]uint8{1: 0, 2: 1, 3: 2},
+			wantBelow:     true,
+			wantRight:     true,
+		},
+		{
+			name:          "grouped columns with FlushPerSheet",
+			sheetOpts:     &SheetOptions{ColOutlineLevels: map[string]uint8{"B": 1}},
+			flushPerSheet: true,
+			wantErr:       "column outline levels cannot be written with FlushPerSheet",
+		},
+		{
+			name:      "row outline level out of range",
+			sheetOpts: &SheetOptions{RowOutlineLevels: map[int]uint8{2: 8}},
+			wantErr:   "row 2 outline level",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.FlushPerSheet = tt.flushPerSheet
+			options.Sheets = map[string]*SheetOptions{"Data": tt.sheetOpts}
+			sheet := newSheet(0, "Data", newCell("A1", "total"), newCell("A2", 1), newCell("A3", 2))
+			r := New(&excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{sheet}}, options)
+			err := r.Recreate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Recreate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Recreate() error = %v", err)
+			}
+
+			for row, want := range tt.wantRows {
+				if got, _ := r.File.GetRowOutlineLevel("Data", row); got != want {
+					t.Errorf("row %d outline level = %d, want %d", row, got, want)
+				}
+			}
+			for col, want := range tt.wantCols {
+				if got, _ := r.File.GetColOutlineLevel("Data", col); got != want {
+					t.Errorf("column %s outline level = %d, want %d", col, got, want)
+				}
+			}
+			props, err := r.File.GetSheetProps("Data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if below := props.OutlineSummaryBelow == nil || *props.OutlineSummaryBelow; below != tt.wantBelow {
+				t.Errorf("summary below = %v, want %v", below, tt.wantBelow)
+			}
+			if right := props.OutlineSummaryRight == nil || *props.OutlineSummaryRight; right != tt.wantRight {
+				t.Errorf("summary right = %v, want %v", right, tt.wantRight)
+			}
+		})
+	}
+}
+
+func TestNilValuePolicy(t *testing.T) {
+	styles := map[int]excelmetadata.StyleDetails{1: {Fill: &excelmetadata.FillStyle{Type: "pattern", Pattern: 1, Color: []string{"FFFF00"}}}}
+
+	tests := []struct {
+		name           string
+		policy         NilValuePolicy
+		skipEmptyCells bool
+		wantCell       bool // The nil-value cell is written
+		wantType       excelize.CellType
+	}{
+		{name: "default skips with SkipEmptyCells", skipEmptyCells: true},
+		{name: "default writes blank without SkipEmptyCells", wantCell: true, wantType: excelize.CellTypeUnset},
+		{name: "blank", policy: NilValueBlank, skipEmptyCells: true, wantCell: true, wantType: excelize.CellTypeUnset},
+		{name: "empty string", policy: NilValueEmptyString, skipEmptyCells: true, wantCell: true, wantType: excelize.CellTypeSharedString},
+		{name: "skip", policy: NilValueSkip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.NilValuePolicy = tt.policy
+			options.SkipEmptyCells = tt.skipEmptyCells
+			sheet := newSheet(0, "Data", newCell("A1", "value"), excelmetadata.CellMetadata{Address: "A2", StyleID: 1}, newCell("A3", true))
+			r := recreate(t, &excelmetadata.Metadata{Styles: styles, Sheets: []excelmetadata.SheetMetadata{sheet}}, options)
+
+			sheetXML := partXML(t, r.File, "xl/worksheets/sheet2.xml")
+			if written := strings.Contains(sheetXML, `<c r="A2"`); written != tt.wantCell {
+				t.Fatalf("A2 written = %v, want %v", written, tt.wantCell)
+			}
+			if !tt.wantCell {
+				return
+			}
+			cellType, err := r.File.GetCellType("Data", "A2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cellType != tt.wantType {
+				t.Errorf("A2 type = %v, want %v", cellType, tt.wantType)
+			}
+			if got := getCellValue(t, r, "Data", "A2"); got != "" {
+				t.Errorf("A2 = %q, want empty", got)
+			}
+			styleID, err := r.File.GetCellStyle("Data", "A2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if styleID == 0 {
+				t.Error("A2 style not kept")
+			}
+			if got := getCellValue(t, r, "Data", "A3"); got != "TRUE" {
+				t.Errorf("A3 = %q, want %q", got, "TRUE")
+			}
+		})
+	}
+}
+
+func TestThreadedComment(t *testing.T) {
+	tests := []struct {
+		name         string
+		comments     map[string]*Comment
+		wantWarnings []string // Cells with a threaded comment warning
+	}{
+		{
+			name:         "threaded comment",
+			comments:     map[string]*Comment{"B2": {Author: "Alice", Text: "Reply here", Threaded: true}},
+			wantWarnings: []string{"B2"},
+		},
+		{
+			name:     "legacy comment",
+			comments: map[string]*Comment{"B2": {Author: "Alice", Text: "A note"}},
+		},
+		{
+			name: "one of each",
+			comments: map[string]*Comment{
+				"B2": {Author: "Alice", Text: "A note"},
+				"C3": {Author: "Bob", Text: "Reply here", Threaded: true},
+			},
+			wantWarnings: []string{"C3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cells := make(map[string]*CellOptions)
+			for address, comment := range tt.comments {
+				cells[address] = &CellOptions{Comment: comment}
+			}
+			options := DefaultOptions()
+			options.Sheets = map[string]*SheetOptions{"Data": {Cells: cells}}
+			sheet := newSheet(0, "Data", newCell("B2", 1), newCell("C3", 2))
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{sheet}}, options)
+
+			comments, err := r.File.GetComments("Data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(comments) != len(tt.comments) {
+				t.Fatalf("comments = %d, want %d", len(comments), len(tt.comments))
+			}
+			for _, comment := range comments {
+				if want := tt.comments[comment.Cell]; want == nil || comment.Author != want.Author || !strings.Contains(comment.Text, want.Text) {
+					t.Errorf("comment %s = %q by %q", comment.Cell, comment.Text, comment.Author)
+				}
+			}
+
+			var warnings []string
+			for _, w := range r.Warnings() {
+				if w.Code == WarningThreadedComment {
+					warnings = append(warnings, w.Address)
+				}
+			}
+			if !slices.Equal(warnings, tt.wantWarnings) {
+				t.Errorf("threaded comment warnings = %v, want %v", warnings, tt.wantWarnings)
+			}
+			if got := hasWarning(r, WarningThreadedComment); got != (len(tt.wantWarnings) > 0) {
+				t.Errorf("threaded comment warning = %v, want %v", got, len(tt.wantWarnings) > 0)
+			}
+		})
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	tests := []struct {
+		name  string
+		sheet excelmetadata.SheetMetadata
+		want  []Warning
+	}{
+		{
+			name:  "dangling style",
+			sheet: newSheet(0, "Data", excelmetadata.CellMetadata{Address: "B2", Value: 1, StyleID: 99}),
+			want:  []Warning{{SheetName: "Data", Address: "B2", Code: WarningStyleMissing, Message: "style 99 not found"}},
+		},
+		{
+			name:  "sanitized name",
+			sheet: newSheet(0, "Q1/Q2", newCell("A1", 1)),
+			want:  []Warning{{SheetName: "Q1_Q2", Code: WarningSheetSanitized, Message: `invalid sheet name "Q1/Q2" renamed to Q1_Q2`}},
+		},
+		{
+			name: "dangling style and sanitized name",
+			sheet: newSheet(0, "[Data]", newCell("A1", 1),
+				excelmetadata.CellMetadata{Address: "C3", Value: "x", StyleID: 7}),
+			want: []Warning{
+				{SheetName: "_Data_", Code: WarningSheetSanitized, Message: `invalid sheet name "[Data]" renamed to _Data_`},
+				{SheetName: "_Data_", Address: "C3", Code: WarningStyleMissing, Message: "style 7 not found"},
+			},
+		},
+		{
+			name: "failed image",
+			sheet: func() excelmetadata.SheetMetadata {
+				sheet := newSheet(0, "Data", newCell("A1", 1))
+				sheet.Images = []excelmetadata.ImageMetadata{{Cell: "B2", File: []byte("not an image"), Extension: ".png"}}
+				return sheet
+			}(),
+			want: []Warning{{SheetName: "Data", Address: "B2", Code: WarningImageFailed}},
+		},
+		{
+			name:  "no warnings",
+			sheet: newSheet(0, "Data", newCell("A1", 1)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{tt.sheet}}, DefaultOptions())
+
+			got := r.Warnings()
+			if len(got) != len(tt.want) {
+				t.Fatalf("warnings = %+v, want %+v", got, tt.want)
+			}
+			for i, want := range tt.want {
+				if want.Message == "" {
+					want.Message = got[i].Message
+				}
+				if got[i] != want {
+					t.Errorf("warning %d = %+v, want %+v", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestSanitizeSheetName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Data", want: "Data"},
+		{name: "", want: ""},
+		{name: `a:b\c/d?e*f[g]h`, want: "a_b_c_d_e_f_g_h"},
+		{name: "'quoted'", want: "quoted"},
+		{name: "it's", want: "it's"},
+		{name: "'''", want: ""},
+		{name: strings.Repeat("x", 40), want: strings.Repeat("x", 31)},
+		{name: strings.Repeat("x", 30) + "'y", want: strings.Repeat("x", 30)},
+		{name: strings.Repeat("表", 35), want: strings.Repeat("表", 31)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeSheetName(tt.name); got != tt.want {
+				t.Errorf("sanitizeSheetName(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxRowsCols(t *testing.T) {
+	styles := map[int]excelmetadata.StyleDetails{1: {Font: &excelmetadata.FontStyle{Bold: true}}}
+	rowsSheet := func() excelmetadata.SheetMetadata {
+		sheet := newSheet(0, "Data", newCell("A1", "head"), newCell("B1000000", "last"), newCell("A2000000", "far"), newCell("C2000000", "farther"))
+		sheet.RowHeights = map[int]float64{5: 20, 2000000: 30}
+		sheet.MergedCells = []excelmetadata.MergedCell{{StartCell: "A10", EndCell: "B11"}, {StartCell: "A1999999", EndCell: "B2000000"}}
+		sheet.DataValidations = []excelmetadata.DataValidation{
+			{Range: "A2:A2000000", Type: "whole", Operator: "greaterThan", Formula1: "0"},
+			{Range: "C1500000:C2000000", Type: "whole", Operator: "greaterThan", Formula1: "0"},
+		}
+		return sheet
+	}
+	rowsOpts := &SheetOptions{
+		RowStyles:          map[int]int{3: 1, 2000000: 1},
+		RowOutlineLevels:   map[int]uint8{4: 1, 2000000: 1},
+		ConditionalFormats: []ConditionalFormat{{Range: "B1:B2000000", Rule: excelize.ConditionalFormatOptions{Type: "cell", Criteria: ">", Value: "1"}}},
+		Cells: map[string]*CellOptions{
+			"A1":       {Comment: &Comment{Author: "Alice", Text: "kept"}},
+			"A2000000": {Comment: &Comment{Author: "Alice", Text: "skipped"}, Validation: &excelmetadata.DataValidation{Type: "list", Formula1: `"a,b"`}},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		maxRows       int
+		maxCols       int
+		flushPerSheet bool
+		sheet         func() excelmetadata.SheetMetadata
+		sheetOpts     *SheetOptions
+		wantCells     map[string]bool // Maps cell addresses to whether they are written
+		wantDimension string
+		wantWarnings  []string // Capped warning messages
+		check         func(t *testing.T, r *Recreator)
+	}{
+		{
+			name:          "rows beyond 1,000,000 skipped",
+			maxRows:       1000000,
+			sheet:         rowsSheet,
+			sheetOpts:     rowsOpts,
+			wantCells:     map[string]bool{"A1": true, "B1000000": true, "A2000000": false, "C2000000": false},
+			wantDimension: "A1:B1000000",
+			wantWarnings: []string{
+				"1 row heights beyond the row or column cap skipped or cut",
+				"1 row outline levels beyond the row or column cap skipped or cut",
+				"1 row styles beyond the row or column cap skipped or cut",
+				"2 cells beyond the row or column cap skipped or cut",
+				"1 comments beyond the row or column cap skipped or cut",
+				"1 merges beyond the row or column cap skipped or cut",
+				"1 conditional format ranges beyond the row or column cap skipped or cut",
+				"2 data validation ranges beyond the row or column cap skipped or cut",
+				"1 cell validations beyond the row or column cap skipped or cut",
+			},
+			check: func(t *testing.T, r *Recreator) {
+				if height, _ := r.File.GetRowHeight("Data", 5); height != 20 {
+					t.Errorf("row 5 height = %v, want 20", height)
+				}
+				if level, _ := r.File.GetRowOutlineLevel("Data", 4); level != 1 {
+					t.Errorf("row 4 outline level = %d, want 1", level)
+				}
+				comments, _ := r.File.GetComments("Data")
+				if len(comments) != 1 || comments[0].Cell != "A1" {
+					t.Errorf("comments = %+v, want A1 only", comments)
+				}
+				merges, _ := r.File.GetMergeCells("Data")
+				if len(merges) != 1 || merges[0].GetStartAxis() != "A10" {
+					t.Errorf("merges = %v, want A10:B11 only", merges)
+				}
+				validations, _ := r.File.GetDataValidations("Data")
+				if len(validations) != 1 || validations[0].Sqref != "A2:A1000000" {
+					t.Errorf("validations = %+v, want A2:A1000000 only", validations)
+				}
+				formats, _ := r.File.GetConditionalFormats("Data")
+				if _, exists := formats["B1:B1000000"]; len(formats) != 1 || !exists {
+					t.Errorf("conditional formats = %v, want B1:B1000000", formats)
+				}
+			},
+		},
+		{
+			name:          "rows beyond 1,000,000 skipped with FlushPerSheet",
+			maxRows:       1000000,
+			flushPerSheet: true,
+			sheet:         rowsSheet,
+			sheetOpts:     &SheetOptions{RowStyles: rowsOpts.RowStyles, RowOutlineLevels: rowsOpts.RowOutlineLevels},
+			wantCells:     map[string]bool{"A1": true, "B1000000": true, "A2000000": false, "C2000000": false},
+			wantDimension: "A1:B1000000",
+			wantWarnings: []string{
+				"1 row heights beyond the row or column cap skipped or cut",
+				"1 row outline levels beyond the row or column cap skipped or cut",
+				"1 row styles beyond the row or column cap skipped or cut",
+				"2 cells beyond the row or column cap skipped or cut",
+				"1 merges beyond the row or column cap skipped or cut",
+				"2 data validation ranges beyond the row or column cap skipped or cut",
+			},
+		},
+		{
+			name:    "columns beyond C skipped",
+			maxCols: 3,
+			sheet: func() excelmetadata.SheetMetadata {
+				sheet := newSheet(0, "Data", newCell("A1", 1), newCell("C2", 2), newCell("E1", 3))
+				sheet.ColWidths = map[string]float64{"B:F": 20, "E": 30}
+				return sheet
+			},
+			sheetOpts:     &SheetOptions{ColOutlineLevels: map[string]uint8{"B": 1, "D": 1}},
+			wantCells:     map[string]bool{"A1": true, "C2": true, "E1": false},
+			wantDimension: "A1:C2",
+			wantWarnings: []string{
+				"1 column widths beyond the row or column cap skipped or cut",
+				"1 column outline levels beyond the row or column cap skipped or cut",
+				"1 cells beyond the row or column cap skipped or cut",
+			},
+			check: func(t *testing.T, r *Recreator) {
+				for col, want := range map[string]float64{"C": 20, "D": 9.140625, "E": 9.140625} {
+					if width, _ := r.File.GetColWidth("Data", col); width != want {
+						t.Errorf("column %s width = %v, want %v", col, width, want)
+					}
+				}
+				if level, _ := r.File.GetColOutlineLevel("Data", "D"); level != 0 {
+					t.Errorf("column D outline level = %d, want 0", level)
+				}
+			},
+		},
+		{
+			name: "no cap",
+			sheet: func() excelmetadata.SheetMetadata {
+				return newSheet(0, "Data", newCell("A1", 1), newCell("E5", 2))
+			},
+			sheetOpts:     &SheetOptions{},
+			wantCells:     map[string]bool{"A1": true, "E5": true},
+			wantDimension: "A1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.MaxRows, options.MaxCols = tt.maxRows, tt.maxCols
+			options.FlushPerSheet = tt.flushPerSheet
+			options.Sheets = map[string]*SheetOptions{"Data": tt.sheetOpts}
+			r := recreate(t, &excelmetadata.Metadata{Styles: styles, Sheets: []excelmetadata.SheetMetadata{tt.sheet()}}, options)
+
+			sheetXML := partXML(t, r.File, "xl/worksheets/sheet2.xml")
+			for address, want := range tt.wantCells {
+				if written := strings.Contains(sheetXML, `<c r="`+address+`"`); written != want {
+					t.Errorf("%s written = %v, want %v", address, written, want)
+				}
+			}
+			if !strings.Contains(sheetXML, `<dimension ref="`+tt.wantDimension+`"`) {
+				t.Errorf("dimension = %s, want %s", regexp.MustCompile(`<dimension[^>]*>`).FindString(sheetXML), tt.wantDimension)
+			}
+			var warnings []string
+			for _, w := range r.Warnings() {
+				if w.Code == WarningCapped {
+					warnings = append(warnings, w.Message)
+				}
+			}
+			if !slices.Equal(warnings, tt.wantWarnings) {
+				t.Errorf("capped warnings = %q, want %q", warnings, tt.wantWarnings)
+			}
+			if tt.check != nil {
+				tt.check(t, r)
+			}
+		})
+	}
+}
+
+func TestCapSqref(t *testing.T) {
+	tests := []struct {
+		sqref   string
+		want    string
+		wantCut bool
+	}{
+		{sqref: "A1:B10", want: "A1:B10"},
+		{sqref: "A1:D20", want: "A1:C10", wantCut: true},
+		{sqref: "$A$5:$A$50", want: "A5:A10", wantCut: true},
+		{sqref: "A1:A5 D1:D5", want: "A1:A5", wantCut: true},
+		{sqref: "A1:A5 B11:B20", want: "A1:A5", wantCut: true},
+		{sqref: "D1", want: "", wantCut: true},
+		{sqref: "A1:A5 bad", want: "A1:A5 bad"},
+	}
+
+	options := &Options{MaxRows: 10, MaxCols: 3}
+	for _, tt := range tests {
+		t.Run(tt.sqref, func(t *testing.T) {
+			got, cut := options.capSqref(tt.sqref)
+			if got != tt.want || cut != tt.wantCut {
+				t.Errorf("capSqref(%q) = %q, %v, want %q, %v", tt.sqref, got, cut, tt.want, tt.wantCut)
+			}
+		})
+	}
+}
+
+func TestAddHighlightRule(t *testing.T) {
+	tests := []struct {
+		name         string
+		rangeRef     string
+		operator     string
+		value        interface{}
+		fillColor    string
+		wantCriteria string
+		wantValue    string
+		wantColor    string
+		wantErr      string
+	}{
+		{
+			name: "greater than 100 red", rangeRef: "B2:B10", operator: ">", value: 100, fillColor: "#FF0000",
+			wantCriteria: "greater than", wantValue: "100", wantColor: "FF0000",
+		},
+		{
+			name: "text value", rangeRef: "A2:A10", operator: "equal to", value: `say "hi"`, fillColor: "00ff00",
+			wantCriteria: "equal to", wantValue: `"say ""hi"""`, wantColor: "00FF00",
+		},
+		{
+			name: "bool value", rangeRef: "C2:C10", operator: "<>", value: true, fillColor: "#0000FF",
+			wantCriteria: "not equal to", wantValue: "TRUE", wantColor: "0000FF",
+		},
+		{name: "unsupported operator", rangeRef: "B2:B10", operator: "between", value: 1, fillColor: "#FF0000", wantErr: `unsupported highlight operator "between"`},
+		{name: "invalid range", rangeRef: "B0:B10", operator: ">", value: 1, fillColor: "#FF0000", wantErr: "highlight rule B0:B10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("B2", 150))}}, DefaultOptions())
+			err := r.AddHighlightRule("Data", tt.rangeRef, tt.operator, tt.value, tt.fillColor)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("AddHighlightRule() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AddHighlightRule() error = %v", err)
+			}
+
+			formats, err := r.File.GetConditionalFormats("Data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			rules := formats[tt.rangeRef]
+			if len(rules) != 1 {
+				t.Fatalf("rules of %s = %+v, want 1", tt.rangeRef, formats)
+			}
+			rule := rules[0]
+			if rule.Type != "cell" || rule.Criteria != tt.wantCriteria || rule.Value != tt.wantValue {
+				t.Errorf("rule = %s %s %s, want cell %s %s", rule.Type, rule.Criteria, rule.Value, tt.wantCriteria, tt.wantValue)
+			}
+			if rule.Format == nil {
+				t.Fatal("rule has no format")
+			}
+			style, err := r.File.GetConditionalStyle(*rule.Format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(style.Fill.Color) != 1 || !strings.EqualFold(strings.TrimPrefix(style.Fill.Color[0], "#"), tt.wantColor) {
+				t.Errorf("fill = %v, want %s", style.Fill.Color, tt.wantColor)
+			}
+		})
+	}
+}
+
+func TestCoerceDates(t *testing.T) {
+	date := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	styles := map[int]excelmetadata.StyleDetails{
+		1: {NumberFormat: 14}, // Date
+		2: {NumberFormat: 4},  // #,##0.00
+		3: {NumberFormat: 46}, // [h]:mm:ss
+	}
+
+	tests := []struct {
+		name     string
+		value    interface{}
+		styleID  int
+		coerce   bool
+		date1904 bool
+		want     time.Time // Zero when the value is not written as a date serial
+		wantRaw  string    // Raw value when want is zero
+	}{
+		{name: "serial number", value: 44927, styleID: 1, coerce: true, want: date},
+		{name: "serial string", value: "44927", styleID: 1, coerce: true, want: date},
+		{name: "display string", value: "2023-01-01", styleID: 1, coerce: true, want: date},
+		{name: "display string with time", value: "1/1/2023 06:00", styleID: 1, coerce: true, want: date.Add(6 * time.Hour)},
+		{name: "time", value: date, styleID: 1, coerce: true, want: date},
+		{name: "1904 date system", value: "2023-01-01", styleID: 1, coerce: true, date1904: true, want: date},
+		{name: "elapsed time format", value: "2023-01-01", styleID: 3, coerce: true, want: date},
+		{name: "unparsed string kept", value: "soon", styleID: 1, coerce: true, wantRaw: "soon"},
+		{name: "number format kept", value: "2023-01-01", styleID: 2, coerce: true, wantRaw: "2023-01-01"},
+		{name: "not coerced", value: "2023-01-01", styleID: 1, wantRaw: "2023-01-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.CoerceDates = tt.coerce
+			options.Date1904 = tt.date1904
+			sheet := newSheet(0, "Data", excelmetadata.CellMetadata{Address: "A1", Value: tt.value, StyleID: tt.styleID})
+			r := recreate(t, &excelmetadata.Metadata{Styles: styles, Sheets: []excelmetadata.SheetMetadata{sheet}}, options)
+
+			raw, err := r.File.GetCellValue("Data", "A1", excelize.Options{RawCellValue: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want.IsZero() {
+				if raw != tt.wantRaw {
+					t.Errorf("A1 = %q, want %q", raw, tt.wantRaw)
+				}
+				return
+			}
+			serial, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				t.Fatalf("A1 = %q, want a date serial", raw)
+			}
+			got, err := excelize.ExcelDateToTime(serial, tt.date1904)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("A1 = %s (serial %s), want %s", got, raw, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDateNumFmtCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{code: "yyyy-mm-dd", want: true},
+		{code: "d mmm", want: true},
+		{code: "hh:mm:ss", want: true},
+		{code: "[h]:mm", want: true},
+		{code: "[hh]", want: true},
+		{code: "[m]", want: true},
+		{code: "[mm]:ss", want: true},
+		{code: "[s]", want: true},
+		{code: "[$-409]yyyy", want: true},
+		{code: "[Red]dd/mm/yy", want: true},
+		{code: "0.00"},
+		{code: "General"},
+		{code: "#,##0"},
+		{code: "[Red]0.00"},
+		{code: "[$-409]#,##0"},
+		{code: `0.0 "days"`},
+		{code: `0\d`},
+		{code: "[>100]0;0.00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			if got := isDateNumFmtCode(tt.code); got != tt.want {
+				t.Errorf("isDateNumFmtCode(%q) = %v, want %v", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeHyperlink(t *testing.T) {
+	tests := []struct {
+		link string
+		want string
+	}{
+		{link: "www.example.com ", want: "https://www.example.com"},
+		{link: "WWW.Example.com/a b", want: "https://WWW.Example.com/a%20b"},
+		{link: "example.com", want: "https://example.com"},
+		{link: "example.co.uk/path?q=a b", want: "https://example.co.uk/path?q=a%20b"},
+		{link: "localhost.dev:8080/status", want: "https://localhost.dev:8080/status"},
+		{link: "https://example.com/a b", want: "https://example.com/a%20b"},
+		{link: "a@example.com", want: "mailto:a@example.com"},
+		{link: "mailto:a@example.com", want: "mailto:a@example.com"},
+		{link: "Sheet2!A1", want: "Sheet2!A1"},
+		{link: "#Sheet2!A1", want: "#Sheet2!A1"},
+		{link: "report.xlsx", want: "report.xlsx"},
+		{link: "docs/report.pdf", want: "docs/report.pdf"},
+		{link: "../shared/data.csv", want: "../shared/data.csv"},
+		{link: `C:\reports\q1.xlsx`, want: `C:\reports\q1.xlsx`},
+		{link: `\\server\share\q1.xlsx`, want: `\\server\share\q1.xlsx`},
+		{link: "v1.2", want: "v1.2"},
+		{link: " Summary ", want: "Summary"},
+		{link: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.link, func(t *testing.T) {
+			if got := normalizeHyperlink(tt.link); got != tt.want {
+				t.Errorf("normalizeHyperlink(%q) = %q, want %q", tt.link, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeHyperlinks(t *testing.T) {
+	tests := []struct {
+		name         string
+		link         string
+		normalize    bool
+		wantLink     string
+		wantExternal bool
+		wantWarning  bool
+	}{
+		{name: "web address", link: "www.example.com ", normalize: true, wantLink: "https://www.example.com", wantExternal: true, wantWarning: true},
+		{name: "relative file kept", link: "docs/report.pdf", normalize: true, wantLink: "docs/report.pdf"},
+		{name: "workbook location kept", link: "Sheet2!A1", normalize: true, wantLink: "Sheet2!A1"},
+		{name: "not normalized", link: "www.example.com ", wantLink: "www.example.com "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.NormalizeHyperlinks = tt.normalize
+			sheet := newSheet(0, "Data", excelmetadata.CellMetadata{Address: "A1", Value: "link", Hyperlink: &excelmetadata.Hyperlink{Link: tt.link}})
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{sheet}}, options)
+
+			exists, link, err := r.File.GetCellHyperLink("Data", "A1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !exists || link != tt.wantLink {
+				t.Errorf("hyperlink = %v %q, want %q", exists, link, tt.wantLink)
+			}
+			// External links refer to a relationship, locations are inline
+			hyperlink := regexp.MustCompile(`<hyperlink [^>]*>`).FindString(partXML(t, r.File, "xl/worksheets/sheet2.xml"))
+			if external := strings.Contains(hyperlink, `r:id="`); external != tt.wantExternal {
+				t.Errorf("external = %v, want %v (%s)", external, tt.wantExternal, hyperlink)
+			}
+			if got := hasWarning(r, WarningHyperlinkFixed); got != tt.wantWarning {
+				t.Errorf("hyperlink fixed warning = %v, want %v", got, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestProtectionAlgorithm(t *testing.T) {
+	tests := []struct {
+		name          string
+		algorithm     string
+		password      string
+		wantAlgorithm string // algorithmName of the saved sheetProtection, "" for the XOR hash
+		wantErr       error
+	}{
+		{name: "SHA-512", algorithm: "SHA-512", password: "secret", wantAlgorithm: "SHA-512"},
+		{name: "SHA-256 lower case", algorithm: "sha-256", password: "secret", wantAlgorithm: "SHA-256"},
+		{name: "MD5", algorithm: "MD5", password: "secret", wantAlgorithm: "MD5"},
+		{name: "XOR", algorithm: "XOR", password: "secret"},
+		{name: "default XOR", password: "secret"},
+		{name: "no password", algorithm: "SHA-512"},
+		{name: "unsupported algorithm", algorithm: "SHA-3", password: "secret", wantErr: excelize.ErrUnsupportedHashAlgorithm},
+		{name: "unsupported algorithm without password", algorithm: "bcrypt", wantErr: excelize.ErrUnsupportedHashAlgorithm},
+		{name: "password too long", algorithm: "SHA-512", password: strings.Repeat("x", excelize.MaxFieldLength+1), wantErr: excelize.ErrPasswordLengthInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.Sheets = map[string]*SheetOptions{"Data": {ProtectionAlgorithm: tt.algorithm}}
+			sheet := newSheet(0, "Data", newCell("A1", 1))
+			sheet.Protection = &excelmetadata.SheetProtection{Protected: true, Password: tt.password}
+			r := New(&excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{sheet}}, options)
+			err := r.Recreate()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Recreate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Recreate() error = %v", err)
+			}
+
+			// Round trip through a saved file, whose protection must accept
+			// the password and reject others
+			buf, err := r.File.WriteToBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := excelize.OpenReader(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			protection := regexp.MustCompile(`<sheetProtection[^>]*>`).FindString(partXML(t, f, "xl/worksheets/sheet2.xml"))
+			if protection == "" {
+				t.Fatal("sheet not protected")
+			}
+			var algorithm string
+			if match := regexp.MustCompile(`algorithmName="([^"]*)"`).FindStringSubmatch(protection); match != nil {
+				algorithm = match[1]
+			}
+			if algorithm != tt.wantAlgorithm {
+				t.Errorf("algorithm = %q, want %q (%s)", algorithm, tt.wantAlgorithm, protection)
+			}
+			if tt.password == "" {
+				return
+			}
+			if err := f.UnprotectSheet("Data", "wrong"); err == nil {
+				t.Error("UnprotectSheet() with a wrong password succeeded")
+			}
+			if err := f.UnprotectSheet("Data", tt.password); err != nil {
+				t.Errorf("UnprotectSheet() error = %v", err)
+			}
+		})
+	}
+}
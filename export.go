@@ -0,0 +1,152 @@
+package excelrecreator
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/prongbang/excelmetadata"
+	"github.com/xuri/excelize/v2"
+)
+
+// ExportSheetHTML writes a sheet from metadata as an HTML table. Merged cells
+// become rowspan/colspan cells, and bold, italic, font color and size, fill
+// and alignment are applied as inline styles.
+func ExportSheetHTML(w io.Writer, metadata *excelmetadata.Metadata, sheetName string) error {
+	if metadata == nil {
+		return fmt.Errorf("metadata is nil")
+	}
+
+	sheet := findSheet(metadata, sheetName)
+	if sheet == nil {
+		return fmt.Errorf("sheet %s not found", sheetName)
+	}
+
+	maxCol, maxRow := 0, 0
+	cells := make(map[[2]int]excelmetadata.CellMetadata)
+	for _, cell := range sheet.Cells {
+		col, row, err := excelize.CellNameToCoordinates(cell.Address)
+		if err != nil {
+			return fmt.Errorf("invalid cell address %s: %w", cell.Address, err)
+		}
+		cells[[2]int{col, row}] = cell
+		maxCol, maxRow = max(maxCol, col), max(maxRow, row)
+	}
+
+	spans := make(map[[2]int][2]int) // Maps top-left cells to rowspan and colspan
+	covered := make(map[[2]int]bool)
+	mergeValues := make(map[[2]int]string)
+	for _, merge := range sheet.MergedCells {
+		col1, row1, err := excelize.CellNameToCoordinates(merge.StartCell)
+		if err != nil {
+			return fmt.Errorf("invalid merge start cell %s: %w", merge.StartCell, err)
+		}
+		col2, row2, err := excelize.CellNameToCoordinates(merge.EndCell)
+		if err != nil {
+			return fmt.Errorf("invalid merge end cell %s: %w", merge.EndCell, err)
+		}
+		// A merge may be stored with its corners reversed, e.g. C3:A1
+		col1, col2 = min(col1, col2), max(col1, col2)
+		row1, row2 = min(row1, row2), max(row1, row2)
+		spans[[2]int{col1, row1}] = [2]int{row2 - row1 + 1, col2 - col1 + 1}
+		mergeValues[[2]int{col1, row1}] = merge.Value
+		for row := row1; row <= row2; row++ {
+			for col := col1; col <= col2; col++ {
+				if col != col1 || row != row1 {
+					covered[[2]int{col, row}] = true
+				}
+			}
+		}
+		maxCol, maxRow = max(maxCol, col2), max(maxRow, row2)
+	}
+
+	var b strings.Builder
+	b.WriteString("<table>\n")
+	for row := 1; row <= maxRow; row++ {
+		b.WriteString("<tr>")
+		for col := 1; col <= maxCol; col++ {
+			pos := [2]int{col, row}
+			if covered[pos] {
+				continue
+			}
+
+			b.WriteString("<td")
+			if span, exists := spans[pos]; exists {
+				if span[0] > 1 {
+					fmt.Fprintf(&b, ` rowspan="%d"`, span[0])
+				}
+				if span[1] > 1 {
+					fmt.Fprintf(&b, ` colspan="%d"`, span[1])
+				}
+			}
+
+			cell, exists := cells[pos]
+			if exists {
+				if style, ok := metadata.Styles[cell.StyleID]; ok {
+					if css := styleCSS(style); css != "" {
+						fmt.Fprintf(&b, ` style="%s"`, html.EscapeString(css))
+					}
+				}
+			}
+			b.WriteString(">")
+
+			text := ""
+			if exists && cell.Value != nil {
+				text = fmt.Sprintf("%v", cell.Value)
+			} else if value, ok := mergeValues[pos]; ok {
+				text = value
+			}
+			b.WriteString(html.EscapeString(text))
+			b.WriteString("</td>")
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("</table>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// styleCSS converts the basic parts of a style to inline CSS
+func styleCSS(style excelmetadata.StyleDetails) string {
+	var rules []string
+
+	if style.Font != nil {
+		if style.Font.Bold {
+			rules = append(rules, "font-weight:bold")
+		}
+		if style.Font.Italic {
+			rules = append(rules, "font-style:italic")
+		}
+		if style.Font.Color != "" {
+			rules = append(rules, "color:"+cssColor(style.Font.Color))
+		}
+		if style.Font.Size > 0 {
+			rules = append(rules, fmt.Sprintf("font-size:%gpt", style.Font.Size))
+		}
+	}
+
+	if style.Fill != nil && len(style.Fill.Color) > 0 && style.Fill.Color[0] != "" {
+		rules = append(rules, "background-color:"+cssColor(style.Fill.Color[0]))
+	}
+
+	if style.Alignment != nil {
+		if style.Alignment.Horizontal != "" {
+			rules = append(rules, "text-align:"+style.Alignment.Horizontal)
+		}
+		switch style.Alignment.Vertical {
+		case "center":
+			rules = append(rules, "vertical-align:middle")
+		case "top", "bottom":
+			rules = append(rules, "vertical-align:"+style.Alignment.Vertical)
+		}
+	}
+
+	return strings.Join(rules, ";")
+}
+
+// cssColor converts a metadata color to a CSS color
+func cssColor(color string) string {
+	return "#" + normalizeColor(color)
+}
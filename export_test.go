@@ -0,0 +1,74 @@
+package excelrecreator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prongbang/excelmetadata"
+)
+
+func TestExportSheetHTML(t *testing.T) {
+	metadata := &excelmetadata.Metadata{
+		Sheets: []excelmetadata.SheetMetadata{{
+			Name: "Report",
+			Cells: []excelmetadata.CellMetadata{
+				{Address: "A1", Value: "Title", StyleID: 1},
+				newCell("A2", "a<b"),
+				newCell("B2", 2),
+			},
+			MergedCells: []excelmetadata.MergedCell{{StartCell: "A1", EndCell: "B1"}, {StartCell: "C1", EndCell: "C2", Value: "Side"}},
+		}, {
+			Name:        "Reversed",
+			Cells:       []excelmetadata.CellMetadata{newCell("D4", "after")},
+			MergedCells: []excelmetadata.MergedCell{{StartCell: "C3", EndCell: "A1", Value: "Block"}, {StartCell: "D2", EndCell: "D1", Value: "Tall"}},
+		}},
+		Styles: map[int]excelmetadata.StyleDetails{1: {
+			Font:      &excelmetadata.FontStyle{Bold: true},
+			Fill:      &excelmetadata.FillStyle{Type: "pattern", Pattern: 1, Color: []string{"FFFF00"}},
+			Alignment: &excelmetadata.AlignmentStyle{Horizontal: "center", Vertical: "center"},
+		}},
+	}
+
+	tests := []struct {
+		name      string
+		sheetName string
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:      "merged and styled cells",
+			sheetName: "Report",
+			want: []string{
+				`<td colspan="2" style="font-weight:bold;background-color:#FFFF00;text-align:center;vertical-align:middle">Title</td>`,
+				`<td rowspan="2">Side</td>`,
+				`<tr><td>a&lt;b</td><td>2</td></tr>`,
+			},
+		},
+		{
+			name:      "merge with reversed corners",
+			sheetName: "Reversed",
+			want: []string{
+				`<tr><td rowspan="3" colspan="3">Block</td><td rowspan="2">Tall</td></tr>`,
+				`<tr></tr>`,
+				`<tr><td></td></tr>`,
+				`<tr><td></td><td></td><td></td><td>after</td></tr>`,
+			},
+		},
+		{name: "missing sheet", sheetName: "Missing", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			err := ExportSheetHTML(&b, metadata, tt.sheetName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExportSheetHTML() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(b.String(), want) {
+					t.Errorf("HTML = %s, want it to contain %s", b.String(), want)
+				}
+			}
+		})
+	}
+}
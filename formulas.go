@@ -0,0 +1,222 @@
+package excelrecreator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prongbang/excelmetadata"
+	"github.com/xuri/efp"
+	"github.com/xuri/excelize/v2"
+)
+
+// formulaCell is a formula cell node in the dependency graph
+type formulaCell struct {
+	sheet   string
+	formula string
+}
+
+// cellRange is a rectangular reference parsed from a formula
+type cellRange struct {
+	sheet      string
+	col1, row1 int
+	col2, row2 int
+}
+
+// DetectCircularReferences builds a dependency graph from the references in
+// formula cells and returns each cycle as a list of "Sheet!A1" addresses. The
+// first address is repeated at the end of each cycle.
+func DetectCircularReferences(metadata *excelmetadata.Metadata) [][]string {
+	if metadata == nil {
+		return nil
+	}
+
+	// Formula cells are indexed by position, so a reference looks up the
+	// cells it covers instead of scanning the whole sheet
+	nodes := make(map[string]formulaCell)
+	bySheet := make(map[string]map[[2]int]string) // Maps sheets to formula cell keys by column and row
+	for _, sheet := range metadata.Sheets {
+		sheetKey := strings.ToLower(sheet.Name)
+		for _, cell := range sheet.Cells {
+			if cell.Formula == "" {
+				continue
+			}
+			col, row, err := excelize.CellNameToCoordinates(cell.Address)
+			if err != nil {
+				continue
+			}
+			key := formulaCellKey(sheet.Name, cell.Address)
+			nodes[key] = formulaCell{sheet: sheet.Name, formula: cell.Formula}
+			if bySheet[sheetKey] == nil {
+				bySheet[sheetKey] = make(map[[2]int]string)
+			}
+			bySheet[sheetKey][[2]int{col, row}] = key
+		}
+	}
+
+	// Only formula cells can take part in a cycle, so edges point from a
+	// formula cell to the formula cells inside the ranges it references
+	edges := make(map[string][]string)
+	for key, node := range nodes {
+		for _, ref := range formulaReferences(node.sheet, node.formula) {
+			edges[key] = append(edges[key], ref.formulaCells(bySheet[strings.ToLower(ref.sheet)])...)
+		}
+		sort.Strings(edges[key])
+	}
+
+	keys := make([]string, 0, len(nodes))
+	for key := range nodes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Depth-first search with an explicit stack, as formula chains can be
+	// too long to recurse
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	type frame struct {
+		key  string
+		next int // Index of the next edge to follow
+	}
+	state := make(map[string]int)
+	depth := make(map[string]int) // Stack positions of the visiting cells
+	var cycles [][]string
+
+	for _, root := range keys {
+		if state[root] != unvisited {
+			continue
+		}
+		state[root], depth[root] = visiting, 0
+		stack := []frame{{key: root}}
+		for len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			if top.next == len(edges[top.key]) {
+				state[top.key] = visited
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			next := edges[top.key][top.next]
+			top.next++
+			switch state[next] {
+			case unvisited:
+				state[next], depth[next] = visiting, len(stack)
+				stack = append(stack, frame{key: next})
+			case visiting:
+				// Back edge: the cycle is the stack from next to the top
+				cycle := make([]string, 0, len(stack)-depth[next]+1)
+				for _, f := range stack[depth[next]:] {
+					cycle = append(cycle, f.key)
+				}
+				cycles = append(cycles, append(cycle, next))
+			}
+		}
+	}
+
+	return cycles
+}
+
+// formulaCells returns the keys of the formula cells inside the range, looking
+// up each covered cell of small ranges and scanning the sheet for large ones
+func (c cellRange) formulaCells(cells map[[2]int]string) []string {
+	var keys []string
+	if area := (c.col2 - c.col1 + 1) * (c.row2 - c.row1 + 1); area <= len(cells) {
+		for row := c.row1; row <= c.row2; row++ {
+			for col := c.col1; col <= c.col2; col++ {
+				if key, exists := cells[[2]int{col, row}]; exists {
+					keys = append(keys, key)
+				}
+			}
+		}
+		return keys
+	}
+	for pos, key := range cells {
+		if pos[0] >= c.col1 && pos[0] <= c.col2 && pos[1] >= c.row1 && pos[1] <= c.row2 {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// formulaCellKey returns the "Sheet!A1" key of a cell
+func formulaCellKey(sheetName, address string) string {
+	return fmt.Sprintf("%s!%s", sheetName, strings.ToUpper(strings.ReplaceAll(address, "$", "")))
+}
+
+// formulaReferences returns the cell and range references in a formula.
+// References without a sheet prefix belong to sheetName; defined names and
+// other operands that are not cell references are ignored.
+func formulaReferences(sheetName, formula string) []cellRange {
+	var refs []cellRange
+
+	ps := efp.ExcelParser()
+	for _, token := range ps.Parse(formula) {
+		if token.TType != efp.TokenTypeOperand || token.TSubType != efp.TokenSubTypeRange {
+			continue
+		}
+
+		ref := token.TValue
+		sheet := sheetName
+		if i := strings.LastIndex(ref, "!"); i != -1 {
+			sheet = strings.Trim(ref[:i], "'")
+			ref = ref[i+1:]
+		}
+
+		parts := strings.Split(strings.ReplaceAll(ref, "$", ""), ":")
+		if len(parts) > 2 {
+			continue
+		}
+		if len(parts) == 1 {
+			// A single operand is either a cell or a defined name
+			if _, _, err := excelize.CellNameToCoordinates(parts[0]); err != nil {
+				continue
+			}
+			parts = append(parts, parts[0])
+		}
+
+		col1, row1, ok1 := parseReferencePart(parts[0], true)
+		col2, row2, ok2 := parseReferencePart(parts[1], false)
+		if !ok1 || !ok2 {
+			continue
+		}
+		if col1 > col2 {
+			col1, col2 = col2, col1
+		}
+		if row1 > row2 {
+			row1, row2 = row2, row1
+		}
+		refs = append(refs, cellRange{sheet: sheet, col1: col1, row1: row1, col2: col2, row2: row2})
+	}
+
+	return refs
+}
+
+// parseReferencePart parses a cell ("A1"), column ("A") or row ("1") reference.
+// Whole columns and rows expand to the first or last row or column.
+func parseReferencePart(part string, start bool) (col, row int, ok bool) {
+	if col, row, err := excelize.CellNameToCoordinates(part); err == nil {
+		return col, row, true
+	}
+	if col, err := excelize.ColumnNameToNumber(part); err == nil {
+		if start {
+			return col, 1, true
+		}
+		return col, excelize.TotalRows, true
+	}
+	if row, err := strconv.Atoi(part); err == nil && row > 0 {
+		if start {
+			return 1, row, true
+		}
+		return excelize.MaxColumns, row, true
+	}
+	return 0, 0, false
+}
+
+// normalizeFormula removes a single leading "=", which some metadata stores
+// and the cell formula and defined name XML must not contain
+func normalizeFormula(formula string) string {
+	return strings.TrimPrefix(formula, "=")
+}
@@ -0,0 +1,119 @@
+package excelrecreator
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/prongbang/excelmetadata"
+)
+
+// newFormulaCell returns the metadata of a formula cell
+func newFormulaCell(address, formula string) excelmetadata.CellMetadata {
+	return excelmetadata.CellMetadata{Address: address, Formula: formula}
+}
+
+func TestDetectCircularReferences(t *testing.T) {
+	tests := []struct {
+		name   string
+		sheets []excelmetadata.SheetMetadata
+		want   [][]string
+	}{
+		{
+			name:   "two cells referencing each other",
+			sheets: []excelmetadata.SheetMetadata{newSheet(0, "S", newFormulaCell("A1", "=B1"), newFormulaCell("B1", "=A1"))},
+			want:   [][]string{{"S!A1", "S!B1", "S!A1"}},
+		},
+		{
+			name:   "self reference",
+			sheets: []excelmetadata.SheetMetadata{newSheet(0, "S", newFormulaCell("C3", "=C3+1"))},
+			want:   [][]string{{"S!C3", "S!C3"}},
+		},
+		{
+			name:   "range containing the formula",
+			sheets: []excelmetadata.SheetMetadata{newSheet(0, "S", newFormulaCell("A3", "=SUM(A1:A5)"))},
+			want:   [][]string{{"S!A3", "S!A3"}},
+		},
+		{
+			name:   "whole column reference",
+			sheets: []excelmetadata.SheetMetadata{newSheet(0, "S", newFormulaCell("B2", "=SUM(A:A)"), newFormulaCell("A9", "=B2*2"))},
+			want:   [][]string{{"S!A9", "S!B2", "S!A9"}},
+		},
+		{
+			name: "across sheets",
+			sheets: []excelmetadata.SheetMetadata{
+				newSheet(0, "One", newFormulaCell("A1", "='Two Sheet'!B2")),
+				newSheet(1, "Two Sheet", newFormulaCell("B2", "=One!$A$1")),
+			},
+			want: [][]string{{"One!A1", "Two Sheet!B2", "One!A1"}},
+		},
+		{
+			name: "no cycle",
+			sheets: []excelmetadata.SheetMetadata{newSheet(0, "S",
+				newCell("A1", 1), newFormulaCell("A2", "=A1*2"), newFormulaCell("A3", "=SUM(A1:A2)"), newFormulaCell("A4", "=MyName")),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DetectCircularReferences(&excelmetadata.Metadata{Sheets: tt.sheets})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DetectCircularReferences() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectCircularReferencesLongChain(t *testing.T) {
+	// Each cell references the next, and the last one the first
+	const length = 100000
+	cells := make([]excelmetadata.CellMetadata, length)
+	for i := range cells {
+		cells[i] = newFormulaCell(fmt.Sprintf("A%d", i+1), fmt.Sprintf("=A%d+1", (i+1)%length+1))
+	}
+	cycles := DetectCircularReferences(&excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "S", cells...)}})
+	if len(cycles) != 1 || len(cycles[0]) != length+1 {
+		t.Fatalf("found %d cycles, want one cycle of %d cells", len(cycles), length)
+	}
+}
+
+func TestNormalizeFormula(t *testing.T) {
+	tests := []struct {
+		name       string
+		formula    string
+		want       string
+		wantResult string
+	}{
+		{name: "with equals", formula: "=SUM(A1:A2)", want: "SUM(A1:A2)", wantResult: "5"},
+		{name: "without equals", formula: "SUM(A1:A2)", want: "SUM(A1:A2)", wantResult: "5"},
+		{name: "one equals trimmed", formula: "==A1", want: "=A1"},
+		{name: "comparison kept", formula: "A1=B1", want: "A1=B1", wantResult: "TRUE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeFormula(tt.formula); got != tt.want {
+				t.Errorf("normalizeFormula(%q) = %q, want %q", tt.formula, got, tt.want)
+			}
+
+			// Both stored forms calculate the same result
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data",
+				newCell("A1", 2.0), newCell("A2", 3.0), newCell("B1", 2.0), newFormulaCell("C1", tt.formula),
+			)}}, DefaultOptions())
+			formula, err := r.File.GetCellFormula("Data", "C1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if formula != tt.want {
+				t.Errorf("C1 formula = %q, want %q", formula, tt.want)
+			}
+			if tt.wantResult == "" {
+				return
+			}
+			if result, err := r.File.CalcCellValue("Data", "C1"); err != nil || result != tt.wantResult {
+				t.Errorf("C1 = %q, %v, want %q", result, err, tt.wantResult)
+			}
+		})
+	}
+}
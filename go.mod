@@ -4,6 +4,7 @@ go 1.23.4
 
 require (
 	github.com/prongbang/excelmetadata v1.1.2
+	github.com/xuri/efp v0.0.1
 	github.com/xuri/excelize/v2 v2.9.1
 )
 
@@ -11,7 +12,6 @@ require (
 	github.com/richardlehane/mscfb v1.0.4 // indirect
 	github.com/richardlehane/msoleps v1.0.4 // indirect
 	github.com/tiendc/go-deepcopy v1.6.0 // indirect
-	github.com/xuri/efp v0.0.1 // indirect
 	github.com/xuri/nfp v0.0.1 // indirect
 	golang.org/x/crypto v0.38.0 // indirect
 	golang.org/x/net v0.40.0 // indirect
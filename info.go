@@ -0,0 +1,62 @@
+package excelrecreator
+
+import (
+	"fmt"
+
+	"github.com/prongbang/excelmetadata"
+)
+
+// InfoSheetName is the sheet GenerateInfoSheet prepends to the workbook
+const InfoSheetName = "Workbook Info"
+
+// prependInfoSheet creates a sheet listing the document properties and an
+// inventory of the created sheets, and moves it before the first sheet.
+// positions holds the position of each sheet in Metadata.Sheets.
+func (r *Recreator) prependInfoSheet(sheets []excelmetadata.SheetMetadata, positions []int) error {
+	firstSheet := r.File.GetSheetName(0)
+
+	if index, err := r.File.GetSheetIndex(InfoSheetName); err != nil {
+		return err
+	} else if index != -1 {
+		return fmt.Errorf("sheet %s already exists", InfoSheetName)
+	}
+	if _, err := r.File.NewSheet(InfoSheetName); err != nil {
+		return err
+	}
+
+	props := r.Metadata.Properties
+	rows := [][]interface{}{
+		{"Property", "Value"},
+		{"Title", props.Title},
+		{"Subject", props.Subject},
+		{"Creator", props.Creator},
+		{"Keywords", props.Keywords},
+		{"Description", props.Description},
+		{"Last Modified By", props.LastModifiedBy},
+		{"Category", props.Category},
+		{"Version", props.Version},
+		{"Created", props.Created},
+		{"Modified", props.Modified},
+		{},
+		{"Sheet", "Rows", "Columns"},
+	}
+	for i, sheet := range sheets {
+		if sheetName, created := r.sheetNames[positions[i]]; created {
+			rows = append(rows, []interface{}{sheetName, sheet.Dimensions.RowCount, sheet.Dimensions.ColCount})
+		}
+	}
+
+	for i, row := range rows {
+		if len(row) == 0 {
+			continue
+		}
+		if err := r.File.SetSheetRow(InfoSheetName, fmt.Sprintf("A%d", i+1), &row); err != nil {
+			return err
+		}
+	}
+
+	if firstSheet == "" {
+		return nil
+	}
+	return r.File.MoveSheet(InfoSheetName, firstSheet)
+}
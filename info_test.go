@@ -0,0 +1,84 @@
+package excelrecreator
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/prongbang/excelmetadata"
+)
+
+func TestGenerateInfoSheet(t *testing.T) {
+	tests := []struct {
+		name       string
+		generate   bool
+		sheets     []excelmetadata.SheetMetadata
+		wantSheets []string
+		wantErr    bool
+	}{
+		{
+			name:       "prepended",
+			generate:   true,
+			sheets:     []excelmetadata.SheetMetadata{newSheet(0, "Data"), newSheet(1, "Summary")},
+			wantSheets: []string{InfoSheetName, "Data", "Summary"},
+		},
+		{
+			name:       "skipped",
+			sheets:     []excelmetadata.SheetMetadata{newSheet(0, "Data"), newSheet(1, "Summary")},
+			wantSheets: []string{"Data", "Summary"},
+		},
+		{
+			name:     "name taken",
+			generate: true,
+			sheets:   []excelmetadata.SheetMetadata{newSheet(0, InfoSheetName)},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := range tt.sheets {
+				tt.sheets[i].Dimensions = excelmetadata.SheetDimensions{RowCount: 10 * (i + 1), ColCount: i + 2}
+			}
+			metadata := &excelmetadata.Metadata{
+				Properties: excelmetadata.DocumentProperties{Title: "Quarterly Report", Creator: "Finance"},
+				Sheets:     tt.sheets,
+			}
+			options := DefaultOptions()
+			options.GenerateInfoSheet = tt.generate
+			r := New(metadata, options)
+			defer r.File.Close()
+
+			err := r.Recreate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Recreate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := r.File.GetSheetList(); !slices.Equal(got, tt.wantSheets) {
+				t.Errorf("sheets = %v, want %v", got, tt.wantSheets)
+			}
+			if !tt.generate {
+				return
+			}
+
+			rows, err := r.File.GetRows(InfoSheetName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[int][]string{ // Expected rows by row number
+				1:  {"Property", "Value"},
+				2:  {"Title", "Quarterly Report"},
+				4:  {"Creator", "Finance"},
+				13: {"Sheet", "Rows", "Columns"},
+				14: {"Data", "10", "2"},
+				15: {"Summary", "20", "3"},
+			}
+			for row, wantRow := range want {
+				if row > len(rows) || !slices.Equal(rows[row-1], wantRow) {
+					t.Errorf("row %d = %v, want %v", row, rows[min(row, len(rows))-1], wantRow)
+				}
+			}
+		})
+	}
+}
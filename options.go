@@ -0,0 +1,72 @@
+package excelrecreator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// optionsEnvPrefix prefixes the environment variables read by
+// LoadOptionsFromEnv
+const optionsEnvPrefix = "EXCELRECREATOR_"
+
+// FromJSON sets the options present in a JSON object, keeping the others.
+// Keys are the field names, e.g. {"PreserveFormulas": false}.
+func (o *Options) FromJSON(data []byte) error {
+	if err := json.Unmarshal(data, o); err != nil {
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	return nil
+}
+
+// LoadOptionsFromEnv returns the default options with the boolean and string
+// options overridden by environment variables named after the field, such as
+// EXCELRECREATOR_PRESERVE_FORMULAS=false or EXCELRECREATOR_DEFAULT_SHEET_NAME.
+func LoadOptionsFromEnv() (*Options, error) {
+	options := DefaultOptions()
+
+	v := reflect.ValueOf(options).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		name := optionsEnvPrefix + envName(t.Field(i).Name)
+		value, exists := os.LookupEnv(name)
+		if !exists {
+			continue
+		}
+
+		switch field.Kind() {
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			field.SetBool(b)
+		case reflect.String:
+			field.SetString(value)
+		}
+	}
+
+	return options, nil
+}
+
+// envName converts a field name such as PreserveRTL to PRESERVE_RTL
+func envName(field string) string {
+	runes := []rune(field)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			// Split before an upper case letter that follows a lower case
+			// letter or starts a word after an acronym
+			if unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,108 @@
+package excelrecreator
+
+import "testing"
+
+func TestFromJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+		check   func(o *Options) bool
+	}{
+		{
+			name:  "booleans",
+			data:  `{"PreserveFormulas": false, "PreserveRTL": true}`,
+			check: func(o *Options) bool { return !o.PreserveFormulas && o.PreserveRTL },
+		},
+		{
+			name:  "default sheet name",
+			data:  `{"DefaultSheetName": "Report"}`,
+			check: func(o *Options) bool { return o.DefaultSheetName == "Report" },
+		},
+		{
+			name:  "absent fields keep their value",
+			data:  `{"PreserveRTL": true}`,
+			check: func(o *Options) bool { return o.PreserveStyles == DefaultOptions().PreserveStyles },
+		},
+		{name: "invalid JSON", data: `{"PreserveFormulas":`, wantErr: true},
+		{name: "wrong type", data: `{"PreserveFormulas": "no"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			err := options.FromJSON([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FromJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil && !tt.check(options) {
+				t.Errorf("options = %+v", options)
+			}
+		})
+	}
+}
+
+func TestLoadOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+		check   func(o *Options) bool
+	}{
+		{
+			name:  "no variables",
+			check: func(o *Options) bool { return o.PreserveFormulas == DefaultOptions().PreserveFormulas },
+		},
+		{
+			name:  "boolean",
+			env:   map[string]string{"EXCELRECREATOR_PRESERVE_FORMULAS": "false"},
+			check: func(o *Options) bool { return !o.PreserveFormulas },
+		},
+		{
+			name:  "acronym",
+			env:   map[string]string{"EXCELRECREATOR_PRESERVE_RTL": "true"},
+			check: func(o *Options) bool { return o.PreserveRTL },
+		},
+		{
+			name:  "string",
+			env:   map[string]string{"EXCELRECREATOR_DEFAULT_SHEET_NAME": "Report"},
+			check: func(o *Options) bool { return o.DefaultSheetName == "Report" },
+		},
+		{name: "invalid boolean", env: map[string]string{"EXCELRECREATOR_PRESERVE_FORMULAS": "maybe"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			options, err := LoadOptionsFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadOptionsFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil && !tt.check(options) {
+				t.Errorf("options = %+v", options)
+			}
+		})
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{field: "PreserveFormulas", want: "PRESERVE_FORMULAS"},
+		{field: "PreserveRTL", want: "PRESERVE_RTL"},
+		{field: "DefaultSheetName", want: "DEFAULT_SHEET_NAME"},
+		{field: "RTLSheets", want: "RTL_SHEETS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			if got := envName(tt.field); got != tt.want {
+				t.Errorf("envName(%q) = %q, want %q", tt.field, got, tt.want)
+			}
+		})
+	}
+}
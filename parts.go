@@ -0,0 +1,199 @@
+package excelrecreator
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// partEdit changes the XML of one part of the workbook package
+type partEdit func(data []byte) ([]byte, error)
+
+// applyPartEdits sets the settings excelize keeps when reading a file but has
+// no API to set, such as SheetOptions.PrintGridLines and
+// WorkbookView.FirstSheet. The workbook is written to memory, the XML parts
+// are edited or added and the workbook is opened again. The reopened workbook
+// replaces r.File, keeping its Path, and the previous File is closed.
+func (r *Recreator) applyPartEdits() error {
+	edits := make(map[string]partEdit)      // Maps package part names to their edit
+	sheetEdits := make(map[string]partEdit) // Maps sheet names to the edit of their worksheet part
+	parts := make(map[string][]byte)        // Maps new package part names to their data
+	r.printOptionsEdits(sheetEdits)
+	r.workbookViewEdits(edits)
+	r.phoneticEdits(edits)
+	if err := r.checksumEdits(edits, parts); err != nil {
+		return err
+	}
+	if len(edits) == 0 && len(sheetEdits) == 0 && len(parts) == 0 {
+		return nil
+	}
+
+	buf, err := r.File.WriteToBuffer()
+	if err != nil {
+		return err
+	}
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		return err
+	}
+	if len(sheetEdits) > 0 {
+		sheetParts, err := worksheetParts(reader)
+		if err != nil {
+			return err
+		}
+		for sheetName, edit := range sheetEdits {
+			name, exists := sheetParts[sheetName]
+			if !exists {
+				return fmt.Errorf("worksheet part of sheet %s not found", sheetName)
+			}
+			edits[name] = edit
+		}
+	}
+
+	var out bytes.Buffer
+	writer := zip.NewWriter(&out)
+	for _, file := range reader.File {
+		if _, exists := parts[file.Name]; exists {
+			return fmt.Errorf("%s already exists", file.Name)
+		}
+		data, err := readZipFile(file)
+		if err != nil {
+			return err
+		}
+		if edit, exists := edits[file.Name]; exists {
+			if data, err = edit(data); err != nil {
+				return fmt.Errorf("%s: %w", file.Name, err)
+			}
+			delete(edits, file.Name)
+		}
+		w, err := writer.Create(file.Name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	for name, data := range parts {
+		w, err := writer.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if len(edits) > 0 {
+		return fmt.Errorf("%d workbook parts not found", len(edits))
+	}
+
+	f, err := excelize.OpenReader(&out)
+	if err != nil {
+		return err
+	}
+	f.Path = r.File.Path
+	_ = r.File.Close()
+	r.File = f
+	return nil
+}
+
+// worksheetParts maps sheet names to the package part names of their
+// worksheets, following the relationships of xl/workbook.xml
+func worksheetParts(reader *zip.Reader) (map[string]string, error) {
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	for name, v := range map[string]interface{}{"xl/workbook.xml": &workbook, "xl/_rels/workbook.xml.rels": &rels} {
+		file, err := reader.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		err = xml.NewDecoder(file).Decode(v)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	targets := make(map[string]string) // Maps relationship IDs to part names
+	for _, rel := range rels.Relationships {
+		if strings.HasPrefix(rel.Target, "/") {
+			targets[rel.ID] = strings.TrimPrefix(rel.Target, "/")
+		} else {
+			targets[rel.ID] = path.Join("xl", rel.Target)
+		}
+	}
+	sheetParts := make(map[string]string)
+	for _, sheet := range workbook.Sheets {
+		if target, exists := targets[sheet.ID]; exists {
+			sheetParts[sheet.Name] = target
+		}
+	}
+	return sheetParts, nil
+}
+
+// readZipFile returns the contents of a file in a zip archive
+func readZipFile(file *zip.File) ([]byte, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// setXMLAttr sets an attribute of the first element with the given name,
+// replacing its current value. It returns false if there is no such element.
+func setXMLAttr(xml, element, name, value string) (string, bool) {
+	start := -1
+	for i := 0; i < len(xml); {
+		j := strings.Index(xml[i:], "<"+element)
+		if j < 0 {
+			return xml, false
+		}
+		j += i
+		if next := j + len(element) + 1; next < len(xml) && strings.ContainsRune(" \t\r\n/>", rune(xml[next])) {
+			start = j
+			break
+		}
+		i = j + 1
+	}
+	if start < 0 {
+		return xml, false
+	}
+	end := strings.Index(xml[start:], ">")
+	if end < 0 {
+		return xml, false
+	}
+	end += start
+
+	tag := xml[start:end]
+	attr := regexp.MustCompile(`\s` + regexp.QuoteMeta(name) + `="[^"]*"`)
+	if loc := attr.FindStringIndex(tag); loc != nil {
+		tag = tag[:loc[0]] + fmt.Sprintf(` %s="%s"`, name, value) + tag[loc[1]:]
+	} else if strings.HasSuffix(tag, "/") {
+		tag = tag[:len(tag)-1] + fmt.Sprintf(` %s="%s"/`, name, value)
+	} else {
+		tag += fmt.Sprintf(` %s="%s"`, name, value)
+	}
+	return xml[:start] + tag + xml[end:], true
+}
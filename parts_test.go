@@ -0,0 +1,57 @@
+package excelrecreator
+
+import "testing"
+
+func TestSetXMLAttr(t *testing.T) {
+	tests := []struct {
+		name    string
+		xml     string
+		element string
+		want    string
+		wantOK  bool
+	}{
+		{
+			name:    "attribute added",
+			xml:     `<bookViews><workbookView xWindow="0"></workbookView></bookViews>`,
+			element: "workbookView",
+			want:    `<bookViews><workbookView xWindow="0" firstSheet="1"></workbookView></bookViews>`,
+			wantOK:  true,
+		},
+		{
+			name:    "attribute replaced",
+			xml:     `<workbookView firstSheet="3" activeTab="0"/>`,
+			element: "workbookView",
+			want:    `<workbookView firstSheet="1" activeTab="0"/>`,
+			wantOK:  true,
+		},
+		{
+			name:    "self-closing element",
+			xml:     `<bookViews><workbookView/></bookViews>`,
+			element: "workbookView",
+			want:    `<bookViews><workbookView firstSheet="1"/></bookViews>`,
+			wantOK:  true,
+		},
+		{
+			name:    "longer element name skipped",
+			xml:     `<workbookViews/><workbookView/>`,
+			element: "workbookView",
+			want:    `<workbookViews/><workbookView firstSheet="1"/>`,
+			wantOK:  true,
+		},
+		{
+			name:    "element not found",
+			xml:     `<bookViews/>`,
+			element: "workbookView",
+			want:    `<bookViews/>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := setXMLAttr(tt.xml, tt.element, "firstSheet", "1")
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("setXMLAttr() = %s, %v, want %s, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
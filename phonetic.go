@@ -0,0 +1,79 @@
+package excelrecreator
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// phonetic is the phonetic guide of a text cell, added to its shared string
+// once the workbook is written
+type phonetic struct {
+	sheetName string
+	address   string
+	base      string // Text of the cell
+	text      string // Phonetic reading of the text
+}
+
+// addPhonetic records the phonetic guide of a written cell. Only shared
+// strings can hold one, which excludes numbers, rich text and streamed cells.
+func (r *Recreator) addPhonetic(sheetName, address, text string) {
+	if r.buffer == nil {
+		if cellType, err := r.File.GetCellType(sheetName, address); err == nil && cellType == excelize.CellTypeSharedString {
+			base, err := r.File.GetCellValue(sheetName, address, excelize.Options{RawCellValue: true})
+			if err == nil {
+				r.phonetics = append(r.phonetics, phonetic{sheetName: sheetName, address: address, base: base, text: text})
+				return
+			}
+		}
+	}
+	r.warn(sheetName, address, WarningPhoneticDropped, "phonetic text requires a plain text cell")
+}
+
+// phoneticEdits adds the edit setting CellOptions.PhoneticText, which excelize
+// keeps when reading a file but has no API to set. Cells with the same text
+// share a string, so they share its phonetic guide.
+func (r *Recreator) phoneticEdits(edits map[string]partEdit) {
+	if len(r.phonetics) == 0 {
+		return
+	}
+	edits["xl/sharedStrings.xml"] = func(data []byte) ([]byte, error) {
+		sst := string(data)
+		for _, p := range r.phonetics {
+			var found bool
+			sst, found = insertPhonetic(sst, p)
+			if !found {
+				r.warn(p.sheetName, p.address, WarningPhoneticDropped, "shared string not found")
+			}
+		}
+		return []byte(sst), nil
+	}
+}
+
+// insertPhonetic adds a phonetic run spanning the whole base text to the
+// shared string item holding only that text. It returns false if there is no
+// such item or it has a phonetic guide already.
+func insertPhonetic(sst string, p phonetic) (string, bool) {
+	base, text := escapeXMLText(p.base), escapeXMLText(p.text)
+	for _, t := range []string{"<t>", `<t xml:space="preserve">`} {
+		item := "<si>" + t + base + "</t></si>"
+		if i := strings.Index(sst, item); i >= 0 {
+			i += len(item) - len("</si>")
+			run := fmt.Sprintf(`<rPh sb="0" eb="%d"><t>%s</t></rPh><phoneticPr fontId="0" type="noConversion"/>`,
+				len(utf16.Encode([]rune(p.base))), text)
+			return sst[:i] + run + sst[i:], true
+		}
+	}
+	return sst, false
+}
+
+// escapeXMLText escapes text as encoding/xml writes character data
+func escapeXMLText(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
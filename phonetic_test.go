@@ -0,0 +1,120 @@
+package excelrecreator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prongbang/excelmetadata"
+)
+
+func TestPhoneticText(t *testing.T) {
+	tests := []struct {
+		name         string
+		preserve     bool
+		cell         excelmetadata.CellMetadata
+		wantRun      string
+		wantBase     string
+		wantWarnings int
+	}{
+		{
+			name:     "phonetic guide of kanji",
+			preserve: true,
+			cell:     newCell("A1", "東京"),
+			wantRun:  `<rPh sb="0" eb="2"><t>トウキョウ</t></rPh>`,
+			wantBase: "東京",
+		},
+		{
+			name:     "escaped text",
+			preserve: true,
+			cell:     newCell("A1", "R&D"),
+			wantRun:  `<rPh sb="0" eb="3"><t>トウキョウ</t></rPh>`,
+			wantBase: "R&D",
+		},
+		{
+			name:     "not preserved",
+			cell:     newCell("A1", "東京"),
+			wantBase: "東京",
+		},
+		{
+			name:         "number cell",
+			preserve:     true,
+			cell:         newCell("A1", 42),
+			wantBase:     "42",
+			wantWarnings: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.PreservePhonetic = tt.preserve
+			options.Sheets = map[string]*SheetOptions{"Data": {Cells: map[string]*CellOptions{"A1": {PhoneticText: "トウキョウ"}}}}
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", tt.cell)}}, options)
+
+			if got := getCellValue(t, r, "Data", "A1"); got != tt.wantBase {
+				t.Errorf("A1 = %q, want %q", got, tt.wantBase)
+			}
+			if tt.wantRun != "" {
+				if sst := partXML(t, r.File, "xl/sharedStrings.xml"); !strings.Contains(sst, tt.wantRun) {
+					t.Errorf("shared strings %s have no %s", sst, tt.wantRun)
+				}
+			}
+			var warnings int
+			for _, w := range r.Warnings() {
+				if w.Code == WarningPhoneticDropped {
+					warnings++
+				}
+			}
+			if warnings != tt.wantWarnings {
+				t.Errorf("phonetic dropped warnings = %d, want %d", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestInsertPhonetic(t *testing.T) {
+	tests := []struct {
+		name      string
+		sst       string
+		p         phonetic
+		want      string
+		wantFound bool
+	}{
+		{
+			name:      "plain text",
+			sst:       `<sst><si><t>東京</t></si></sst>`,
+			p:         phonetic{base: "東京", text: "トウキョウ"},
+			want:      `<sst><si><t>東京</t><rPh sb="0" eb="2"><t>トウキョウ</t></rPh><phoneticPr fontId="0" type="noConversion"/></si></sst>`,
+			wantFound: true,
+		},
+		{
+			name:      "preserved space",
+			sst:       `<sst><si><t xml:space="preserve"> 東京</t></si></sst>`,
+			p:         phonetic{base: " 東京", text: "トウキョウ"},
+			want:      `<sst><si><t xml:space="preserve"> 東京</t><rPh sb="0" eb="3"><t>トウキョウ</t></rPh><phoneticPr fontId="0" type="noConversion"/></si></sst>`,
+			wantFound: true,
+		},
+		{
+			name:      "UTF-16 length of supplementary characters",
+			sst:       `<sst><si><t>𠮷野</t></si></sst>`,
+			p:         phonetic{base: "𠮷野", text: "ヨシノ"},
+			want:      `<sst><si><t>𠮷野</t><rPh sb="0" eb="3"><t>ヨシノ</t></rPh><phoneticPr fontId="0" type="noConversion"/></si></sst>`,
+			wantFound: true,
+		},
+		{
+			name: "partial match ignored",
+			sst:  `<sst><si><t>東京都</t></si></sst>`,
+			p:    phonetic{base: "東京", text: "トウキョウ"},
+			want: `<sst><si><t>東京都</t></si></sst>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := insertPhonetic(tt.sst, tt.p)
+			if got != tt.want || found != tt.wantFound {
+				t.Errorf("insertPhonetic() = %s, %v, want %s, %v", got, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
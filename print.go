@@ -0,0 +1,51 @@
+package excelrecreator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// printOptionsSuccessors are the worksheet elements that follow printOptions,
+// in schema order
+var printOptionsSuccessors = []string{
+	"<pageMargins", "<pageSetup", "<headerFooter", "<rowBreaks", "<colBreaks",
+	"<customProperties", "<cellWatches", "<ignoredErrors", "<smartTags",
+	"<drawing", "<legacyDrawing", "<legacyDrawingHF", "<picture", "<oleObjects",
+	"<controls", "<webPublishItems", "<tableParts", "<extLst", "</worksheet>",
+}
+
+// printOptionsEdits adds the worksheet edits, keyed by sheet name, setting
+// SheetOptions.PrintGridLines and PrintHeadings, which excelize has no API for
+func (r *Recreator) printOptionsEdits(sheetEdits map[string]partEdit) {
+	for _, sheetName := range r.File.GetSheetList() {
+		opts := r.sheetOptions(sheetName)
+		var attr string
+		if opts.PrintGridLines {
+			attr += ` gridLines="1"`
+		}
+		if opts.PrintHeadings {
+			attr += ` headings="1"`
+		}
+		if attr != "" {
+			sheetEdits[sheetName] = func(data []byte) ([]byte, error) {
+				return insertPrintOptions(data, attr)
+			}
+		}
+	}
+}
+
+// insertPrintOptions adds attributes to the printOptions element of worksheet
+// XML, creating the element when missing
+func insertPrintOptions(data []byte, attr string) ([]byte, error) {
+	xml := string(data)
+	if i := strings.Index(xml, "<printOptions"); i >= 0 {
+		i += len("<printOptions")
+		return []byte(xml[:i] + attr + xml[i:]), nil
+	}
+	for _, tag := range printOptionsSuccessors {
+		if i := strings.Index(xml, tag); i >= 0 {
+			return []byte(xml[:i] + "<printOptions" + attr + "/>" + xml[i:]), nil
+		}
+	}
+	return nil, fmt.Errorf("invalid worksheet XML")
+}
@@ -0,0 +1,123 @@
+package excelrecreator
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/prongbang/excelmetadata"
+)
+
+func TestPrintOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      SheetOptions
+		notes     SheetOptions
+		wantData  string
+		wantNotes string
+	}{
+		{name: "gridlines", data: SheetOptions{PrintGridLines: true}, wantData: `<printOptions gridLines="1"/>`},
+		{name: "headings", notes: SheetOptions{PrintHeadings: true}, wantNotes: `<printOptions headings="1"/>`},
+		{
+			name:      "both on different sheets",
+			data:      SheetOptions{PrintGridLines: true, PrintHeadings: true},
+			notes:     SheetOptions{PrintHeadings: true},
+			wantData:  `<printOptions gridLines="1" headings="1"/>`,
+			wantNotes: `<printOptions headings="1"/>`,
+		},
+		{name: "none"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.Sheets = map[string]*SheetOptions{"Data": &tt.data, "Notes": &tt.notes}
+			r := New(&excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{
+				newSheet(0, "Data", newCell("A1", 1)), newSheet(1, "Notes", newCell("A1", "note")),
+			}}, options)
+			r.File.Path = "report.xlsx"
+			if err := r.Recreate(); err != nil {
+				t.Fatalf("Recreate() error = %v", err)
+			}
+
+			for part, want := range map[string]string{"xl/worksheets/sheet2.xml": tt.wantData, "xl/worksheets/sheet3.xml": tt.wantNotes} {
+				xml := partXML(t, r.File, part)
+				if want == "" && strings.Contains(xml, "<printOptions") {
+					t.Errorf("%s = %s, want no print options", part, xml)
+				}
+				if want != "" && !strings.Contains(xml, want) {
+					t.Errorf("%s = %s, want %s", part, xml, want)
+				}
+			}
+			if r.File.Path != "report.xlsx" {
+				t.Errorf("path = %q, want it kept", r.File.Path)
+			}
+		})
+	}
+}
+
+func TestWorksheetParts(t *testing.T) {
+	const workbook = `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Data" sheetId="1" r:id="rId3"/><sheet name="Notes" sheetId="2" r:id="rId1"/><sheet name="Lost" sheetId="3" r:id="rId9"/></sheets></workbook>`
+
+	tests := []struct {
+		name string
+		rels string
+		want map[string]string // nil when an error is expected
+	}{
+		{
+			name: "relative targets",
+			rels: `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+				`<Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId3" Target="worksheets/sheet7.xml"/></Relationships>`,
+			want: map[string]string{"Data": "xl/worksheets/sheet7.xml", "Notes": "xl/worksheets/sheet1.xml"},
+		},
+		{
+			name: "absolute target",
+			rels: `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+				`<Relationship Id="rId1" Target="/xl/worksheets/notes.xml"/><Relationship Id="rId3" Target="../xl/worksheets/data.xml"/></Relationships>`,
+			want: map[string]string{"Data": "xl/worksheets/data.xml", "Notes": "xl/worksheets/notes.xml"},
+		},
+		{name: "missing relationships"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer := zip.NewWriter(&buf)
+			files := map[string]string{"xl/workbook.xml": workbook}
+			if tt.rels != "" {
+				files["xl/_rels/workbook.xml.rels"] = tt.rels
+			}
+			for name, data := range files {
+				w, err := writer.Create(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := w.Write([]byte(data)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+			reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := worksheetParts(reader)
+			if (err != nil) != (tt.want == nil) {
+				t.Fatalf("worksheetParts() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("parts = %v, want %v", got, tt.want)
+			}
+			for sheetName, want := range tt.want {
+				if got[sheetName] != want {
+					t.Errorf("part of %s = %q, want %q", sheetName, got[sheetName], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package excelrecreator
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// sheetWriter is the part of the excelize.File API that writes the cells,
+// rows and merges of a sheet. It is the File itself, or a sheetBuffer while
+// Options.FlushPerSheet streams the sheet.
+type sheetWriter interface {
+	SetCellStr(sheet, cell, value string) error
+	SetCellFloat(sheet, cell string, value float64, precision, bitSize int) error
+	SetCellInt(sheet, cell string, value int64) error
+	SetCellBool(sheet, cell string, value bool) error
+	SetCellValue(sheet, cell string, value interface{}) error
+	SetCellFormula(sheet, cell, formula string, opts ...excelize.FormulaOpts) error
+	SetCellRichText(sheet, cell string, runs []excelize.RichTextRun) error
+	SetCellStyle(sheet, topLeftCell, bottomRightCell string, styleID int) error
+	GetCellStyle(sheet, cell string) (int, error)
+	SetRowHeight(sheet string, row int, height float64) error
+	SetRowStyle(sheet string, start, end, styleID int) error
+	SetRowOutlineLevel(sheet string, row int, level uint8) error
+	MergeCell(sheet, topLeftCell, bottomRightCell string) error
+}
+
+// writer returns where the current sheet's cells are written
+func (r *Recreator) writer() sheetWriter {
+	if r.buffer != nil {
+		return r.buffer
+	}
+	return r.File
+}
+
+// checkTempDir reports whether excelize can create its temporary files. It
+// always uses the system temp directory, which follows TMPDIR, so a missing or
+// read-only directory is caught before any sheet is streamed.
+func checkTempDir() error {
+	f, err := os.CreateTemp("", "excelrecreator-")
+	if err != nil {
+		return fmt.Errorf("temporary directory %s is not writable, set TMPDIR to a writable volume: %w", os.TempDir(), err)
+	}
+	name := f.Name()
+	_ = f.Close()
+	return os.Remove(name)
+}
+
+// sheetBuffer collects the cells, rows and merges of one sheet, which flush
+// writes in row order through a StreamWriter. Once flushed, excelize keeps the
+// sheet XML in a temporary file instead of holding every cell in memory. The
+// buffer holds the whole sheet until then, as cells arrive in metadata order
+// and are restyled after they are written, so memory is saved between sheets
+// only: peak memory is still that of the largest sheet.
+type sheetBuffer struct {
+	file   *excelize.File
+	cells  map[int]map[int]*excelize.Cell // Cells by row and column
+	rows   map[int]*excelize.RowOpts
+	merges [][2]string
+}
+
+// newSheetBuffer returns an empty buffer. Styles are still created in file.
+func newSheetBuffer(file *excelize.File) *sheetBuffer {
+	return &sheetBuffer{
+		file:  file,
+		cells: make(map[int]map[int]*excelize.Cell),
+		rows:  make(map[int]*excelize.RowOpts),
+	}
+}
+
+// cell returns the buffered cell at an address, adding it if missing
+func (b *sheetBuffer) cell(address string) (*excelize.Cell, error) {
+	col, row, err := excelize.CellNameToCoordinates(address)
+	if err != nil {
+		return nil, err
+	}
+	if b.cells[row] == nil {
+		b.cells[row] = make(map[int]*excelize.Cell)
+	}
+	if b.cells[row][col] == nil {
+		b.cells[row][col] = &excelize.Cell{}
+	}
+	return b.cells[row][col], nil
+}
+
+// setValue buffers a value, replacing any formula
+func (b *sheetBuffer) setValue(address string, value interface{}) error {
+	c, err := b.cell(address)
+	if err != nil {
+		return err
+	}
+	c.Formula, c.Value = "", value
+	return nil
+}
+
+func (b *sheetBuffer) SetCellStr(_, cell, value string) error {
+	return b.setValue(cell, value)
+}
+
+func (b *sheetBuffer) SetCellFloat(_, cell string, value float64, _, _ int) error {
+	return b.setValue(cell, value)
+}
+
+func (b *sheetBuffer) SetCellInt(_, cell string, value int64) error {
+	return b.setValue(cell, value)
+}
+
+func (b *sheetBuffer) SetCellBool(_, cell string, value bool) error {
+	return b.setValue(cell, value)
+}
+
+// SetCellValue buffers a value. Like excelize, a time without a style gets a
+// built-in date format.
+func (b *sheetBuffer) SetCellValue(_, cell string, value interface{}) error {
+	if err := b.setValue(cell, value); err != nil {
+		return err
+	}
+	if t, isTime := value.(time.Time); isTime {
+		c, _ := b.cell(cell)
+		if c.StyleID == 0 {
+			styleID, err := b.file.NewStyle(&excelize.Style{NumFmt: timeNumFmt(t)})
+			if err != nil {
+				return err
+			}
+			c.StyleID = styleID
+		}
+	}
+	return nil
+}
+
+// timeNumFmt returns the built-in format excelize gives a time: "mmm-yy" on
+// the first of a month, "mm-dd-yy" for whole days and "m/d/yy h:mm" otherwise
+func timeNumFmt(t time.Time) int {
+	switch {
+	case t.Day() == 1 && t.AddDate(0, 1, 0).Day() == 1:
+		return 17
+	case t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0:
+		return 14
+	}
+	return 22
+}
+
+// SetCellFormula buffers a formula. A StreamWriter writes plain formulas only,
+// so array formulas such as spill ranges are rejected.
+func (b *sheetBuffer) SetCellFormula(_, cell, formula string, opts ...excelize.FormulaOpts) error {
+	if len(opts) > 0 {
+		return fmt.Errorf("array formulas cannot be written with FlushPerSheet")
+	}
+	c, err := b.cell(cell)
+	if err != nil {
+		return err
+	}
+	c.Formula, c.Value = formula, nil
+	return nil
+}
+
+func (b *sheetBuffer) SetCellRichText(_, cell string, runs []excelize.RichTextRun) error {
+	return b.setValue(cell, runs)
+}
+
+func (b *sheetBuffer) SetCellStyle(_, topLeftCell, bottomRightCell string, styleID int) error {
+	col1, row1, err := excelize.CellNameToCoordinates(topLeftCell)
+	if err != nil {
+		return err
+	}
+	col2, row2, err := excelize.CellNameToCoordinates(bottomRightCell)
+	if err != nil {
+		return err
+	}
+	for row := min(row1, row2); row <= max(row1, row2); row++ {
+		for col := min(col1, col2); col <= max(col1, col2); col++ {
+			address, _ := excelize.CoordinatesToCellName(col, row)
+			c, err := b.cell(address)
+			if err != nil {
+				return err
+			}
+			c.StyleID = styleID
+		}
+	}
+	return nil
+}
+
+// GetCellStyle returns the style of a buffered cell, or its row's style
+func (b *sheetBuffer) GetCellStyle(_, cell string) (int, error) {
+	col, row, err := excelize.CellNameToCoordinates(cell)
+	if err != nil {
+		return 0, err
+	}
+	if c := b.cells[row][col]; c != nil && c.StyleID != 0 {
+		return c.StyleID, nil
+	}
+	if opts := b.rows[row]; opts != nil {
+		return opts.StyleID, nil
+	}
+	return 0, nil
+}
+
+// rowOpts returns the buffered options of a row, adding them if missing
+func (b *sheetBuffer) rowOpts(row int) *excelize.RowOpts {
+	if b.rows[row] == nil {
+		b.rows[row] = &excelize.RowOpts{}
+	}
+	return b.rows[row]
+}
+
+func (b *sheetBuffer) SetRowHeight(_ string, row int, height float64) error {
+	if row < 1 || row > excelize.TotalRows {
+		return excelize.ErrMaxRows
+	}
+	b.rowOpts(row).Height = height
+	return nil
+}
+
+func (b *sheetBuffer) SetRowStyle(_ string, start, end, styleID int) error {
+	if start < 1 || end > excelize.TotalRows {
+		return excelize.ErrMaxRows
+	}
+	for row := min(start, end); row <= max(start, end); row++ {
+		b.rowOpts(row).StyleID = styleID
+	}
+	return nil
+}
+
+func (b *sheetBuffer) SetRowOutlineLevel(_ string, row int, level uint8) error {
+	if row < 1 || row > excelize.TotalRows {
+		return excelize.ErrMaxRows
+	}
+	if level > 7 || level < 1 {
+		return excelize.ErrOutlineLevel
+	}
+	b.rowOpts(row).OutlineLevel = int(level)
+	return nil
+}
+
+func (b *sheetBuffer) MergeCell(_, topLeftCell, bottomRightCell string) error {
+	b.merges = append(b.merges, [2]string{topLeftCell, bottomRightCell})
+	return nil
+}
+
+// flush writes the buffered rows and merges to the sheet through a
+// StreamWriter. Everything else about the sheet, such as column widths,
+// comments and protection, must be set before.
+func (b *sheetBuffer) flush(sheetName string) error {
+	sw, err := b.file.NewStreamWriter(sheetName)
+	if err != nil {
+		return err
+	}
+
+	rows := make([]int, 0, len(b.cells)+len(b.rows))
+	for row := range b.cells {
+		rows = append(rows, row)
+	}
+	for row := range b.rows {
+		if b.cells[row] == nil {
+			rows = append(rows, row)
+		}
+	}
+	sort.Ints(rows)
+
+	for _, row := range rows {
+		minCol, maxCol := excelize.MaxColumns, 1
+		for col := range b.cells[row] {
+			minCol, maxCol = min(minCol, col), max(maxCol, col)
+		}
+		minCol = min(minCol, maxCol)
+		values := make([]interface{}, maxCol-minCol+1)
+		for col, c := range b.cells[row] {
+			values[col-minCol] = *c
+		}
+
+		var opts []excelize.RowOpts
+		if rowOpts := b.rows[row]; rowOpts != nil {
+			opts = append(opts, *rowOpts)
+		}
+		start, _ := excelize.CoordinatesToCellName(minCol, row)
+		if err := sw.SetRow(start, values, opts...); err != nil {
+			return fmt.Errorf("row %d: %w", row, err)
+		}
+	}
+
+	for _, merge := range b.merges {
+		if err := sw.MergeCell(merge[0], merge[1]); err != nil {
+			return err
+		}
+	}
+	return sw.Flush()
+}
@@ -0,0 +1,266 @@
+package excelrecreator
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prongbang/excelmetadata"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestFlushPerSheetTempDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpDir  func(t *testing.T) string
+		flush   bool
+		wantErr bool
+	}{
+		{name: "writable", tmpDir: func(t *testing.T) string { return t.TempDir() }, flush: true},
+		{name: "missing", tmpDir: func(t *testing.T) string { return filepath.Join(t.TempDir(), "missing") }, flush: true, wantErr: true},
+		{name: "missing without flush", tmpDir: func(t *testing.T) string { return filepath.Join(t.TempDir(), "missing") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TMPDIR", tt.tmpDir(t))
+			options := DefaultOptions()
+			options.FlushPerSheet = tt.flush
+			r := New(&excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("A1", "value"))}}, options)
+			defer r.File.Close()
+
+			err := r.Recreate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Recreate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSparseSheet(t *testing.T) {
+	tests := []struct {
+		name        string
+		addresses   []string
+		flush       bool
+		wantWarning bool
+		maxSize     int64
+	}{
+		{name: "dense", addresses: []string{"A1", "A2", "A3", "A4", "A5"}, maxSize: 10000},
+		{name: "sparse", addresses: []string{"A1", "A10", "A1000", "A50000", "A100000"}, wantWarning: true},
+		{name: "sparse flushed", addresses: []string{"A1", "A10", "A1000", "A500000", "A1000000"}, flush: true, maxSize: 10000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sheet := newSheet(0, "Data")
+			for _, address := range tt.addresses {
+				sheet.Cells = append(sheet.Cells, newCell(address, "value"))
+			}
+			sheet.Dimensions = excelmetadata.SheetDimensions{StartCell: "A1", EndCell: "A1000000", RowCount: 1000000, ColCount: 1}
+			options := DefaultOptions()
+			options.FlushPerSheet = tt.flush
+
+			start := time.Now()
+			r := recreate(t, &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{sheet}}, options)
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("recreate took %v", elapsed)
+			}
+			if got := hasWarning(r, WarningSparseSheet); got != tt.wantWarning {
+				t.Errorf("sparse sheet warning = %v, want %v", got, tt.wantWarning)
+			}
+			if tt.maxSize > 0 {
+				size, err := r.EstimateSize()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if size > tt.maxSize {
+					t.Errorf("size = %d bytes, want at most %d", size, tt.maxSize)
+				}
+			}
+			if got := getCellValue(t, r, "Data", tt.addresses[len(tt.addresses)-1]); got != "value" {
+				t.Errorf("last cell = %q, want %q", got, "value")
+			}
+		})
+	}
+}
+
+func TestFlushPerSheetOutput(t *testing.T) {
+	styles := map[int]excelmetadata.StyleDetails{
+		1: {Font: &excelmetadata.FontStyle{Bold: true}},
+		2: {NumberFormat: 4},
+		3: {Fill: &excelmetadata.FillStyle{Type: "pattern", Pattern: 1, Color: []string{"FFFF00"}}},
+	}
+	styled := func(address string, value interface{}, styleID int) excelmetadata.CellMetadata {
+		return excelmetadata.CellMetadata{Address: address, Value: value, StyleID: styleID}
+	}
+
+	tests := []struct {
+		name    string
+		sheets  func() []excelmetadata.SheetMetadata
+		options func(o *Options)
+	}{
+		{
+			name: "values",
+			sheets: func() []excelmetadata.SheetMetadata {
+				return []excelmetadata.SheetMetadata{newSheet(0, "Data",
+					newCell("A1", "text"), newCell("B1", 1.5), newCell("C1", 42), newCell("D1", true),
+					newCell("A2", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)), newCell("C3", "out of order"), newCell("B2", "#N/A"),
+				)}
+			},
+		},
+		{
+			name: "styles and formulas",
+			sheets: func() []excelmetadata.SheetMetadata {
+				return []excelmetadata.SheetMetadata{newSheet(0, "Data",
+					styled("A1", "Header", 1), styled("A2", 1234.5, 2), styled("B2", "filled", 3),
+					excelmetadata.CellMetadata{Address: "C2", Formula: "A2*2", StyleID: 2},
+				)}
+			},
+		},
+		{
+			name: "rows and merges",
+			sheets: func() []excelmetadata.SheetMetadata {
+				sheet := newSheet(0, "Data", newCell("A1", "title"), newCell("A3", "body"))
+				sheet.RowHeights = map[int]float64{1: 30, 5: 12}
+				sheet.MergedCells = []excelmetadata.MergedCell{{StartCell: "A1", EndCell: "C1"}}
+				return []excelmetadata.SheetMetadata{sheet}
+			},
+			options: func(o *Options) {
+				o.Sheets = map[string]*SheetOptions{"Data": {RowStyles: map[int]int{3: 1}, RowOutlineLevels: map[int]uint8{3: 1, 4: 2}}}
+			},
+		},
+		{
+			name: "several sheets",
+			sheets: func() []excelmetadata.SheetMetadata {
+				return []excelmetadata.SheetMetadata{
+					newSheet(0, "First", newCell("A1", 1)),
+					newSheet(1, "Second", styled("B2", "two", 1)),
+					newSheet(2, "Third", newCell("A1", 3), newCell("A1000", 4)),
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recreateWith := func(flush bool) *Recreator {
+				options := DefaultOptions()
+				if tt.options != nil {
+					tt.options(options)
+				}
+				options.FlushPerSheet = flush
+				return recreate(t, &excelmetadata.Metadata{Styles: styles, Sheets: tt.sheets()}, options)
+			}
+			want, got := recreateWith(false), recreateWith(true)
+
+			if !slices.Equal(got.File.GetSheetList(), want.File.GetSheetList()) {
+				t.Fatalf("sheets = %v, want %v", got.File.GetSheetList(), want.File.GetSheetList())
+			}
+			for _, sheetName := range want.File.GetSheetList() {
+				compareSheets(t, sheetName, got.File, want.File)
+			}
+		})
+	}
+}
+
+// compareSheets reports the differences in the cells, styles, formulas,
+// merges and rows of a sheet written with and without FlushPerSheet
+func compareSheets(t *testing.T, sheetName string, got, want *excelize.File) {
+	t.Helper()
+	wantRows, err := want.GetRows(sheetName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotRows, err := got.GetRows(sheetName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.EqualFunc(gotRows, wantRows, slices.Equal) {
+		t.Errorf("%s rows = %q, want %q", sheetName, gotRows, wantRows)
+	}
+
+	for row := 1; row <= max(len(wantRows), 5); row++ {
+		wantHeight, _ := want.GetRowHeight(sheetName, row)
+		gotHeight, _ := got.GetRowHeight(sheetName, row)
+		if gotHeight != wantHeight {
+			t.Errorf("%s row %d height = %v, want %v", sheetName, row, gotHeight, wantHeight)
+		}
+		wantLevel, _ := want.GetRowOutlineLevel(sheetName, row)
+		gotLevel, _ := got.GetRowOutlineLevel(sheetName, row)
+		if gotLevel != wantLevel {
+			t.Errorf("%s row %d outline level = %d, want %d", sheetName, row, gotLevel, wantLevel)
+		}
+		for col := 1; col <= 4; col++ {
+			address, _ := excelize.CoordinatesToCellName(col, row)
+			wantFormula, _ := want.GetCellFormula(sheetName, address)
+			gotFormula, _ := got.GetCellFormula(sheetName, address)
+			if gotFormula != wantFormula {
+				t.Errorf("%s!%s formula = %q, want %q", sheetName, address, gotFormula, wantFormula)
+			}
+			if gotStyle, wantStyle := cellStyle(t, got, sheetName, address), cellStyle(t, want, sheetName, address); !jsonEqual(gotStyle, wantStyle) {
+				t.Errorf("%s!%s style = %+v, want %+v", sheetName, address, gotStyle, wantStyle)
+			}
+		}
+	}
+
+	wantMerges, _ := want.GetMergeCells(sheetName)
+	gotMerges, _ := got.GetMergeCells(sheetName)
+	if len(gotMerges) != len(wantMerges) {
+		t.Errorf("%s merges = %d, want %d", sheetName, len(gotMerges), len(wantMerges))
+	}
+	for i := range min(len(gotMerges), len(wantMerges)) {
+		if gotMerges[i].GetStartAxis() != wantMerges[i].GetStartAxis() || gotMerges[i].GetEndAxis() != wantMerges[i].GetEndAxis() {
+			t.Errorf("%s merge %d = %s:%s, want %s:%s", sheetName, i,
+				gotMerges[i].GetStartAxis(), gotMerges[i].GetEndAxis(), wantMerges[i].GetStartAxis(), wantMerges[i].GetEndAxis())
+		}
+	}
+}
+
+// cellStyle returns the style of a cell, which can have a different ID in
+// two files with the same styles
+func cellStyle(t *testing.T, f *excelize.File, sheetName, address string) *excelize.Style {
+	t.Helper()
+	styleID, err := f.GetCellStyle(sheetName, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	style, err := f.GetStyle(styleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return style
+}
+
+// BenchmarkFlushPerSheet compares the memory of recreating five sheets of
+// 100,000 rows with and without FlushPerSheet; run it with -benchmem
+func BenchmarkFlushPerSheet(b *testing.B) {
+	const sheets, rows = 5, 100000
+	metadata := &excelmetadata.Metadata{}
+	for i := 0; i < sheets; i++ {
+		sheet := newSheet(i, fmt.Sprintf("Sheet %d", i+1))
+		for row := 1; row <= rows; row++ {
+			sheet.Cells = append(sheet.Cells, newCell(fmt.Sprintf("A%d", row), fmt.Sprintf("row %d", row)), newCell(fmt.Sprintf("B%d", row), row))
+		}
+		metadata.Sheets = append(metadata.Sheets, sheet)
+	}
+
+	for _, flush := range []bool{false, true} {
+		b.Run(fmt.Sprintf("flush=%v", flush), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				options := DefaultOptions()
+				options.FlushPerSheet = flush
+				r := New(metadata, options)
+				if err := r.Recreate(); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := r.File.WriteToBuffer(); err != nil {
+					b.Fatal(err)
+				}
+				r.File.Close()
+			}
+		})
+	}
+}
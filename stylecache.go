@@ -0,0 +1,60 @@
+package excelrecreator
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// styleCache maps keys of derived styles, such as a base style with a fill
+// color, to excelize style IDs, so the same override across many cells reuses
+// one style. It is safe for concurrent use.
+type styleCache struct {
+	mu  sync.Mutex
+	ids map[derivedStyleKey]int
+}
+
+// derivedStyleKey identifies a derived style by its base style ID and the
+// kind and normalized JSON of the override applied to it
+type derivedStyleKey struct {
+	base     int
+	override string
+}
+
+func newStyleCache() *styleCache {
+	return &styleCache{ids: make(map[derivedStyleKey]int)}
+}
+
+// newDerivedStyleKey returns the key of baseStyleID with an override, such as
+// a cellXfOptions or the color of a fill style. kind tells apart overrides of
+// the same type, e.g. a number format from an indentation level.
+func newDerivedStyleKey(kind string, baseStyleID int, override interface{}) derivedStyleKey {
+	data, _ := json.Marshal(override)
+	return derivedStyleKey{base: baseStyleID, override: kind + "\x00" + string(data)}
+}
+
+// get returns the style ID cached for key, calling create on a miss. The lock
+// is held across create so concurrent misses on one key add a single style.
+func (c *styleCache) get(key derivedStyleKey, create func() (int, error)) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if styleID, exists := c.ids[key]; exists {
+		return styleID, nil
+	}
+	styleID, err := create()
+	if err != nil {
+		return 0, err
+	}
+	c.ids[key] = styleID
+	return styleID, nil
+}
+
+// styleIDs returns every cached style ID
+func (c *styleCache) styleIDs() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ids := make([]int, 0, len(c.ids))
+	for _, styleID := range c.ids {
+		ids = append(ids, styleID)
+	}
+	return ids
+}
@@ -0,0 +1,133 @@
+package excelrecreator
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/prongbang/excelmetadata"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestDerivedStyleCache(t *testing.T) {
+	const cells = 1000
+
+	tests := []struct {
+		name         string
+		color        func(i int) string
+		wantNew      int
+		wantDistinct int
+	}{
+		{name: "same fill", color: func(int) string { return "#FFFF00" }, wantNew: 1, wantDistinct: 1},
+		{name: "same fill written differently", color: func(i int) string { return []string{"#FFFF00", "ffff00", "FFFFFF00"}[i%3] }, wantNew: 1, wantDistinct: 1},
+		{name: "two fills", color: func(i int) string { return []string{"#FFFF00", "#00B050"}[i%2] }, wantNew: 2, wantDistinct: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var metaCells []excelmetadata.CellMetadata
+			cellOptions := make(map[string]*CellOptions)
+			for i := 0; i < cells; i++ {
+				address := fmt.Sprintf("A%d", i+1)
+				metaCells = append(metaCells, newCell(address, i))
+				cellOptions[address] = &CellOptions{FillColor: tt.color(i)}
+			}
+			metadata := &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", metaCells...)}}
+			base := recreate(t, metadata, DefaultOptions())
+
+			options := DefaultOptions()
+			options.Sheets = map[string]*SheetOptions{"Data": {Cells: cellOptions}}
+			r := recreate(t, metadata, options)
+
+			if got := len(r.File.Styles.CellXfs.Xf) - len(base.File.Styles.CellXfs.Xf); got != tt.wantNew {
+				t.Errorf("new styles = %d, want %d", got, tt.wantNew)
+			}
+			distinct := make(map[int]bool)
+			for i := 0; i < cells; i++ {
+				styleID, err := r.File.GetCellStyle("Data", fmt.Sprintf("A%d", i+1))
+				if err != nil {
+					t.Fatal(err)
+				}
+				distinct[styleID] = true
+			}
+			if len(distinct) != tt.wantDistinct {
+				t.Errorf("cell styles = %d, want %d", len(distinct), tt.wantDistinct)
+			}
+		})
+	}
+}
+
+func TestNewDerivedStyleKey(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b derivedStyleKey
+		want bool
+	}{
+		{name: "same override", a: newDerivedStyleKey("fill", 1, "FFFF00"), b: newDerivedStyleKey("fill", 1, "FFFF00"), want: true},
+		{name: "different override", a: newDerivedStyleKey("fill", 1, "FFFF00"), b: newDerivedStyleKey("fill", 1, "00B050")},
+		{name: "different base", a: newDerivedStyleKey("fill", 1, "FFFF00"), b: newDerivedStyleKey("fill", 2, "FFFF00")},
+		{name: "different kind", a: newDerivedStyleKey("numFmt", 1, 2), b: newDerivedStyleKey("indent", 1, 2)},
+		{name: "same sides", a: newDerivedStyleKey("border", 1, []string{"top", "left"}), b: newDerivedStyleKey("border", 1, []string{"top", "left"}), want: true},
+		{name: "override with kind separator", a: newDerivedStyleKey("fill", 1, "a"), b: newDerivedStyleKey("fil", 1, "la")},
+		{name: "cell format options", a: newDerivedStyleKey("cellXf", 1, cellXfOptions{QuotePrefix: true}), b: newDerivedStyleKey("cellXf", 1, cellXfOptions{})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a == tt.b; got != tt.want {
+				t.Errorf("keys equal = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDerivedStyleCacheConcurrent(t *testing.T) {
+	const goroutines = 8
+
+	tests := []struct {
+		name   string
+		colors []string
+	}{
+		{name: "one fill", colors: []string{"FFFF00"}},
+		{name: "several fills", colors: []string{"FFFF00", "00B050", "FF0000", "0070C0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New(&excelmetadata.Metadata{}, DefaultOptions())
+			baseStyleID, err := r.File.NewStyle(&excelize.Style{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := make([][]int, goroutines)
+			var wg sync.WaitGroup
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < 100; i++ {
+						styleID, err := r.fillStyle(baseStyleID, tt.colors[i%len(tt.colors)])
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						ids[g] = append(ids[g], styleID)
+					}
+				}(g)
+			}
+			wg.Wait()
+
+			if got := len(r.derivedStyles.styleIDs()); got != len(tt.colors) {
+				t.Errorf("cached styles = %d, want %d", got, len(tt.colors))
+			}
+			for g := 1; g < goroutines; g++ {
+				for i := range ids[g] {
+					if ids[g][i] != ids[0][i] {
+						t.Fatalf("goroutine %d call %d got style %d, want %d", g, i, ids[g][i], ids[0][i])
+					}
+				}
+			}
+		})
+	}
+}
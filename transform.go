@@ -0,0 +1,370 @@
+package excelrecreator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/prongbang/excelmetadata"
+	"github.com/xuri/excelize/v2"
+)
+
+// CellPatch describes a change to one cell. Nil fields keep the current
+// value, formula or style.
+type CellPatch struct {
+	Sheet   string
+	Address string
+	Value   interface{} // New value, nil keeps the current value
+	Formula *string     // New formula, nil keeps the current formula
+	StyleID *int        // New metadata style ID, nil keeps the current style
+}
+
+// ApplyPatch applies cell patches to metadata in place. Cells that do not
+// exist yet are added to their sheet.
+func ApplyPatch(metadata *excelmetadata.Metadata, patch []CellPatch) error {
+	if metadata == nil {
+		return fmt.Errorf("metadata is nil")
+	}
+
+	for _, p := range patch {
+		if _, _, err := excelize.CellNameToCoordinates(p.Address); err != nil {
+			return fmt.Errorf("invalid cell address %s: %w", p.Address, err)
+		}
+
+		sheet := findSheet(metadata, p.Sheet)
+		if sheet == nil {
+			return fmt.Errorf("sheet %s not found", p.Sheet)
+		}
+
+		var cell *excelmetadata.CellMetadata
+		for i := range sheet.Cells {
+			if strings.EqualFold(sheet.Cells[i].Address, p.Address) {
+				cell = &sheet.Cells[i]
+				break
+			}
+		}
+		if cell == nil {
+			sheet.Cells = append(sheet.Cells, excelmetadata.CellMetadata{Address: strings.ToUpper(p.Address)})
+			cell = &sheet.Cells[len(sheet.Cells)-1]
+		}
+
+		if p.Value != nil {
+			cell.Value = p.Value
+		}
+		if p.Formula != nil {
+			cell.Formula = *p.Formula
+		}
+		if p.StyleID != nil {
+			cell.StyleID = *p.StyleID
+		}
+	}
+
+	return nil
+}
+
+// findSheet returns the sheet with the given name, or nil
+func findSheet(metadata *excelmetadata.Metadata, name string) *excelmetadata.SheetMetadata {
+	for i := range metadata.Sheets {
+		if metadata.Sheets[i].Name == name {
+			return &metadata.Sheets[i]
+		}
+	}
+	return nil
+}
+
+// MergeMetadata combines metadata parts, such as one part per sheet, into one
+// metadata object. Sheets keep the order of the parts and are renumbered from
+// 0. Styles are shared when identical; a style ID already used by a different
+// style is renumbered, and the part's cells are updated to match. The
+// properties and filename of the first part that has them are kept.
+func MergeMetadata(parts ...*excelmetadata.Metadata) *excelmetadata.Metadata {
+	merged := &excelmetadata.Metadata{Styles: make(map[int]excelmetadata.StyleDetails)}
+
+	nextStyleID := 0
+	for _, part := range parts {
+		if part == nil {
+			continue
+		}
+		for id := range part.Styles {
+			nextStyleID = max(nextStyleID, id+1)
+		}
+	}
+
+	for _, part := range parts {
+		if part == nil {
+			continue
+		}
+		if merged.Filename == "" {
+			merged.Filename = part.Filename
+		}
+		if merged.Properties == (excelmetadata.DocumentProperties{}) {
+			merged.Properties = part.Properties
+		}
+		if merged.ExtractedAt.IsZero() {
+			merged.ExtractedAt = part.ExtractedAt
+		}
+
+		ids := make([]int, 0, len(part.Styles))
+		for id := range part.Styles {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+
+		styleIDs := make(map[int]int) // Maps the part's style IDs to merged IDs
+		for _, id := range ids {
+			style := part.Styles[id]
+			existing, exists := merged.Styles[id]
+			switch {
+			case !exists:
+				merged.Styles[id] = style
+				styleIDs[id] = id
+			case jsonEqual(existing, style):
+				styleIDs[id] = id
+			default:
+				merged.Styles[nextStyleID] = style
+				styleIDs[id] = nextStyleID
+				nextStyleID++
+			}
+		}
+
+		for _, sheet := range part.Sheets {
+			sheet.Index = len(merged.Sheets)
+			cells := make([]excelmetadata.CellMetadata, len(sheet.Cells))
+			for i, cell := range sheet.Cells {
+				if id, exists := styleIDs[cell.StyleID]; exists {
+					cell.StyleID = id
+				}
+				cells[i] = cell
+			}
+			sheet.Cells = cells
+			merged.Sheets = append(merged.Sheets, sheet)
+		}
+		merged.DefinedNames = append(merged.DefinedNames, part.DefinedNames...)
+	}
+
+	return merged
+}
+
+// SplitMetadata writes metadata to dir as one indented JSON file per sheet,
+// named by position and sheet name (e.g. "001_Sales.json"), which
+// NewFromJSONDir merges back in order. Each file holds the styles its cells
+// reference and the defined names scoped to its sheet. The first file also
+// holds every other style and the other defined names. Files of an earlier
+// split, named as above and holding that one sheet, are removed first; any
+// other JSON file in dir is an error and nothing is removed, as
+// NewFromJSONDir would merge it in.
+func SplitMetadata(metadata *excelmetadata.Metadata, dir string) error {
+	if metadata == nil {
+		return fmt.Errorf("metadata is nil")
+	}
+	if len(metadata.Sheets) == 0 {
+		return fmt.Errorf("metadata has no sheets")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := removeShards(dir); err != nil {
+		return err
+	}
+
+	sheetNames := make(map[string]bool)
+	for _, sheet := range metadata.Sheets {
+		sheetNames[sheet.Name] = true
+	}
+
+	width := max(3, len(strconv.Itoa(len(metadata.Sheets))))
+	for i, sheet := range metadata.Sheets {
+		part := &excelmetadata.Metadata{
+			Filename:    metadata.Filename,
+			Properties:  metadata.Properties,
+			ExtractedAt: metadata.ExtractedAt,
+			Styles:      make(map[int]excelmetadata.StyleDetails),
+			Sheets:      []excelmetadata.SheetMetadata{sheet},
+		}
+		if i == 0 {
+			for id, style := range metadata.Styles {
+				part.Styles[id] = style
+			}
+		}
+		for _, cell := range sheet.Cells {
+			if style, exists := metadata.Styles[cell.StyleID]; exists {
+				part.Styles[cell.StyleID] = style
+			}
+		}
+		for _, name := range metadata.DefinedNames {
+			if name.Scope == sheet.Name || (i == 0 && !sheetNames[name.Scope]) {
+				part.DefinedNames = append(part.DefinedNames, name)
+			}
+		}
+
+		data, err := json.MarshalIndent(part, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal sheet %s: %w", sheet.Name, err)
+		}
+		filename := fmt.Sprintf("%0*d_%s.json", width, i+1, shardName(sheet.Name))
+		if err := os.WriteFile(filepath.Join(dir, filename), data, 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", filename, err)
+		}
+	}
+	return nil
+}
+
+// shardFile matches the filenames SplitMetadata writes, capturing the
+// position and the sheet name part
+var shardFile = regexp.MustCompile(`^([0-9]{3,})_(.+)\.json$`)
+
+// removeShards removes the files of an earlier split from dir. It fails
+// without removing anything if dir holds a JSON file SplitMetadata did not
+// write, as NewFromJSONDir would merge it in.
+func removeShards(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return fmt.Errorf("failed to list JSON files: %w", err)
+	}
+	for _, path := range paths {
+		if !isShard(path) {
+			return fmt.Errorf("%s holds %s, which NewFromJSONDir would merge; split into an empty directory", dir, filepath.Base(path))
+		}
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", filepath.Base(path), err)
+		}
+	}
+	return nil
+}
+
+// isShard reports whether path is a file SplitMetadata wrote: its name has
+// the position and sheet name pattern and it holds metadata of that one sheet
+func isShard(path string) bool {
+	match := shardFile.FindStringSubmatch(filepath.Base(path))
+	if match == nil {
+		return false
+	}
+	if position, err := strconv.Atoi(match[1]); err != nil || position < 1 {
+		return false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var part excelmetadata.Metadata
+	if err := json.Unmarshal(data, &part); err != nil {
+		return false
+	}
+	return len(part.Sheets) == 1 && shardName(part.Sheets[0].Name) == match[2]
+}
+
+// shardName returns a sheet name usable in a filename, replacing characters
+// other than letters, digits, "-" and "_" with "_"
+func shardName(sheetName string) string {
+	if sheetName == "" {
+		return "sheet"
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, sheetName)
+}
+
+// ReplaceValues replaces every cell value equal to oldValue with newValue in
+// place and returns the number of cells changed. Values are compared by their
+// JSON encoding, so 0 matches 0.0 but not "0", and values such as slices are
+// compared safely.
+func ReplaceValues(metadata *excelmetadata.Metadata, oldValue, newValue interface{}) int {
+	if metadata == nil {
+		return 0
+	}
+	oldData, err := json.Marshal(oldValue)
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	for i := range metadata.Sheets {
+		cells := metadata.Sheets[i].Cells
+		for j := range cells {
+			data, err := json.Marshal(cells[j].Value)
+			if err == nil && bytes.Equal(data, oldData) {
+				cells[j].Value = newValue
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// CopyMetadata returns a deep copy of metadata, so that changes to the copy's
+// sheets, cells, styles and other slices and maps leave the original intact
+func CopyMetadata(metadata *excelmetadata.Metadata) *excelmetadata.Metadata {
+	if metadata == nil {
+		return nil
+	}
+	return deepCopy(reflect.ValueOf(metadata)).Interface().(*excelmetadata.Metadata)
+}
+
+// deepCopy copies a value, following pointers, slices, maps and interfaces.
+// Unexported struct fields, such as those of time.Time, are copied as is.
+func deepCopy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), deepCopy(iter.Value()))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(deepCopy(v.Field(i)))
+			}
+		}
+		return c
+	}
+	return v
+}
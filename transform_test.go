@@ -0,0 +1,396 @@
+package excelrecreator
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prongbang/excelmetadata"
+)
+
+func TestApplyPatch(t *testing.T) {
+	formula := "SUM(A1:A4)"
+	styleID := 3
+
+	tests := []struct {
+		name        string
+		patch       CellPatch
+		wantErr     bool
+		wantCells   int
+		wantValue   interface{}
+		wantFormula string
+		wantStyleID int
+	}{
+		{name: "change existing cell", patch: CellPatch{Sheet: "Data", Address: "B2", Value: "new"}, wantCells: 2, wantValue: "new", wantStyleID: 1},
+		{name: "address case ignored", patch: CellPatch{Sheet: "Data", Address: "b2", StyleID: &styleID}, wantCells: 2, wantValue: "old", wantStyleID: 3},
+		{name: "add new cell", patch: CellPatch{Sheet: "Data", Address: "f5", Value: 42.0, Formula: &formula}, wantCells: 3, wantValue: 42.0, wantFormula: formula},
+		{name: "unknown sheet", patch: CellPatch{Sheet: "Missing", Address: "A1", Value: "x"}, wantErr: true},
+		{name: "invalid address", patch: CellPatch{Sheet: "Data", Address: "1A", Value: "x"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b2 := newCell("B2", "old")
+			b2.StyleID = 1
+			metadata := &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{newSheet(0, "Data", newCell("A1", "header"), b2)}}
+
+			err := ApplyPatch(metadata, []CellPatch{tt.patch})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyPatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			cells := metadata.Sheets[0].Cells
+			if len(cells) != tt.wantCells {
+				t.Fatalf("cells = %d, want %d", len(cells), tt.wantCells)
+			}
+			var cell *excelmetadata.CellMetadata
+			for i := range cells {
+				if cells[i].Address == strings.ToUpper(tt.patch.Address) {
+					cell = &cells[i]
+				}
+			}
+			if cell == nil {
+				t.Fatalf("cell %s not found", tt.patch.Address)
+			}
+			if cell.Value != tt.wantValue || cell.Formula != tt.wantFormula || cell.StyleID != tt.wantStyleID {
+				t.Errorf("cell = %v, %q, %d, want %v, %q, %d", cell.Value, cell.Formula, cell.StyleID, tt.wantValue, tt.wantFormula, tt.wantStyleID)
+			}
+		})
+	}
+}
+
+func TestMergeMetadata(t *testing.T) {
+	bold := excelmetadata.StyleDetails{Font: &excelmetadata.FontStyle{Bold: true}}
+	italic := excelmetadata.StyleDetails{Font: &excelmetadata.FontStyle{Italic: true}}
+	styledCell := func(address string, styleID int) excelmetadata.CellMetadata {
+		return excelmetadata.CellMetadata{Address: address, Value: address, StyleID: styleID}
+	}
+
+	tests := []struct {
+		name          string
+		parts         []*excelmetadata.Metadata
+		wantSheets    []string
+		wantCellStyle []int // Style ID of the first cell of each sheet
+		wantStyles    map[int]excelmetadata.StyleDetails
+	}{
+		{
+			name: "shared style",
+			parts: []*excelmetadata.Metadata{
+				{Styles: map[int]excelmetadata.StyleDetails{1: bold}, Sheets: []excelmetadata.SheetMetadata{{Index: 3, Name: "A", Cells: []excelmetadata.CellMetadata{styledCell("A1", 1)}}}},
+				{Styles: map[int]excelmetadata.StyleDetails{1: bold}, Sheets: []excelmetadata.SheetMetadata{{Index: 0, Name: "B", Cells: []excelmetadata.CellMetadata{styledCell("A1", 1)}}}},
+			},
+			wantSheets:    []string{"A", "B"},
+			wantCellStyle: []int{1, 1},
+			wantStyles:    map[int]excelmetadata.StyleDetails{1: bold},
+		},
+		{
+			name: "conflicting style renumbered",
+			parts: []*excelmetadata.Metadata{
+				{Styles: map[int]excelmetadata.StyleDetails{1: bold}, Sheets: []excelmetadata.SheetMetadata{{Name: "A", Cells: []excelmetadata.CellMetadata{styledCell("A1", 1)}}}},
+				{Styles: map[int]excelmetadata.StyleDetails{1: italic}, Sheets: []excelmetadata.SheetMetadata{{Name: "B", Cells: []excelmetadata.CellMetadata{styledCell("A1", 1)}}}},
+			},
+			wantSheets:    []string{"A", "B"},
+			wantCellStyle: []int{1, 2},
+			wantStyles:    map[int]excelmetadata.StyleDetails{1: bold, 2: italic},
+		},
+		{
+			name: "nil part",
+			parts: []*excelmetadata.Metadata{
+				nil,
+				{Sheets: []excelmetadata.SheetMetadata{{Name: "A", Cells: []excelmetadata.CellMetadata{styledCell("A1", 0)}}}},
+			},
+			wantSheets:    []string{"A"},
+			wantCellStyle: []int{0},
+			wantStyles:    map[int]excelmetadata.StyleDetails{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := MergeMetadata(tt.parts...)
+
+			if len(merged.Sheets) != len(tt.wantSheets) {
+				t.Fatalf("sheets = %d, want %d", len(merged.Sheets), len(tt.wantSheets))
+			}
+			for i, sheet := range merged.Sheets {
+				if sheet.Name != tt.wantSheets[i] || sheet.Index != i {
+					t.Errorf("sheet %d = %s at %d, want %s at %d", i, sheet.Name, sheet.Index, tt.wantSheets[i], i)
+				}
+				if got := sheet.Cells[0].StyleID; got != tt.wantCellStyle[i] {
+					t.Errorf("sheet %s style = %d, want %d", sheet.Name, got, tt.wantCellStyle[i])
+				}
+			}
+			if len(merged.Styles) != len(tt.wantStyles) {
+				t.Errorf("styles = %d, want %d", len(merged.Styles), len(tt.wantStyles))
+			}
+			for id, want := range tt.wantStyles {
+				if !jsonEqual(merged.Styles[id], want) {
+					t.Errorf("style %d = %+v, want %+v", id, merged.Styles[id], want)
+				}
+			}
+		})
+	}
+}
+
+func TestReplaceValues(t *testing.T) {
+	newMetadata := func() *excelmetadata.Metadata {
+		return &excelmetadata.Metadata{Sheets: []excelmetadata.SheetMetadata{
+			newSheet(0, "Q1", newCell("A1", "N/A"), newCell("A2", 5), newCell("A3", "N/A")),
+			newSheet(1, "Q2", newCell("A1", "N/A"), newCell("A2", 0.0), newCell("A3", "0")),
+		}}
+	}
+
+	tests := []struct {
+		name      string
+		metadata  *excelmetadata.Metadata
+		oldValue  interface{}
+		newValue  interface{}
+		wantCount int
+		wantQ1    []interface{}
+		wantQ2    []interface{}
+	}{
+		{
+			name: "text across sheets", metadata: newMetadata(), oldValue: "N/A", newValue: 0, wantCount: 3,
+			wantQ1: []interface{}{0, 5, 0}, wantQ2: []interface{}{0, 0.0, "0"},
+		},
+		{
+			name: "number matches float", metadata: newMetadata(), oldValue: 0, newValue: "zero", wantCount: 1,
+			wantQ1: []interface{}{"N/A", 5, "N/A"}, wantQ2: []interface{}{"N/A", "zero", "0"},
+		},
+		{
+			name: "no match", metadata: newMetadata(), oldValue: "missing", newValue: 1,
+			wantQ1: []interface{}{"N/A", 5, "N/A"}, wantQ2: []interface{}{"N/A", 0.0, "0"},
+		},
+		{name: "nil metadata", oldValue: "N/A", newValue: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReplaceValues(tt.metadata, tt.oldValue, tt.newValue); got != tt.wantCount {
+				t.Errorf("ReplaceValues() = %d, want %d", got, tt.wantCount)
+			}
+			if tt.metadata == nil {
+				return
+			}
+			for i, want := range [][]interface{}{tt.wantQ1, tt.wantQ2} {
+				for j, cell := range tt.metadata.Sheets[i].Cells {
+					if cell.Value != want[j] {
+						t.Errorf("%s!%s = %#v, want %#v", tt.metadata.Sheets[i].Name, cell.Address, cell.Value, want[j])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCopyMetadata(t *testing.T) {
+	newMetadata := func() *excelmetadata.Metadata {
+		sheet := newSheet(0, "Data",
+			excelmetadata.CellMetadata{Address: "A1", Value: "text", StyleID: 1, Hyperlink: &excelmetadata.Hyperlink{Link: "https://example.com"}},
+			newCell("A2", []interface{}{"nested", 1.0}),
+		)
+		sheet.ColWidths = map[string]float64{"A": 20}
+		sheet.MergedCells = []excelmetadata.MergedCell{{StartCell: "A1", EndCell: "B1"}}
+		sheet.Images = []excelmetadata.ImageMetadata{{Cell: "C3", File: []byte{1, 2, 3}, Format: &excelmetadata.ImageFormat{AltText: "logo"}}}
+		return &excelmetadata.Metadata{
+			Filename:     "report.xlsx",
+			Sheets:       []excelmetadata.SheetMetadata{sheet},
+			DefinedNames: []excelmetadata.DefinedName{{Name: "Total", RefersTo: "Data!$A$1"}},
+			Styles:       map[int]excelmetadata.StyleDetails{1: {Font: &excelmetadata.FontStyle{Bold: true}, Border: []excelmetadata.BorderStyle{{Type: "top"}}}},
+			ExtractedAt:  time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(m *excelmetadata.Metadata)
+	}{
+		{name: "cell value", mutate: func(m *excelmetadata.Metadata) { m.Sheets[0].Cells[0].Value = "changed" }},
+		{name: "appended cell", mutate: func(m *excelmetadata.Metadata) { m.Sheets[0].Cells = append(m.Sheets[0].Cells, newCell("Z9", 1)) }},
+		{name: "nested value", mutate: func(m *excelmetadata.Metadata) { m.Sheets[0].Cells[1].Value.([]interface{})[0] = "changed" }},
+		{name: "hyperlink", mutate: func(m *excelmetadata.Metadata) { m.Sheets[0].Cells[0].Hyperlink.Link = "changed" }},
+		{name: "column width", mutate: func(m *excelmetadata.Metadata) { m.Sheets[0].ColWidths["A"] = 5 }},
+		{name: "merge", mutate: func(m *excelmetadata.Metadata) { m.Sheets[0].MergedCells[0].EndCell = "Z9" }},
+		{name: "image bytes", mutate: func(m *excelmetadata.Metadata) { m.Sheets[0].Images[0].File[0] = 9 }},
+		{name: "image format", mutate: func(m *excelmetadata.Metadata) { m.Sheets[0].Images[0].Format.AltText = "changed" }},
+		{name: "defined name", mutate: func(m *excelmetadata.Metadata) { m.DefinedNames[0].Name = "changed" }},
+		{name: "style font", mutate: func(m *excelmetadata.Metadata) { m.Styles[1].Font.Bold = false }},
+		{name: "style border", mutate: func(m *excelmetadata.Metadata) { m.Styles[1].Border[0].Type = "bottom" }},
+		{name: "new style", mutate: func(m *excelmetadata.Metadata) { m.Styles[2] = excelmetadata.StyleDetails{} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := newMetadata()
+			copied := CopyMetadata(original)
+			if !jsonEqual(copied, original) {
+				t.Fatalf("copy differs from the original")
+			}
+			if !copied.ExtractedAt.Equal(original.ExtractedAt) {
+				t.Errorf("extracted at = %v, want %v", copied.ExtractedAt, original.ExtractedAt)
+			}
+
+			tt.mutate(copied)
+			if !jsonEqual(original, newMetadata()) {
+				t.Errorf("original changed with the copy")
+			}
+		})
+	}
+
+	if CopyMetadata(nil) != nil {
+		t.Errorf("CopyMetadata(nil) != nil")
+	}
+}
+
+func TestSplitMetadata(t *testing.T) {
+	newMetadata := func() *excelmetadata.Metadata {
+		return &excelmetadata.Metadata{
+			Styles: map[int]excelmetadata.StyleDetails{
+				1: {Font: &excelmetadata.FontStyle{Bold: true}},
+				2: {NumberFormat: 4},
+				3: {Font: &excelmetadata.FontStyle{Italic: true}}, // Unused
+			},
+			Sheets: []excelmetadata.SheetMetadata{
+				newSheet(0, "Sales", excelmetadata.CellMetadata{Address: "A1", Value: "Region", StyleID: 1}, newCell("A2", "North")),
+				newSheet(1, "Costs", excelmetadata.CellMetadata{Address: "B2", Value: 1234.5, StyleID: 2}),
+				newSheet(2, "Q1/Q2", newCell("C3", "notes")),
+			},
+			DefinedNames: []excelmetadata.DefinedName{
+				{Name: "Regions", RefersTo: "Sales!$A$2:$A$10"},
+				{Name: "Total", RefersTo: "Costs!$B$2", Scope: "Costs"},
+			},
+		}
+	}
+	wantFiles := []string{"001_Sales.json", "002_Costs.json", "003_Q1_Q2.json"}
+
+	tests := []struct {
+		name      string
+		existing  map[string]string // Files in the directory before the split
+		wantFiles []string
+		wantErr   string
+	}{
+		{name: "empty directory", wantFiles: wantFiles},
+		{
+			name:      "stale shards removed",
+			existing:  map[string]string{"001_Old.json": `{"sheets":[{"name":"Old"}]}`, "004_Re_moved.json": `{"sheets":[{"name":"Re/moved"}]}`, "README.md": "kept"},
+			wantFiles: append([]string{"README.md"}, wantFiles...),
+		},
+		{
+			name:      "other JSON files refused",
+			existing:  map[string]string{"004_Removed.json": `{"sheets":[{"name":"Removed"}]}`, "notes.json": "{}"},
+			wantFiles: []string{"004_Removed.json", "notes.json"},
+			wantErr:   "notes.json",
+		},
+		{
+			name:      "user file with a number prefix kept",
+			existing:  map[string]string{"2024_budget.json": `{"total": 1200}`},
+			wantFiles: []string{"2024_budget.json"},
+			wantErr:   "2024_budget.json",
+		},
+		{
+			name:      "short number prefix kept",
+			existing:  map[string]string{"01_notes.json": `{"sheets":[{"name":"notes"}]}`},
+			wantFiles: []string{"01_notes.json"},
+			wantErr:   "01_notes.json",
+		},
+		{
+			name:      "sheet name not matching the filename kept",
+			existing:  map[string]string{"001_Old.json": `{"sheets":[{"name":"Other"}]}`},
+			wantFiles: []string{"001_Old.json"},
+			wantErr:   "001_Old.json",
+		},
+		{
+			name:      "several sheets kept",
+			existing:  map[string]string{"001_Old.json": `{"sheets":[{"name":"Old"},{"name":"New"}]}`},
+			wantFiles: []string{"001_Old.json"},
+			wantErr:   "001_Old.json",
+		},
+		{
+			name:      "invalid JSON kept",
+			existing:  map[string]string{"001_Old.json": "not json"},
+			wantFiles: []string{"001_Old.json"},
+			wantErr:   "001_Old.json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.existing {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := SplitMetadata(newMetadata(), dir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("SplitMetadata() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("SplitMetadata() error = %v", err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var files []string
+			for _, entry := range entries {
+				files = append(files, entry.Name())
+			}
+			slices.Sort(files)
+			want := slices.Sorted(slices.Values(tt.wantFiles))
+			if !slices.Equal(files, want) {
+				t.Fatalf("files = %v, want %v", files, want)
+			}
+			if tt.wantErr != "" {
+				return
+			}
+
+			// Each shard recreates its own sheet
+			wantCells := []map[string]string{{"A1": "Region", "A2": "North"}, {"B2": "1,234.50"}, {"C3": "notes"}}
+			wantStyles := []int{3, 1, 0}
+			for i, file := range wantFiles {
+				data, err := os.ReadFile(filepath.Join(dir, file))
+				if err != nil {
+					t.Fatal(err)
+				}
+				r, err := NewFromJSON(data, DefaultOptions())
+				if err != nil {
+					t.Fatalf("%s: %v", file, err)
+				}
+				if err := r.Recreate(); err != nil {
+					t.Fatalf("%s: Recreate() error = %v", file, err)
+				}
+				if len(r.Metadata.Styles) != wantStyles[i] {
+					t.Errorf("%s styles = %d, want %d", file, len(r.Metadata.Styles), wantStyles[i])
+				}
+				sheetName := r.File.GetSheetList()[0]
+				for address, want := range wantCells[i] {
+					if got, _ := r.File.GetCellValue(sheetName, address); got != want {
+						t.Errorf("%s %s!%s = %q, want %q", file, sheetName, address, got, want)
+					}
+				}
+			}
+
+			// The shards merge back into the metadata
+			r, err := NewFromJSONDir(dir, DefaultOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diffs := DiffMetadata(newMetadata(), r.Metadata); len(diffs) > 0 {
+				t.Errorf("merged metadata differs: %+v", diffs)
+			}
+			if want := newMetadata().DefinedNames; !jsonEqual(r.Metadata.DefinedNames, want) {
+				t.Errorf("merged defined names = %+v, want %+v", r.Metadata.DefinedNames, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package excelrecreator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// applyActiveTab activates the sheet at WorkbookView.ActiveTab
+func (r *Recreator) applyActiveTab() error {
+	index := *r.Options.WorkbookView.ActiveTab
+	if index < 0 || index >= r.File.SheetCount {
+		return fmt.Errorf("active tab %d out of range", index)
+	}
+	r.File.SetActiveSheet(index)
+	return nil
+}
+
+// workbookViewEdits adds the edit setting the first visible tab and window of
+// Options.WorkbookView, which excelize has no API for
+func (r *Recreator) workbookViewEdits(edits map[string]partEdit) {
+	view := r.Options.WorkbookView
+	if view == nil {
+		return
+	}
+
+	var attrs [][2]string
+	if view.FirstSheet > 0 {
+		attrs = append(attrs, [2]string{"firstSheet", strconv.Itoa(min(view.FirstSheet, r.File.SheetCount-1))})
+	}
+	if view.XWindow != 0 || view.YWindow != 0 {
+		attrs = append(attrs, [2]string{"xWindow", strconv.Itoa(view.XWindow)}, [2]string{"yWindow", strconv.Itoa(view.YWindow)})
+	}
+	if view.WindowWidth > 0 {
+		attrs = append(attrs, [2]string{"windowWidth", strconv.Itoa(view.WindowWidth)})
+	}
+	if view.WindowHeight > 0 {
+		attrs = append(attrs, [2]string{"windowHeight", strconv.Itoa(view.WindowHeight)})
+	}
+	if len(attrs) == 0 {
+		return
+	}
+
+	edits["xl/workbook.xml"] = func(data []byte) ([]byte, error) {
+		xml := string(data)
+		if !strings.Contains(xml, "<workbookView") {
+			i := strings.Index(xml, "<sheets>")
+			if i < 0 {
+				return nil, fmt.Errorf("invalid workbook XML")
+			}
+			xml = xml[:i] + "<bookViews><workbookView/></bookViews>" + xml[i:]
+		}
+		for _, attr := range attrs {
+			xml, _ = setXMLAttr(xml, "workbookView", attr[0], attr[1])
+		}
+		return []byte(xml), nil
+	}
+}
@@ -0,0 +1,87 @@
+package excelrecreator
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/prongbang/excelmetadata"
+)
+
+func TestWorkbookView(t *testing.T) {
+	one, three := 1, 3
+	sheets := []excelmetadata.SheetMetadata{
+		newSheet(0, "First", newCell("A1", 1)),
+		newSheet(1, "Second", newCell("A1", 2)),
+		newSheet(2, "Third", newCell("A1", 3)),
+	}
+
+	tests := []struct {
+		name       string
+		view       *WorkbookView
+		wantActive string
+		wantAttrs  []string
+		wantErr    string
+	}{
+		{
+			name:       "first sheet",
+			view:       &WorkbookView{FirstSheet: 1},
+			wantActive: "First",
+			wantAttrs:  []string{`firstSheet="1"`},
+		},
+		{
+			name:       "first sheet clamped to last sheet",
+			view:       &WorkbookView{FirstSheet: 10},
+			wantActive: "First",
+			wantAttrs:  []string{`firstSheet="2"`},
+		},
+		{
+			name:       "active tab",
+			view:       &WorkbookView{ActiveTab: &one},
+			wantActive: "Second",
+			wantAttrs:  []string{`activeTab="1"`},
+		},
+		{
+			name:       "window",
+			view:       &WorkbookView{XWindow: 120, YWindow: 240, WindowWidth: 28800, WindowHeight: 17280},
+			wantActive: "First",
+			wantAttrs:  []string{`xWindow="120"`, `yWindow="240"`, `windowWidth="28800"`, `windowHeight="17280"`},
+		},
+		{
+			name:    "active tab out of range",
+			view:    &WorkbookView{ActiveTab: &three},
+			wantErr: "active tab 3 out of range",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.WorkbookView = tt.view
+			r := New(&excelmetadata.Metadata{Sheets: sheets}, options)
+			err := r.Recreate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Recreate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Recreate() error = %v", err)
+			}
+
+			if got := r.File.GetSheetName(r.File.GetActiveSheetIndex()); got != tt.wantActive {
+				t.Errorf("active sheet = %q, want %q", got, tt.wantActive)
+			}
+			workbookView := regexp.MustCompile(`<workbookView[^>]*>`).FindString(partXML(t, r.File, "xl/workbook.xml"))
+			for _, attr := range tt.wantAttrs {
+				if !strings.Contains(workbookView, " "+attr) {
+					t.Errorf("workbookView %s has no %s", workbookView, attr)
+				}
+			}
+			if got := getCellValue(t, r, "Third", "A1"); got != "3" {
+				t.Errorf("Third!A1 = %q, want %q", got, "3")
+			}
+		})
+	}
+}